@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -16,6 +18,26 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Reconciling the balances with the ledger: reconcile [-correct]
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		cmd := flag.NewFlagSet("reconcile", flag.ExitOnError)
+		correct := cmd.Bool("correct", false, "sets the drifted balances to the ledger")
+		cmd.Parse(os.Args[2:])
+
+		app.Reconcile(ctx, *correct)
+		return
+	}
+
+	// Migrating the data base: migrate [-dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		cmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+		dryRun := cmd.Bool("dry-run", false, "only prints the pending migrations")
+		cmd.Parse(os.Args[2:])
+
+		app.Migrate(ctx, *dryRun)
+		return
+	}
+
 	// Running the app
 	app.Run(ctx)
 }
@@ -0,0 +1,124 @@
+package company_cfg
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	InvalidTicker       = "invalid ticker"        // invalid ticker
+	InvalidName         = "invalid name"          // invalid name
+	InvalidPrice        = "invalid price"         // invalid price
+	InvalidDividendRate = "invalid dividend rate" // invalid dividend rate
+)
+
+// The default company, the stocks of the old single stock balance are its stocks
+const (
+	DefaultTicker       = "STK"
+	DefaultName         = "Stocks"
+	DefaultDividendRate = 1 // the old stock update paid one solid for one stock
+)
+
+// The ticker: an uppercase letter with up to 7 uppercase letters or digits
+var validTicker = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,7}$`)
+
+// The maximum length of the company name
+const NameLimit = 64
+
+// The company structure
+//
+// Ticker: the unique short name of the company stocks
+// Price: the stock price, nil if it isn't set yet (the initial market price is used)
+// DividendRate: the solids paid for one stock on every stock update
+type Company struct {
+	Ticker       string           `json:"ticker"`
+	Name         string           `json:"name"`
+	Price        *price_cfg.Price `json:"price"`
+	DividendRate float64          `json:"dividend_rate"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+// Sets the company to string
+func (c Company) String() string {
+	var price string
+	if c.Price != nil {
+		price = fmt.Sprintf(", price - %.2f", c.Price.Value)
+	}
+	return fmt.Sprintf("company %s (%s). dividend rate - %g%s", c.Ticker, c.Name, c.DividendRate, price)
+}
+
+// Parses the ticker, the empty ticker is the default ticker
+func ParseTicker(ticker string) (string, error) {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	if ticker == "" {
+		return DefaultTicker, nil
+	}
+
+	if !validTicker.MatchString(ticker) {
+		return "", vanerrors.NewSimple(InvalidTicker, fmt.Sprintf("ticker %s should be an uppercase letter with up to 7 uppercase letters or digits", ticker))
+	}
+
+	return ticker, nil
+}
+
+// Creates a new company, the price could be zero (the initial market price is used)
+func NewCompany(ticker string, name string, price float64, dividendRate float64) (*Company, error) {
+	// Checks the company
+	ticker, err := ParseTicker(ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > NameLimit {
+		return nil, vanerrors.NewSimple(InvalidName, fmt.Sprintf("the name should have from 1 to %d bytes", NameLimit))
+	}
+
+	if price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return nil, vanerrors.NewSimple(InvalidPrice, "the price can't be negative")
+	}
+
+	if dividendRate < 0 || math.IsNaN(dividendRate) || math.IsInf(dividendRate, 0) {
+		return nil, vanerrors.NewSimple(InvalidDividendRate, "the dividend rate can't be negative")
+	}
+
+	now := time.Now()
+
+	c := &Company{
+		Ticker:       ticker,
+		Name:         name,
+		DividendRate: dividendRate,
+		CreatedAt:    now,
+	}
+	if price > 0 {
+		c.Price = &price_cfg.Price{Value: price, UpdatedAt: now}
+	}
+
+	return c, nil
+}
+
+// Gets the default company
+func Default() Company {
+	return Company{
+		Ticker:       DefaultTicker,
+		Name:         DefaultName,
+		DividendRate: DefaultDividendRate,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// Gets the dividend of the amount of stocks (rounded down)
+func (c Company) Dividend(amount int64) int64 {
+	d := math.Floor(float64(amount) * c.DividendRate)
+	if d >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(d)
+}
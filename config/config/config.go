@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/vandi37/vanerrors"
@@ -11,9 +12,16 @@ import (
 const (
 	ErrorReadingConfig      = "error reading config"
 	ErrorUnmarshalingConfig = "error unmarshaling config"
+	EmptyKey                = "empty key"
+	ShortSecret             = "short secret"
 )
 
+// The minimum length of the secret of the access tokens (the hmac key)
+const MinSecretLength = 32
+
 // The database connection config
+//
+// Timeout: the maximum time of the database work of one request, 0 is no limit
 type DatabaseCfg struct {
 	Type     string `yaml:"type"`
 	Host     string `yaml:"host"`
@@ -21,6 +29,7 @@ type DatabaseCfg struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	Name     string `yaml:"name"`
+	Timeout  string `yaml:"timeout"`
 }
 
 // The application config
@@ -29,13 +38,69 @@ type AppConfig struct {
 	Duration  string `yaml:"duration"`
 }
 
+// The access token config
+type TokenCfg struct {
+	Secret  string `yaml:"secret"`
+	Access  string `yaml:"access"`
+	Refresh string `yaml:"refresh"`
+}
+
+// The two factor authentication config
+type TwoFactorCfg struct {
+	Key    string `yaml:"key"`
+	Issuer string `yaml:"issuer"`
+}
+
+// The sign in limit config
+type LimitCfg struct {
+	Attempts   int    `yaml:"attempts"`
+	IpAttempts int    `yaml:"ip_attempts"`
+	Backoff    string `yaml:"backoff"`
+	MaxBackoff string `yaml:"max_backoff"`
+	Lockout    string `yaml:"lockout"`
+}
+
+// The password policy config
+type PasswordCfg struct {
+	MinLength int  `yaml:"min_length"`
+	MaxLength int  `yaml:"max_length"`
+	Lower     bool `yaml:"lower"`
+	Upper     bool `yaml:"upper"`
+	Digit     bool `yaml:"digit"`
+	Symbol    bool `yaml:"symbol"`
+}
+
+// The stock market config
+type MarketCfg struct {
+	SellFee     int64   `yaml:"sell_fee"`
+	Price       float64 `yaml:"price"`
+	Impact      float64 `yaml:"impact"`
+	Drift       float64 `yaml:"drift"`
+	DriftPeriod string  `yaml:"drift_period"`
+	MinPrice    float64 `yaml:"min_price"`
+	MaxPrice    float64 `yaml:"max_price"`
+	Retention   string  `yaml:"retention"`
+}
+
+// The ledger reconciliation config
+type LedgerCfg struct {
+	Reconcile string `yaml:"reconcile"`
+	Correct   bool   `yaml:"correct"`
+}
+
 // The standard config
 type Config struct {
-	Port     int         `yaml:"port"`
-	Database DatabaseCfg `yaml:"database"`
-	App      AppConfig   `yaml:"app"`
-	Salt     string      `yaml:"salt"`
-	Key      string      `yaml:"key"`
+	Port      int          `yaml:"port"`
+	Database  DatabaseCfg  `yaml:"database"`
+	App       AppConfig    `yaml:"app"`
+	Token     TokenCfg     `yaml:"token"`
+	TwoFactor TwoFactorCfg `yaml:"two_factor"`
+	Limit     LimitCfg     `yaml:"limit"`
+	Password  PasswordCfg  `yaml:"password"`
+	Market    MarketCfg    `yaml:"market"`
+	Ledger    LedgerCfg    `yaml:"ledger"`
+	Salt      string       `yaml:"salt"`
+	Key       string       `yaml:"key"`
 }
 
 // Loads config from the yaml file
@@ -54,5 +119,20 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, vanerrors.NewWrap(ErrorUnmarshalingConfig, err, vanerrors.EmptyHandler)
 	}
 
+	// The admin key signs in as the superadmin, it can't be empty
+	if config.Key == "" {
+		return nil, vanerrors.NewSimple(EmptyKey, "the admin key must be set")
+	}
+
+	// The key encrypts the totp secrets, they can't be encrypted with a known key
+	if config.TwoFactor.Key == "" {
+		return nil, vanerrors.NewSimple(EmptyKey, "the two factor key must be set")
+	}
+
+	// The secret signs the access tokens, a short one lets anyone forge them
+	if len(config.Token.Secret) < MinSecretLength {
+		return nil, vanerrors.NewSimple(ShortSecret, fmt.Sprintf("the token secret must have at least %d characters", MinSecretLength))
+	}
+
 	return &config, nil
 }
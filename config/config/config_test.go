@@ -0,0 +1,53 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/vanerrors"
+)
+
+// The valid config, the tests replace its lines
+const valid = `
+two_factor :
+  key : "two factor key"
+token :
+  secret : "a secret of the access tokens, long enough"
+key : "admin key"
+`
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		err  string
+	}{
+		{"valid", "", "", ""},
+		{"empty key", `key : "admin key"`, `key : ""`, config.EmptyKey},
+		{"empty two factor key", `key : "two factor key"`, `key : ""`, config.EmptyKey},
+		{"missing secret", `secret : "a secret of the access tokens, long enough"`, ``, config.ShortSecret},
+		{"short secret", `secret : "a secret of the access tokens, long enough"`, `secret : "short"`, config.ShortSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "config.yaml")
+			err := os.WriteFile(name, []byte(strings.Replace(valid, tt.old, tt.new, 1)), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = config.LoadConfig(name)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && vanerrors.GetName(err) != tt.err {
+				t.Fatalf("want %q error, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -1,15 +1,66 @@
 package db_cfg
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"time"
 
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
 	"github.com/vandi37/StocksBack/config/user_cfg"
 	"github.com/vandi37/StocksBack/pkg/query"
 )
 
+// The errors
+const (
+	NotEnoughBalance = "not enough balance" // the balance can't become negative
+	NotFound         = "not found"          // the user, company, order, session or key doesn't exist
+)
+
+// The balance change of the user, the stocks are stocks of the ticker company
+//
+// Reason: the kind and the reference of the ledger entry of the change
+type BalanceChange struct {
+	Id     uint64
+	Ticker string
+	Solids int64
+	Stocks int64
+	Reason ledger_cfg.Reason
+}
+
+// The migration of the stored data
+//
+// Checksum: the sha-256 of the migration, empty if the data base doesn't check it
+type Migration struct {
+	Version  int
+	Name     string
+	Checksum string
+}
+
+// Sets the migration to string
+func (m Migration) String() string {
+	return fmt.Sprintf("migration %04d %s", m.Version, m.Name)
+}
+
+// The data base with versioned migrations, Init applies the pending migrations
+//
+// - Migrate : Applies the pending migrations and returns them, with dry run only returns them
+type Migrator interface {
+	Migrate(ctx context.Context, dryRun bool) ([]Migration, error)
+}
+
 // The data base interface should represent any one-table data base
 // Ir should storage data based on the user_cfg.User signature
+// Every method gets the context of the operation, the queries are canceled with it
+// The missing users, companies, orders, sessions and keys are NotFound errors of every data base
+// Every balance change writes a ledger entry with the reason in the same transaction, the balances the users had before the ledger get opening entries on Init
 //
+// - WithTx : Runs the function in one transaction with the tx data base, the selected users, orders, companies, sessions and keys are locked until it ends, the changes are kept only if the function returns nil (its error is returned as it is), WithTx of tx is nested
 // - Create : Creates the table is it not exists
 // - NewUser : Creates a new user
 // - GetAll : Gets all users
@@ -19,23 +70,82 @@ import (
 // - SelectOneBy : Selects user by query
 // - Update : Updates user data
 // - UpdateGroup : Updates a group of users
+// - UpdateSolids : Changes the solids, fails with NotEnoughBalance
+// - UpdateStocks : Changes the stocks of the company, fails with NotEnoughBalance
+// - Transfer : Moves solids from one user to another atomically, fails with NotEnoughBalance
+// - GetEntries : Selects the ledger entries of the user with the id less then before (all if before is zero), the newest first, limit is the maximum amount
+// - GetDrifts : Compares the stored balances of all users with the sums of the ledger entries
+// - Correct : Sets the solids (the empty ticker) or the stocks of the company of the user to the sum of the ledger entries, writes an entry without changes
+// - CreateCompany : Creates a new company
+// - GetCompany : Selects a company by it's ticker
+// - GetCompanies : Selects all companies sorted by ticker
+// - GetPrice : Gets the stock price of the company, it returns nil if the price isn't saved yet
+// - SetPrice : Saves the stock price of the company
+// - AddTick : Adds a price change of the company to the history
+// - GetTicks : Selects the price changes of the company from (including) to (excluding) sorted by time
+// - DeleteTicks : Removes the price changes of the company before the time, returns the amount of removed changes
+// - AddCandles : Saves minute candles of the company (the downsampled price changes), the candles with the same start are replaced
+// - GetCandles : Selects the minute candles of the company from (including) to (excluding) sorted by time
+// - SaveOrders : Creates or updates the orders and applies the balance changes atomically, fails with NotEnoughBalance
+// - GetOrder : Selects an order by it's id
+// - GetOrders : Selects all orders of the user, the newest first
+// - GetOpenOrders : Selects the open orders of the company of the side sorted by the price-time priority
 // - GetLen : gets the total amount of users (it should get the last id of the user)
+// - CreateSession : Creates a new session
+// - GetSession : Selects a session by it's id
+// - UpdateSessionToken : Replaces the refresh token hash and expiry of the session
+// - RevokeSession : Revokes a session
+// - RevokeSessions : Revokes all sessions of the user, returns the amount of revoked sessions
+// - CreateKey : Creates a new api key
+// - GetKey : Selects an api key by it's id
+// - GetKeys : Selects all api keys of the user
+// - RevokeKey : Revokes an api key
 // - io.Closer : closes the data base
 type DataBase interface {
-	Init() error
-	Create(user user_cfg.User) error
-	GetAll() ([]user_cfg.User, error)
-	GetAllBy(query query.Query) ([]user_cfg.User, error)
-	GetNumBy(query query.Query, num int) ([]user_cfg.User, error)
-	GetOneBy(query query.Query) (*user_cfg.User, error)
-	GetOne(id uint64) (*user_cfg.User, error)
-	UpdateSolids(id uint64, num int64) (*user_cfg.User, error)
-	UpdateStocks(id uint64, num int64) (*user_cfg.User, error)
-	UpdateName(id uint64, name string) (*user_cfg.User, error)
-	UpdatePassword(id uint64, password string) (*user_cfg.User, error)
-	UpdateBlock(id uint64, block bool) (*user_cfg.User, error)
-	UpdateLastFarm(id uint64) (*user_cfg.User, error)
-	Len() (uint64, error)
-	CheckKey(key string) (bool, error)
+	Init(ctx context.Context) error
+	WithTx(ctx context.Context, fn func(tx DataBase) error) error
+	Create(ctx context.Context, user user_cfg.User) error
+	GetAll(ctx context.Context) ([]user_cfg.User, error)
+	GetAllBy(ctx context.Context, query query.Query) ([]user_cfg.User, error)
+	GetNumBy(ctx context.Context, query query.Query, num int) ([]user_cfg.User, error)
+	GetOneBy(ctx context.Context, query query.Query) (*user_cfg.User, error)
+	GetOne(ctx context.Context, id uint64) (*user_cfg.User, error)
+	UpdateSolids(ctx context.Context, id uint64, num int64, reason ledger_cfg.Reason) (*user_cfg.User, error)
+	UpdateStocks(ctx context.Context, id uint64, ticker string, num int64, reason ledger_cfg.Reason) (*user_cfg.User, error)
+	UpdateName(ctx context.Context, id uint64, name string) (*user_cfg.User, error)
+	UpdatePassword(ctx context.Context, id uint64, password string) (*user_cfg.User, error)
+	UpdateBlock(ctx context.Context, id uint64, block bool) (*user_cfg.User, error)
+	UpdateRole(ctx context.Context, id uint64, role user_cfg.Role) (*user_cfg.User, error)
+	UpdateTwoFactor(ctx context.Context, id uint64, tf user_cfg.TwoFactor) (*user_cfg.User, error)
+	UpdateLastFarm(ctx context.Context, id uint64) (*user_cfg.User, error)
+	Transfer(ctx context.Context, from uint64, to uint64, amount int64, reason ledger_cfg.Reason) (*user_cfg.User, *user_cfg.User, error)
+	GetEntries(ctx context.Context, userId uint64, before uint64, limit int) ([]ledger_cfg.Entry, error)
+	GetDrifts(ctx context.Context) ([]ledger_cfg.Drift, error)
+	Correct(ctx context.Context, id uint64, ticker string, reason ledger_cfg.Reason) (*user_cfg.User, error)
+	CreateCompany(ctx context.Context, company company_cfg.Company) error
+	GetCompany(ctx context.Context, ticker string) (*company_cfg.Company, error)
+	GetCompanies(ctx context.Context) ([]company_cfg.Company, error)
+	GetPrice(ctx context.Context, ticker string) (*price_cfg.Price, error)
+	SetPrice(ctx context.Context, ticker string, price price_cfg.Price) error
+	AddTick(ctx context.Context, ticker string, tick price_cfg.Tick) error
+	GetTicks(ctx context.Context, ticker string, from time.Time, to time.Time) ([]price_cfg.Tick, error)
+	DeleteTicks(ctx context.Context, ticker string, before time.Time) (int64, error)
+	AddCandles(ctx context.Context, ticker string, candles []price_cfg.Candle) error
+	GetCandles(ctx context.Context, ticker string, from time.Time, to time.Time) ([]price_cfg.Candle, error)
+	SaveOrders(ctx context.Context, orders []order_cfg.Order, changes []BalanceChange) ([]user_cfg.User, error)
+	GetOrder(ctx context.Context, id string) (*order_cfg.Order, error)
+	GetOrders(ctx context.Context, userId uint64) ([]order_cfg.Order, error)
+	GetOpenOrders(ctx context.Context, ticker string, side order_cfg.Side) ([]order_cfg.Order, error)
+	Len(ctx context.Context) (uint64, error)
+	CheckKey(ctx context.Context, key string) (bool, error)
+	CreateSession(ctx context.Context, session session_cfg.Session) error
+	GetSession(ctx context.Context, id string) (*session_cfg.Session, error)
+	UpdateSessionToken(ctx context.Context, id string, token string, expiresAt time.Time) (*session_cfg.Session, error)
+	RevokeSession(ctx context.Context, id string) (*session_cfg.Session, error)
+	RevokeSessions(ctx context.Context, userId uint64) (int64, error)
+	CreateKey(ctx context.Context, key key_cfg.Key) error
+	GetKey(ctx context.Context, id string) (*key_cfg.Key, error)
+	GetKeys(ctx context.Context, userId uint64) ([]key_cfg.Key, error)
+	RevokeKey(ctx context.Context, id string) (*key_cfg.Key, error)
 	io.Closer
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/vandi37/StocksBack/config/db_cfg"
 	"github.com/vandi37/StocksBack/pkg/db"
 	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/StocksBack/pkg/sqlite_db"
 	"github.com/vandi37/vanerrors"
 )
 
@@ -24,6 +25,8 @@ var db_constructors = map[string]Constructor{
 	"file":        file_db.Constructor{},
 	"fs":          file_db.Constructor{},
 	"file system": file_db.Constructor{},
+	"sqlite":      sqlite_db.Constructor{},
+	"memory":      file_db.MemoryConstructor{},
 }
 
 // Gets the constructor
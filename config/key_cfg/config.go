@@ -0,0 +1,138 @@
+package key_cfg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vandi37/StocksBack/pkg/hash"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGeneratingKey = "error generating key" // error generating key
+	InvalidKey         = "invalid key"          // invalid key
+	InvalidScope       = "invalid scope"        // invalid scope
+)
+
+// The key scope
+type Scope string
+
+// The scopes
+const (
+	READ     Scope = "read"     // getting data
+	FARM     Scope = "farm"     // farming
+	BUY      Scope = "buy"      // buying and selling stocks
+	TRANSFER Scope = "transfer" // transferring solids to other users
+	ACCOUNT  Scope = "account"  // changing name, password, keys and sessions
+	ADMIN    Scope = "admin"    // privileged routes, they are also checked by the role permissions
+)
+
+// All scopes
+var Scopes = []Scope{READ, FARM, BUY, TRANSFER, ACCOUNT, ADMIN}
+
+// Checks the scopes
+func CheckScopes(scopes []Scope) error {
+	for _, s := range scopes {
+		if !slices.Contains(Scopes, s) {
+			return vanerrors.NewSimple(InvalidScope, fmt.Sprintf("scope %s doesn't exist", s))
+		}
+	}
+	return nil
+}
+
+// The api key structure
+//
+// The key is "<id>.<secret>", only the hash of the secret is stored
+// ExpiresAt: zero time means that the key never expires
+type Key struct {
+	Id        string    `json:"id"`
+	UserId    uint64    `json:"user_id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []Scope   `json:"scopes"`
+	IsRevoked bool      `json:"is_revoked"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sets the key to string
+func (k Key) String() string {
+	// Adding revoke prefix
+	var revoked string
+	if k.IsRevoked {
+		revoked = "[REVOKED] "
+	}
+
+	return fmt.Sprintf("%skey %s (%s) of user %d, scopes: %v", revoked, k.Id, k.Name, k.UserId, k.Scopes)
+}
+
+// Generates a random hex string with n bytes
+func random(n int) (string, error) {
+	buf := make([]byte, n)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorGeneratingKey, err, vanerrors.EmptyHandler)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Creates a new key, returns it with the secret key string
+func NewKey(userId uint64, name string, scopes []Scope, expiresAt time.Time) (*Key, string, error) {
+	// Checks the scopes
+	err := CheckScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Creates the id
+	id, err := random(8)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Creates the secret
+	secret, err := random(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &Key{
+		Id:        id,
+		UserId:    userId,
+		Name:      name,
+		Hash:      hash.HashToken(secret),
+		Scopes:    scopes,
+		IsRevoked: false,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}, id + "." + secret, nil
+}
+
+// Splits the key string to the key id and secret
+func ParseKey(key string) (string, string, error) {
+	id, secret, ok := strings.Cut(key, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", vanerrors.NewSimple(InvalidKey)
+	}
+	return id, secret, nil
+}
+
+// Compares the secret with the stored hash
+func (k Key) CheckSecret(secret string) bool {
+	return hash.CompareToken(secret, k.Hash)
+}
+
+// Checks that the key is not revoked and not expired
+func (k Key) IsActive() bool {
+	return !k.IsRevoked && (k.ExpiresAt.IsZero() || time.Now().Before(k.ExpiresAt))
+}
+
+// Checks the scope
+func (k Key) HasScope(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope)
+}
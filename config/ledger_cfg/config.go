@@ -0,0 +1,193 @@
+package ledger_cfg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGeneratingReference = "error generating reference" // error generating reference
+)
+
+// The kind of the balance change
+type Kind string
+
+// The kinds
+const (
+	OPENING    Kind = "opening"    // the balance the user had before the ledger
+	FARM       Kind = "farm"       // farming solids
+	DIVIDEND   Kind = "dividend"   // the stock update
+	BUY        Kind = "buy"        // buying stocks at the market
+	SELL       Kind = "sell"       // selling stocks at the market
+	TRANSFER   Kind = "transfer"   // moving solids between users
+	ORDER      Kind = "order"      // reserving, trading and returning funds of the limit orders
+	ADJUSTMENT Kind = "adjustment" // the admin adjustment
+	CORRECTION Kind = "correction" // the balance is corrected to the ledger, the entry has no changes
+)
+
+// The reason of the balance change
+//
+// Reference: the id of the operation, all changes of one operation have the same reference
+// Memo: the optional note of the transfer
+type Reason struct {
+	Kind      Kind
+	Reference string
+	Memo      string
+}
+
+// The ledger entry, the entries are never changed or removed
+//
+// Ticker: the company of the stocks, empty if only solids are changed
+// Solids, Stocks: the changes
+// SolidBalance, StockBalance: the balances after the change (the stocks of the ticker company)
+type Entry struct {
+	Id           uint64    `json:"id"`
+	UserId       uint64    `json:"user_id"`
+	Kind         Kind      `json:"kind"`
+	Reference    string    `json:"reference"`
+	Memo         string    `json:"memo,omitempty"`
+	Ticker       string    `json:"ticker,omitempty"`
+	Solids       int64     `json:"solids"`
+	Stocks       int64     `json:"stocks"`
+	SolidBalance int64     `json:"solid_balance"`
+	StockBalance int64     `json:"stock_balance"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Sets the entry to string
+func (e Entry) String() string {
+	return fmt.Sprintf("entry %d of user %d: %s %s, solids %+d (%d), %s stocks %+d (%d)", e.Id, e.UserId, e.Kind, e.Reference, e.Solids, e.SolidBalance, e.Ticker, e.Stocks, e.StockBalance)
+}
+
+// The difference of the stored balance and the sum of the ledger entries
+//
+// Ticker: the company of the stocks, empty for solids
+type Drift struct {
+	UserId uint64 `json:"user_id"`
+	Ticker string `json:"ticker,omitempty"`
+	Stored int64  `json:"stored"`
+	Ledger int64  `json:"ledger"`
+}
+
+// Sets the drift to string
+func (d Drift) String() string {
+	balance := "solids"
+	if d.Ticker != "" {
+		balance = d.Ticker + " stocks"
+	}
+	return fmt.Sprintf("drift of user %d: %s stored %d, ledger %d (%+d)", d.UserId, balance, d.Stored, d.Ledger, d.Diff())
+}
+
+// Gets the stored balance minus the ledger balance
+func (d Drift) Diff() int64 {
+	return d.Stored - d.Ledger
+}
+
+// The balances of the user summed from the ledger entries
+type Sum struct {
+	Solids   int64
+	Holdings map[string]int64
+}
+
+// Sums the ledger entries by user
+func Sums(entries []Entry) map[uint64]Sum {
+	res := map[uint64]Sum{}
+	for _, e := range entries {
+		s := res[e.UserId]
+		if s.Holdings == nil {
+			s.Holdings = map[string]int64{}
+		}
+
+		s.Solids += e.Solids
+		if e.Ticker != "" && e.Stocks != 0 {
+			s.Holdings[e.Ticker] += e.Stocks
+		}
+		res[e.UserId] = s
+	}
+	return res
+}
+
+// Compares the balances of the user with the sum of the ledger entries (the solids first, then the stocks sorted by ticker)
+func Compare(usr user_cfg.User, sum Sum) []Drift {
+	res := []Drift{}
+
+	if usr.SolidBalance != sum.Solids {
+		res = append(res, Drift{UserId: usr.Id, Stored: usr.SolidBalance, Ledger: sum.Solids})
+	}
+
+	tickers := []string{}
+	for ticker := range usr.Holdings {
+		tickers = append(tickers, ticker)
+	}
+	for ticker := range sum.Holdings {
+		if _, ok := usr.Holdings[ticker]; !ok {
+			tickers = append(tickers, ticker)
+		}
+	}
+	slices.Sort(tickers)
+
+	for _, ticker := range tickers {
+		if stored, ledger := usr.Stocks(ticker), sum.Holdings[ticker]; stored != ledger {
+			res = append(res, Drift{UserId: usr.Id, Ticker: ticker, Stored: stored, Ledger: ledger})
+		}
+	}
+
+	return res
+}
+
+// Creates a new reason with a random reference
+func NewReason(kind Kind) (Reason, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return Reason{}, vanerrors.NewWrap(ErrorGeneratingReference, err, vanerrors.EmptyHandler)
+	}
+	return Reason{Kind: kind, Reference: hex.EncodeToString(buf)}, nil
+}
+
+// Creates the entry of the change of the user, the user has the balances after the change
+func NewEntry(usr user_cfg.User, reason Reason, ticker string, solids int64, stocks int64, now time.Time) Entry {
+	return Entry{
+		UserId:       usr.Id,
+		Kind:         reason.Kind,
+		Reference:    reason.Reference,
+		Memo:         reason.Memo,
+		Ticker:       ticker,
+		Solids:       solids,
+		Stocks:       stocks,
+		SolidBalance: usr.SolidBalance,
+		StockBalance: usr.Stocks(ticker),
+		CreatedAt:    now,
+	}
+}
+
+// Creates the entries of the balances the user had before the ledger (the solids first, then the holdings sorted by ticker)
+func Opening(usr user_cfg.User, now time.Time) []Entry {
+	res := []Entry{}
+	reason := Reason{Kind: OPENING}
+
+	if usr.SolidBalance != 0 {
+		res = append(res, NewEntry(usr, reason, "", usr.SolidBalance, 0, now))
+	}
+
+	tickers := make([]string, 0, len(usr.Holdings))
+	for ticker := range usr.Holdings {
+		tickers = append(tickers, ticker)
+	}
+	slices.Sort(tickers)
+
+	for _, ticker := range tickers {
+		if n := usr.Holdings[ticker]; n != 0 {
+			res = append(res, NewEntry(usr, reason, ticker, 0, n, now))
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,147 @@
+package order_cfg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGeneratingId = "error generating id" // error generating id
+	InvalidSide       = "invalid side"        // invalid side
+	InvalidPrice      = "invalid price"       // invalid price
+	InvalidAmount     = "invalid amount"      // invalid amount
+)
+
+// The order side
+type Side string
+
+// The sides
+const (
+	BUY  Side = "buy"  // buying stocks for solids
+	SELL Side = "sell" // selling stocks for solids
+)
+
+// The order status
+type Status string
+
+// The statuses
+const (
+	OPEN     Status = "open"     // the order rests in the book
+	FILLED   Status = "filled"   // the whole amount is traded
+	CANCELED Status = "canceled" // the order is canceled, the rest of the reserve is returned
+)
+
+// The limit order structure
+//
+// Ticker: the company of the stocks
+// Price: the limit price of one stock in solids
+// Amount: the amount of stocks
+// Filled: the amount of traded stocks
+// Reserved: the reserved funds of the open order (solids for buying, stocks for selling)
+type Order struct {
+	Id        string    `json:"id"`
+	UserId    uint64    `json:"user_id"`
+	Ticker    string    `json:"ticker"`
+	Side      Side      `json:"side"`
+	Price     int64     `json:"price"`
+	Amount    int64     `json:"amount"`
+	Filled    int64     `json:"filled"`
+	Reserved  int64     `json:"reserved"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// The trade of two orders
+type Fill struct {
+	Buy    string `json:"buy"`
+	Sell   string `json:"sell"`
+	Price  int64  `json:"price"`
+	Amount int64  `json:"amount"`
+}
+
+// Sets the order to string
+func (o Order) String() string {
+	return fmt.Sprintf("[%s] order %s of user %d: %s %d/%d %s stocks for %d solids", o.Status, o.Id, o.UserId, o.Side, o.Filled, o.Amount, o.Ticker, o.Price)
+}
+
+// Generates a random hex string with n bytes
+func random(n int) (string, error) {
+	buf := make([]byte, n)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorGeneratingId, err, vanerrors.EmptyHandler)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Creates a new open order with the reserve
+func NewOrder(userId uint64, ticker string, side Side, price int64, amount int64) (*Order, error) {
+	// Checks the order
+	if side != BUY && side != SELL {
+		return nil, vanerrors.NewSimple(InvalidSide, fmt.Sprintf("side %s is not allowed, allowed sides: %s, %s", side, BUY, SELL))
+	}
+	if price <= 0 {
+		return nil, vanerrors.NewSimple(InvalidPrice, "the price should be positive")
+	}
+	if amount <= 0 || amount > math.MaxInt64/price {
+		return nil, vanerrors.NewSimple(InvalidAmount, "the amount should be positive")
+	}
+
+	// Creates the id
+	id, err := random(8)
+	if err != nil {
+		return nil, err
+	}
+
+	// Gets the reserve
+	reserved := amount
+	if side == BUY {
+		reserved = amount * price
+	}
+
+	now := time.Now()
+	return &Order{
+		Id:        id,
+		UserId:    userId,
+		Ticker:    ticker,
+		Side:      side,
+		Price:     price,
+		Amount:    amount,
+		Filled:    0,
+		Reserved:  reserved,
+		Status:    OPEN,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Gets the not traded amount
+func (o Order) Rest() int64 {
+	return o.Amount - o.Filled
+}
+
+// Checks is the order open
+func (o Order) IsOpen() bool {
+	return o.Status == OPEN
+}
+
+// Checks does the order come before the other order of the same side in the book (price-time priority)
+func (o Order) Before(other Order) bool {
+	if o.Price != other.Price {
+		if o.Side == BUY {
+			return o.Price > other.Price
+		}
+		return o.Price < other.Price
+	}
+	if !o.CreatedAt.Equal(other.CreatedAt) {
+		return o.CreatedAt.Before(other.CreatedAt)
+	}
+	return o.Id < other.Id
+}
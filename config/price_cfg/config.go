@@ -0,0 +1,63 @@
+package price_cfg
+
+import (
+	"fmt"
+	"time"
+)
+
+// The stock price structure
+type Price struct {
+	Value     float64   `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Sets the price to string
+func (p Price) String() string {
+	return fmt.Sprintf("price %.4f, updated at %s", p.Value, p.UpdatedAt.Format(time.DateTime))
+}
+
+// The price change (a trade or a drift)
+//
+// Volume: the amount of traded stocks, positive for buying, negative for selling, zero for drift
+type Tick struct {
+	Time   time.Time `json:"time"`
+	Price  float64   `json:"price"`
+	Volume int64     `json:"volume"`
+}
+
+// The ohlc candle
+//
+// Volume: the amount of traded stocks (bought and sold)
+type Candle struct {
+	Start  time.Time `json:"start"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume int64     `json:"volume"`
+}
+
+// Adds the candle of the same interval that starts later
+func (c *Candle) Add(next Candle) {
+	c.High = max(c.High, next.High)
+	c.Low = min(c.Low, next.Low)
+	c.Close = next.Close
+	c.Volume += next.Volume
+}
+
+// Creates the candle of one tick
+func (t Tick) Candle(start time.Time) Candle {
+	volume := t.Volume
+	if volume < 0 {
+		volume = -volume
+	}
+
+	return Candle{
+		Start:  start,
+		Open:   t.Price,
+		High:   t.Price,
+		Low:    t.Price,
+		Close:  t.Price,
+		Volume: volume,
+	}
+}
@@ -0,0 +1,110 @@
+package session_cfg
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vandi37/StocksBack/pkg/hash"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGeneratingToken = "error generating token" // error generating token
+	InvalidRefreshToken  = "invalid refresh token"  // invalid refresh token
+)
+
+// The session structure
+//
+// The refresh token is "<id>.<secret>", only the hash of the secret is stored
+type Session struct {
+	Id        string    `json:"id"`
+	UserId    uint64    `json:"user_id"`
+	Token     string    `json:"token"`
+	IsRevoked bool      `json:"is_revoked"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sets the session to string
+func (s Session) String() string {
+	// Adding revoke prefix
+	var revoked string
+	if s.IsRevoked {
+		revoked = "[REVOKED] "
+	}
+
+	return fmt.Sprintf("%ssession %s of user %d, expires at %s", revoked, s.Id, s.UserId, s.ExpiresAt.Format(time.DateTime))
+}
+
+// Generates a random hex string with n bytes
+func random(n int) (string, error) {
+	buf := make([]byte, n)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorGeneratingToken, err, vanerrors.EmptyHandler)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Creates a new session and returns it with the refresh token
+func NewSession(userId uint64, ttl time.Duration) (*Session, string, error) {
+	// Creates the id
+	id, err := random(16)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Creates the session
+	now := time.Now()
+	session := &Session{
+		Id:        id,
+		UserId:    userId,
+		IsRevoked: false,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	// Creates the refresh token
+	token, err := session.NewToken(ttl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, token, nil
+}
+
+// Replaces the refresh token (rotation) and returns the new one
+func (s *Session) NewToken(ttl time.Duration) (string, error) {
+	secret, err := random(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.Token = hash.HashToken(secret)
+	s.ExpiresAt = time.Now().Add(ttl)
+
+	return s.Id + "." + secret, nil
+}
+
+// Splits the refresh token to the session id and secret
+func ParseToken(token string) (string, string, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", vanerrors.NewSimple(InvalidRefreshToken)
+	}
+	return id, secret, nil
+}
+
+// Compares the secret with the stored hash
+func (s Session) CheckToken(secret string) bool {
+	return hash.CompareToken(secret, s.Token)
+}
+
+// Checks that the session is not revoked and not expired
+func (s Session) IsActive() bool {
+	return !s.IsRevoked && time.Now().Before(s.ExpiresAt)
+}
@@ -2,16 +2,10 @@ package user_cfg
 
 import (
 	"fmt"
-	"regexp"
+	"maps"
 	"time"
 
 	"github.com/vandi37/StocksBack/pkg/hash"
-	"github.com/vandi37/vanerrors"
-)
-
-// The errors
-const (
-	InvalidPassword = "invalid password" // invalid password
 )
 
 // The user structure
@@ -20,10 +14,28 @@ type User struct {
 	Name         string    `json:"name"`
 	Password     string    `json:"password"`
 	SolidBalance int64     `json:"solid_balance"`
-	StockBalance int64     `json:"stock_balance"`
+	Holdings     Holdings  `json:"holdings"`
 	IsBlocked    bool      `json:"is_blocked"`
 	LastFarming  time.Time `json:"last_farming"`
 	CreatedAt    time.Time `json:"created_at"`
+	Role         Role      `json:"role"`
+	TwoFactor    TwoFactor `json:"two_factor"`
+}
+
+// The stocks of the user by the company ticker
+type Holdings map[string]int64
+
+// The two factor authentication data
+//
+// Secret: the encrypted totp secret (set on enrollment)
+// Enabled: is the enrollment confirmed
+// RecoveryCodes: the hashes of not used recovery codes
+// LastStep: the time step of the last accepted code, the codes of it and the steps before are refused
+type TwoFactor struct {
+	Secret        string   `json:"secret"`
+	Enabled       bool     `json:"enabled"`
+	RecoveryCodes []string `json:"recovery_codes"`
+	LastStep      uint64   `json:"last_step"`
 }
 
 // Sets the user to string
@@ -34,16 +46,52 @@ func (u User) String() string {
 		blocked = "[BLOCKED] "
 	}
 
+	// Adding role prefix
+	var role string
+	if u.GetRole() != USER {
+		role = string(u.GetRole()) + " "
+	}
+
 	// Returning the user data
-	return fmt.Sprintf("%suser %d (%s). balance: solids - %d, stocks - %d", blocked, u.Id, u.Name, u.SolidBalance, u.StockBalance)
+	return fmt.Sprintf("%s%suser %d (%s). balance: solids - %d, stocks - %d", blocked, role, u.Id, u.Name, u.SolidBalance, u.TotalStocks())
+}
+
+// Gets the amount of stocks of the company
+func (u User) Stocks(ticker string) int64 {
+	return u.Holdings[ticker]
+}
+
+// Gets the total amount of stocks of all companies
+func (u User) TotalStocks() int64 {
+	var res int64
+	for _, n := range u.Holdings {
+		res += n
+	}
+	return res
+}
+
+// Adds stocks of the company, the holdings are copied so the copies of the user aren't changed
+func (u *User) AddStocks(ticker string, num int64) {
+	h := maps.Clone(u.Holdings)
+	if h == nil {
+		h = Holdings{}
+	}
+
+	h[ticker] += num
+	if h[ticker] == 0 {
+		delete(h, ticker)
+	}
+
+	u.Holdings = h
 }
 
 // Creates a new user
 func NewUser(name string, password string, id uint64) (*User, error) {
 
 	// Checks the password
-	if ok := validPassword(password); !ok {
-		return nil, vanerrors.NewSimple(InvalidPassword, fmt.Sprintf("password %s has not allowed symbols", password))
+	err := Policy.Check(password)
+	if err != nil {
+		return nil, err
 	}
 
 	// Hash password
@@ -57,17 +105,19 @@ func NewUser(name string, password string, id uint64) (*User, error) {
 		Name:         name,
 		Password:     hashed_password,
 		SolidBalance: 0,
-		StockBalance: 0,
+		Holdings:     Holdings{},
 		IsBlocked:    false,
 		CreatedAt:    time.Now(),
+		Role:         USER,
 	}, nil
 }
 
 // Updates the password
 func (u *User) NewPassword(password string) error {
 	// Checks the password
-	if ok := validPassword(password); !ok {
-		return vanerrors.NewSimple(InvalidPassword, fmt.Sprintf("password %s has not allowed symbols", password))
+	err := Policy.Check(password)
+	if err != nil {
+		return err
 	}
 
 	// Hash password
@@ -82,17 +132,27 @@ func (u *User) NewPassword(password string) error {
 	return nil
 }
 
-// valid password
-func validPassword(password string) bool {
-	matched, err := regexp.MatchString(`^[a-zA-Z0-9!#$*_&-]*$`, password)
-	if err != nil {
-		return false
-	}
-	return matched
-}
-
 // comperes password
 func (u User) CheckPassword(password string) bool {
 	ok, err := hash.CompareHash(password, u.Password)
 	return ok && err == nil
 }
+
+// Checks does the password hash need to be upgraded (legacy hash or old parameters)
+func (u User) NeedsRehash() bool {
+	return hash.NeedsRehash(u.Password)
+}
+
+// Hashes the password again without checking it (the password is already checked)
+func (u *User) Rehash(password string) error {
+	// Hash password
+	hashed_password, err := hash.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Updating the password
+	u.Password = hashed_password
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package user_cfg
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	PasswordTooShort       = "password is too short"            // password is too short
+	PasswordTooLong        = "password is too long"             // password is too long
+	PasswordNoLower        = "password has no lowercase letter" // password has no lowercase letter
+	PasswordNoUpper        = "password has no uppercase letter" // password has no uppercase letter
+	PasswordNoDigit        = "password has no digit"            // password has no digit
+	PasswordNoSymbol       = "password has no symbol"           // password has no symbol
+	PasswordInvalidSymbols = "password has not allowed symbols" // password has not allowed symbols
+	PasswordIsCommon       = "password is too common"           // password is too common
+)
+
+// The common passwords (the deny-list)
+//
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// The deny-list set
+var common = func() map[string]struct{} {
+	res := map[string]struct{}{}
+	for _, p := range strings.Split(commonPasswords, "\n") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			res[strings.ToLower(p)] = struct{}{}
+		}
+	}
+	return res
+}()
+
+// The password policy
+//
+// MinLength, MaxLength: the allowed length in characters (the minimum is at least 1)
+// Lower, Upper, Digit, Symbol: the required character classes
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Lower     bool
+	Upper     bool
+	Digit     bool
+	Symbol    bool
+}
+
+// The password policy of new passwords, it is set by the application
+var Policy = PasswordPolicy{
+	MinLength: 8,
+	MaxLength: 128,
+	Lower:     true,
+	Upper:     true,
+	Digit:     true,
+	Symbol:    true,
+}
+
+// Checks the password, returns the error of the first failed rule
+//
+// The error never contains the password
+func (p PasswordPolicy) Check(password string) error {
+	// Checks the length
+	length := utf8.RuneCountInString(password)
+	if length < max(p.MinLength, 1) {
+		return vanerrors.NewSimple(PasswordTooShort, fmt.Sprintf("the minimum length is %d", max(p.MinLength, 1)))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return vanerrors.NewSimple(PasswordTooLong, fmt.Sprintf("the maximum length is %d", p.MaxLength))
+	}
+
+	// Gets the character classes
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case r == utf8.RuneError || unicode.IsControl(r) || unicode.IsSpace(r):
+			return vanerrors.NewSimple(PasswordInvalidSymbols, "spaces and control characters are not allowed")
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	// Checks the character classes
+	if p.Lower && !lower {
+		return vanerrors.NewSimple(PasswordNoLower)
+	}
+	if p.Upper && !upper {
+		return vanerrors.NewSimple(PasswordNoUpper)
+	}
+	if p.Digit && !digit {
+		return vanerrors.NewSimple(PasswordNoDigit)
+	}
+	if p.Symbol && !symbol {
+		return vanerrors.NewSimple(PasswordNoSymbol)
+	}
+
+	// Checks the deny-list
+	if _, ok := common[strings.ToLower(password)]; ok {
+		return vanerrors.NewSimple(PasswordIsCommon)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package user_cfg
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	InvalidRole = "invalid role" // invalid role
+)
+
+// The user role
+type Role string
+
+// The roles
+const (
+	USER      Role = "user"
+	MODERATOR Role = "moderator"
+	ADMIN     Role = "admin"
+)
+
+// The role ranks, a user can act only on users with a lower rank
+var RoleRank = map[Role]int{
+	USER:      0,
+	MODERATOR: 1,
+	ADMIN:     2,
+}
+
+// The permission
+type Permission string
+
+// The permissions
+const (
+	BLOCK          Permission = "block"          // blocking and unblocking users
+	SET_ROLE       Permission = "set_role"       // promoting and demoting users
+	ADJUST_BALANCE Permission = "adjust_balance" // changing balances of users
+	MANAGE_MARKET  Permission = "manage_market"  // creating companies
+	RECONCILE      Permission = "reconcile"      // checking and correcting balances against the ledger
+)
+
+// The permission matrix
+var Permissions = map[Role][]Permission{
+	USER:      {},
+	MODERATOR: {BLOCK},
+	ADMIN:     {BLOCK, SET_ROLE, ADJUST_BALANCE, MANAGE_MARKET, RECONCILE},
+}
+
+// Checks the role
+func (r Role) Valid() error {
+	if _, ok := RoleRank[r]; !ok {
+		return vanerrors.NewSimple(InvalidRole, fmt.Sprintf("role %s doesn't exist", r))
+	}
+	return nil
+}
+
+// Gets the user role (users without role are simple users)
+func (u User) GetRole() Role {
+	if u.Role == "" {
+		return USER
+	}
+	return u.Role
+}
+
+// Checks the permission of the user
+func (u User) Can(permission Permission) bool {
+	return slices.Contains(Permissions[u.GetRole()], permission)
+}
+
+// Checks that the user has a higher rank than the other user
+func (u User) Outranks(other User) bool {
+	return RoleRank[u.GetRole()] > RoleRank[other.GetRole()]
+}
@@ -6,6 +6,6 @@ type Key struct {
 	user_service.SignInKey
 }
 
-type Authorization struct {
-	user_service.SignInUser
+type ApiKey struct {
+	user_service.SignInApiKey
 }
@@ -1,15 +1,52 @@
 package requests
 
-import "github.com/vandi37/StocksBack/pkg/user_service"
+import (
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/user_service"
+)
 
 type SignUp struct {
 	user_service.SignUpUser
 }
 
+type SignIn struct {
+	user_service.SignInUser
+}
+
+type Refresh struct {
+	user_service.RefreshToken
+}
+
+type SignOut struct {
+	user_service.RefreshToken
+}
+
+type SignOutAll struct{}
+
 type Farm struct{}
 
 type BuyStocks struct {
-	Num int64 `json:"num"`
+	Ticker string `json:"ticker"`
+	Num    int64  `json:"num"`
+}
+
+type SellStocks struct {
+	Ticker string `json:"ticker"`
+	Num    int64  `json:"num"`
+}
+
+type PlaceOrder struct {
+	user_service.NewOrder
+}
+
+type CancelOrder struct {
+	Id string `json:"id"`
+}
+
+type Orders struct{}
+
+type Transfer struct {
+	user_service.NewTransfer
 }
 
 type UpdateName struct {
@@ -20,9 +57,49 @@ type UpdatePassword struct {
 	Password string `json:"password"`
 }
 
-type Block struct{}
+type Block struct {
+	Id uint64 `json:"id"`
+}
+
+type Unblock struct {
+	Id uint64 `json:"id"`
+}
+
+type SetRole struct {
+	Id   uint64        `json:"id"`
+	Role user_cfg.Role `json:"role"`
+}
+
+type Adjust struct {
+	Id     uint64 `json:"id"`
+	Ticker string `json:"ticker"`
+	Solids int64  `json:"solids"`
+	Stocks int64  `json:"stocks"`
+}
+
+type CreateCompany struct {
+	user_service.NewCompany
+}
+
+type CreateKey struct {
+	user_service.NewKey
+}
+
+type Keys struct{}
+
+type RevokeKey struct {
+	Id string `json:"id"`
+}
 
-type Unblock struct{}
+type EnrollTwoFactor struct{}
+
+type ConfirmTwoFactor struct {
+	user_service.TwoFactorCode
+}
+
+type DisableTwoFactor struct {
+	user_service.TwoFactorCode
+}
 
 type Get struct {
 	Id uint64 `json:"id"`
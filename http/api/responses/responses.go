@@ -2,42 +2,138 @@ package responses
 
 import (
 	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/orderbook"
 )
 
 // The response content types
 const (
-	SignUpType         = "signup"
-	FarmType           = "farm"
-	BuyStocksType      = "buy-stocks"
-	UpdateNameType     = "update-name"
-	UpdatePasswordType = "update-password"
-	BlockType          = "block"
-	UnblockType        = "unblock"
-	GetType            = "get"
-	ErrorType          = "error"
+	SignUpType           = "signup"
+	SignInType           = "signin"
+	RefreshType          = "refresh"
+	SignOutType          = "signout"
+	SignOutAllType       = "signout-all"
+	FarmType             = "farm"
+	BuyStocksType        = "buy-stocks"
+	SellStocksType       = "sell-stocks"
+	TransferType         = "transfer"
+	HistoryType          = "history"
+	PlaceOrderType       = "place-order"
+	CancelOrderType      = "cancel-order"
+	OrdersType           = "orders"
+	DepthType            = "depth"
+	UpdateNameType       = "update-name"
+	UpdatePasswordType   = "update-password"
+	BlockType            = "block"
+	UnblockType          = "unblock"
+	SetRoleType          = "set-role"
+	AdjustType           = "adjust"
+	ReconcileType        = "reconcile"
+	GetType              = "get"
+	PriceType            = "price"
+	PriceHistoryType     = "price-history"
+	CompaniesType        = "companies"
+	CreateCompanyType    = "create-company"
+	CreateKeyType        = "create-key"
+	KeysType             = "keys"
+	RevokeKeyType        = "revoke-key"
+	EnrollTwoFactorType  = "enroll-two-factor"
+	ConfirmTwoFactorType = "confirm-two-factor"
+	DisableTwoFactorType = "disable-two-factor"
+	ErrorType            = "error"
 )
 
 type User struct {
-	Id           uint64    `json:"id"`
-	Name         string    `json:"name"`
-	SolidBalance int64     `json:"solid_balance"`
-	StockBalance int64     `json:"stock_balance"`
-	IsBlocked    bool      `json:"is_blocked"`
-	LastFarming  time.Time `json:"last_farming"`
-	CreatedAt    time.Time `json:"created_at"`
+	Id           uint64            `json:"id"`
+	Name         string            `json:"name"`
+	SolidBalance int64             `json:"solid_balance"`
+	StockBalance int64             `json:"stock_balance"` // the total amount of stocks of all companies
+	Holdings     user_cfg.Holdings `json:"holdings"`
+	IsBlocked    bool              `json:"is_blocked"`
+	LastFarming  time.Time         `json:"last_farming"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Role         user_cfg.Role     `json:"role"`
+	TwoFactor    bool              `json:"two_factor"`
 }
 
 type SignUp struct {
 	User User `json:"user"`
 }
 
+type SignIn struct {
+	User             User      `json:"user"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type Refresh struct {
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type SignOut struct {
+	Session string `json:"session"`
+}
+
+type SignOutAll struct {
+	Revoked int64 `json:"revoked"`
+}
+
 type Farm struct {
 	User   User  `json:"user"`
 	Amount int64 `json:"amount"`
 }
 
 type BuyStocks struct {
-	User User `json:"user"`
+	User User  `json:"user"`
+	Cost int64 `json:"cost"`
+}
+
+type SellStocks struct {
+	User   User  `json:"user"`
+	Amount int64 `json:"amount"`
+}
+
+type PlaceOrder struct {
+	Order order_cfg.Order  `json:"order"`
+	Fills []order_cfg.Fill `json:"fills"`
+	User  User             `json:"user"`
+}
+
+type CancelOrder struct {
+	Order order_cfg.Order `json:"order"`
+	User  User            `json:"user"`
+}
+
+type Orders struct {
+	Orders []order_cfg.Order `json:"orders"`
+}
+
+type Depth struct {
+	Bids []orderbook.Level `json:"bids"`
+	Asks []orderbook.Level `json:"asks"`
+}
+
+type Transfer struct {
+	User   User   `json:"user"`
+	To     uint64 `json:"to"`
+	Amount int64  `json:"amount"`
+	Memo   string `json:"memo,omitempty"`
+}
+
+type History struct {
+	Entries []ledger_cfg.Entry `json:"entries"`
+	Next    uint64             `json:"next"` // the before of the next page, zero if it is the last page
 }
 
 type UpdateName struct {
@@ -56,6 +152,77 @@ type Unblock struct {
 	User User `json:"user"`
 }
 
+type SetRole struct {
+	User User `json:"user"`
+}
+
+type Adjust struct {
+	User User `json:"user"`
+}
+
+type Reconcile struct {
+	Drifts    []ledger_cfg.Drift `json:"drifts"`
+	Corrected bool               `json:"corrected"`
+}
+
 type Get struct {
 	User User `json:"user"`
 }
+
+type Price struct {
+	Ticker    string    `json:"ticker"`
+	Price     float64   `json:"price"`
+	Buy       int64     `json:"buy"`
+	Sell      int64     `json:"sell"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PriceHistory struct {
+	Ticker   string             `json:"ticker"`
+	Interval string             `json:"interval"`
+	Candles  []price_cfg.Candle `json:"candles"`
+}
+
+type Companies struct {
+	Companies []company_cfg.Company `json:"companies"`
+}
+
+type CreateCompany struct {
+	Company company_cfg.Company `json:"company"`
+}
+
+type Key struct {
+	Id        string          `json:"id"`
+	Name      string          `json:"name"`
+	Scopes    []key_cfg.Scope `json:"scopes"`
+	IsRevoked bool            `json:"is_revoked"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type CreateKey struct {
+	Key    Key    `json:"key"`
+	Secret string `json:"secret"`
+}
+
+type Keys struct {
+	Keys []Key `json:"keys"`
+}
+
+type RevokeKey struct {
+	Key Key `json:"key"`
+}
+
+type EnrollTwoFactor struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type ConfirmTwoFactor struct {
+	User          User     `json:"user"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type DisableTwoFactor struct {
+	User User `json:"user"`
+}
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/vandi37/StocksBack/config/key_cfg"
 	"github.com/vandi37/StocksBack/config/user_cfg"
 	"github.com/vandi37/StocksBack/http/api"
 	"github.com/vandi37/StocksBack/http/api/input/requests"
@@ -14,21 +18,37 @@ import (
 
 // The errors
 const (
-	WrongMethod = "wrong method"
-	InvalidBody = "invalid body"
-	NotFound    = "not found"
+	WrongMethod  = "wrong method"
+	InvalidBody  = "invalid body"
+	InvalidQuery = "invalid query"
+	NotFound     = "not found"
 )
 
+// Key to response key
+func ToResponseKey(key key_cfg.Key) responses.Key {
+	return responses.Key{
+		Id:        key.Id,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		IsRevoked: key.IsRevoked,
+		ExpiresAt: key.ExpiresAt,
+		CreatedAt: key.CreatedAt,
+	}
+}
+
 // User to response user
 func ToResponseUser(usr user_cfg.User) responses.User {
 	return responses.User{
 		Id:           usr.Id,
 		Name:         usr.Name,
 		SolidBalance: usr.SolidBalance,
-		StockBalance: usr.StockBalance,
+		StockBalance: usr.TotalStocks(),
+		Holdings:     usr.Holdings,
 		IsBlocked:    usr.IsBlocked,
 		LastFarming:  usr.LastFarming,
 		CreatedAt:    usr.CreatedAt,
+		Role:         usr.GetRole(),
+		TwoFactor:    usr.TwoFactor.Enabled,
 	}
 }
 
@@ -54,7 +74,7 @@ func (h *Handler) SignUpHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Signs up
-	usr, err := req.SignUp(h.db)
+	usr, err := req.SignUp(r.Context(), h.db)
 
 	if err != nil {
 
@@ -82,12 +102,45 @@ func (h *Handler) SignUpHandler(w http.ResponseWriter, r *http.Request) {
 	h.logger.Printf("Signup: %v", *usr)
 }
 
-// Farms
-func (h *Handler) FarmHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
-	// Farming
-	amount, usr, err := user_service.Farm(u.Id, h.db)
+// It signs in and issues an access token
+func (h *Handler) SignInHandler(w http.ResponseWriter, r *http.Request) {
+	// Gets body
+	req := requests.SignIn{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Reserves the sign in
+	if !h.reserveLimit(w, r, &req.Id) {
+		return
+	}
+	defer h.releaseLimit(r, &req.Id)
+
+	// Signs in
+	ok, usr, err := req.SignIn(r.Context(), h.db)
 
 	if err != nil {
+		// Counts wrong codes and unknown users as failed sign ins
+		switch vanerrors.GetName(err) {
+		case user_service.WrongCode:
+			h.failLimit(r, &req.Id)
+		case user_service.ErrorSelectingUser:
+			h.failLimit(r, nil)
+		}
+
 		// Writes data
 		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
 		if err != nil {
@@ -95,8 +148,65 @@ func (h *Handler) FarmHandler(w http.ResponseWriter, r *http.Request, u user_cfg
 			return
 		}
 
-		h.logger.Warnf("%v unable to farm, reason: %v", u, err)
+		h.logger.Warnf("unable to sign in, reason: %v", err)
+		return
+	}
+
+	if !ok {
+		h.failLimit(r, &req.Id)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusUnauthorized, vanerrors.NewSimple(WrongPassword))
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("unable to sign in as user %d, reason: %s", req.Id, WrongPassword)
+		return
+	}
+
+	h.resetLimit(usr.Id)
+
+	// Checks block
+	if usr.IsBlocked {
+		err = api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, "user is blocked"))
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+		return
+	}
+
+	// Starts the session
+	session, refresh, err := user_service.StartSession(r.Context(), usr.Id, h.db)
+
+	if err != nil {
+
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("unable to start session for %v, reason: %v", *usr, err)
+		return
+	}
+
+	// Issues the token
+	token, claims, err := h.tokens.Issue(usr.Id, session.Id)
 
+	if err != nil {
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusInternalServerError, err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("unable to issue token for %v, reason: %v", *usr, err)
 		return
 	}
 
@@ -104,19 +214,25 @@ func (h *Handler) FarmHandler(w http.ResponseWriter, r *http.Request, u user_cfg
 	resp := ToResponseUser(*usr)
 
 	// Sends data
-	err = api.SendOkResponse(w, responses.Farm{User: resp, Amount: amount}, responses.FarmType)
+	err = api.SendOkResponse(w, responses.SignIn{
+		User:             resp,
+		Token:            token,
+		ExpiresAt:        time.Unix(claims.ExpiresAt, 0),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, responses.SignInType)
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
 
-	h.logger.Printf("farm (%d) : %v", amount, *usr)
+	h.logger.Printf("Signin: %v", *usr)
 }
 
-// Buy stocks
-func (h *Handler) BuyStocksHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+// It rotates the refresh token and issues a new access token
+func (h *Handler) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	// Gets body
-	var req requests.BuyStocks
+	req := requests.Refresh{}
 	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
@@ -134,10 +250,11 @@ func (h *Handler) BuyStocksHandler(w http.ResponseWriter, r *http.Request, u use
 		return
 	}
 
-	// Buying stocks
-	usr, err := user_service.BuyStocks(u.Id, req.Num, h.db)
+	// Refreshes
+	session, refresh, err := req.Refresh(r.Context(), h.db)
 
 	if err != nil {
+
 		// Writes data
 		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
 		if err != nil {
@@ -145,30 +262,70 @@ func (h *Handler) BuyStocksHandler(w http.ResponseWriter, r *http.Request, u use
 			return
 		}
 
-		h.logger.Warnf("%v unable to buy stocks, reason: %v", u, err)
+		h.logger.Warnf("unable to refresh, reason: %v", err)
+		return
+	}
+
+	// Checks the user
+	usr, err := user_service.Get(r.Context(), session.UserId, h.db)
+
+	if err != nil {
+
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
 
+		h.logger.Warnf("unable to refresh %v, reason: %v", *session, err)
 		return
 	}
 
-	// Converts user
-	resp := ToResponseUser(*usr)
+	if usr.IsBlocked {
+		err = api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, "user is blocked"))
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+		return
+	}
+
+	// Issues the token
+	token, claims, err := h.tokens.Issue(usr.Id, session.Id)
+
+	if err != nil {
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusInternalServerError, err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("unable to issue token for %v, reason: %v", *usr, err)
+		return
+	}
 
 	// Sends data
-	err = api.SendOkResponse(w, responses.BuyStocks{
-		User: resp,
-	}, "buy-stocks")
+	err = api.SendOkResponse(w, responses.Refresh{
+		Token:            token,
+		ExpiresAt:        time.Unix(claims.ExpiresAt, 0),
+		RefreshToken:     refresh,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, responses.RefreshType)
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
 
-	h.logger.Printf("buy stocks (%d) : %v", req.Num, *usr)
+	h.logger.Printf("refresh: %v", *session)
 }
 
-// Update name
-func (h *Handler) UpdateNameHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+// It revokes the session of the refresh token
+func (h *Handler) SignOutHandler(w http.ResponseWriter, r *http.Request) {
 	// Gets body
-	var req requests.UpdateName
+	req := requests.SignOut{}
 	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
@@ -186,9 +343,11 @@ func (h *Handler) UpdateNameHandler(w http.ResponseWriter, r *http.Request, u us
 		return
 	}
 
-	usr, err := user_service.UpdateName(u.Id, req.Name, h.db)
+	// Signs out
+	session, err := req.SignOut(r.Context(), h.db)
 
 	if err != nil {
+
 		// Writes data
 		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
 		if err != nil {
@@ -196,7 +355,62 @@ func (h *Handler) UpdateNameHandler(w http.ResponseWriter, r *http.Request, u us
 			return
 		}
 
-		h.logger.Warnf("%v unable to update name, reason: %v", u, err)
+		h.logger.Warnf("unable to sign out, reason: %v", err)
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.SignOut{Session: session.Id}, responses.SignOutType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("signout: %v", *session)
+}
+
+// It revokes all sessions of the user
+func (h *Handler) SignOutAllHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Signs out
+	n, err := user_service.SignOutAll(r.Context(), u.Id, h.db)
+
+	if err != nil {
+
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to sign out everywhere, reason: %v", u, err)
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.SignOutAll{Revoked: n}, responses.SignOutAllType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("signout all (%d) : %v", n, u)
+}
+
+// Farms
+func (h *Handler) FarmHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Farming
+	amount, usr, err := user_service.Farm(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to farm, reason: %v", u, err)
 
 		return
 	}
@@ -205,20 +419,19 @@ func (h *Handler) UpdateNameHandler(w http.ResponseWriter, r *http.Request, u us
 	resp := ToResponseUser(*usr)
 
 	// Sends data
-	err = api.SendOkResponse(w, responses.UpdateName{User: resp}, responses.UpdateNameType)
+	err = api.SendOkResponse(w, responses.Farm{User: resp, Amount: amount}, responses.FarmType)
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
 
-	h.logger.Printf("update name (was %s) : %v", u.Name, *usr)
-
+	h.logger.Printf("farm (%d) : %v", amount, *usr)
 }
 
-// Update password
-func (h *Handler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+// Buy stocks
+func (h *Handler) BuyStocksHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
 	// Gets body
-	var req requests.UpdatePassword
+	var req requests.BuyStocks
 	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
@@ -236,7 +449,8 @@ func (h *Handler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	usr, err := user_service.UpdatePassword(u.Id, req.Password, h.db)
+	// Buying stocks
+	cost, usr, err := user_service.BuyStocks(r.Context(), u.Id, req.Ticker, req.Num, h.db)
 
 	if err != nil {
 		// Writes data
@@ -246,7 +460,7 @@ func (h *Handler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request,
 			return
 		}
 
-		h.logger.Warnf("%v unable to update password, reason: %v", u, err)
+		h.logger.Warnf("%v unable to buy stocks, reason: %v", u, err)
 
 		return
 	}
@@ -255,22 +469,26 @@ func (h *Handler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request,
 	resp := ToResponseUser(*usr)
 
 	// Sends data
-	err = api.SendOkResponse(w, responses.UpdatePassword{User: resp}, responses.UpdatePasswordType)
+	err = api.SendOkResponse(w, responses.BuyStocks{
+		User: resp,
+		Cost: cost,
+	}, "buy-stocks")
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
 
-	h.logger.Printf("update password: %v", *usr)
+	h.logger.Printf("buy stocks (%d %s) for %d solids : %v", req.Num, req.Ticker, cost, *usr)
 }
 
-// Block user
-func (h *Handler) BlockHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+// Sells stocks
+func (h *Handler) SellStocksHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
 	// Gets body
-	var req requests.Block
+	var req requests.SellStocks
 	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
+
 		// Creates an error
 		resp := vanerrors.NewSimple(InvalidBody)
 
@@ -284,7 +502,8 @@ func (h *Handler) BlockHandler(w http.ResponseWriter, r *http.Request, u user_cf
 		return
 	}
 
-	usr, err := user_service.Block(u.Id, h.db)
+	// Selling stocks
+	amount, usr, err := user_service.SellStocks(r.Context(), u.Id, req.Ticker, req.Num, h.db)
 
 	if err != nil {
 		// Writes data
@@ -294,28 +513,28 @@ func (h *Handler) BlockHandler(w http.ResponseWriter, r *http.Request, u user_cf
 			return
 		}
 
-		h.logger.Warnf("%v unable to block, reason: %v", u, err)
+		h.logger.Warnf("%v unable to sell stocks, reason: %v", u, err)
 
 		return
 	}
 
-	// Converts user
-	resp := ToResponseUser(*usr)
-
 	// Sends data
-	err = api.SendOkResponse(w, responses.Block{User: resp}, responses.BlockType)
+	err = api.SendOkResponse(w, responses.SellStocks{
+		User:   ToResponseUser(*usr),
+		Amount: amount,
+	}, responses.SellStocksType)
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
 
-	h.logger.Printf("block: %v", *usr)
+	h.logger.Printf("sell stocks (%d %s) for %d solids : %v", req.Num, req.Ticker, amount, *usr)
 }
 
-// Unlock user
-func (h *Handler) UnblockHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+// Places a limit order
+func (h *Handler) PlaceOrderHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
 	// Gets body
-	var req requests.Unblock
+	var req requests.PlaceOrder
 	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
@@ -329,10 +548,12 @@ func (h *Handler) UnblockHandler(w http.ResponseWriter, r *http.Request, u user_
 			h.logger.Errorln(err)
 			return
 		}
+
 		return
 	}
 
-	usr, err := user_service.Unblock(u.Id, h.db)
+	// Places the order
+	order, fills, usr, err := req.Place(r.Context(), u.Id, h.db)
 
 	if err != nil {
 		// Writes data
@@ -342,28 +563,29 @@ func (h *Handler) UnblockHandler(w http.ResponseWriter, r *http.Request, u user_
 			return
 		}
 
-		h.logger.Warnf("%v unable to unblock, reason: %v", u, err)
+		h.logger.Warnf("%v unable to place order, reason: %v", u, err)
 
 		return
 	}
 
-	// Converts user
-	resp := ToResponseUser(*usr)
-
 	// Sends data
-	err = api.SendOkResponse(w, responses.Unblock{User: resp}, responses.UnblockType)
+	err = api.SendOkResponse(w, responses.PlaceOrder{
+		Order: *order,
+		Fills: fills,
+		User:  ToResponseUser(*usr),
+	}, responses.PlaceOrderType)
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
 
-	h.logger.Printf("unblock: %v", *usr)
+	h.logger.Printf("place %v, fills: %v", *order, fills)
 }
 
-// Get's user
-func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+// Cancels an order
+func (h *Handler) CancelOrderHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
 	// Gets body
-	var req requests.Get
+	var req requests.CancelOrder
 	err := json.NewDecoder(r.Body).Decode(&req)
 
 	if err != nil {
@@ -381,7 +603,8 @@ func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usr, err := user_service.Get(req.Id, h.db)
+	// Cancels the order
+	order, usr, err := user_service.CancelOrder(r.Context(), u.Id, req.Id, h.db)
 
 	if err != nil {
 		// Writes data
@@ -391,20 +614,994 @@ func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		h.logger.Warnf("user %d not got, reason:", req.Id, err)
+		h.logger.Warnf("%v unable to cancel order %s, reason: %v", u, req.Id, err)
 
 		return
 	}
 
-	// Converts user
-	resp := ToResponseUser(*usr)
+	// Sends data
+	err = api.SendOkResponse(w, responses.CancelOrder{Order: *order, User: ToResponseUser(*usr)}, responses.CancelOrderType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("cancel %v", *order)
+}
+
+// Gets the orders of the user
+func (h *Handler) OrdersHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	orders, err := user_service.GetOrders(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to get orders, reason: %v", u, err)
+
+		return
+	}
 
 	// Sends data
-	err = api.SendOkResponse(w, responses.Get{User: resp}, responses.GetType)
+	err = api.SendOkResponse(w, responses.Orders{Orders: orders}, responses.OrdersType)
 	if err != nil {
 		h.logger.Errorln(err)
 		return
 	}
+}
 
-	h.logger.Printf("sended user: %v", *usr)
+// Gets the order book depth of the company
+func (h *Handler) DepthHandler(w http.ResponseWriter, r *http.Request) {
+	bids, asks, err := user_service.Depth(r.Context(), r.URL.Query().Get("ticker"), h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("depth not got, reason: %v", err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Depth{Bids: bids, Asks: asks}, responses.DepthType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+}
+
+// Transfers solids to other user
+func (h *Handler) TransferHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.Transfer
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Transfers solids
+	usr, to, err := req.Transfer(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to transfer %d solids to user %d, reason: %v", u, req.Amount, req.To, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Transfer{
+		User:   ToResponseUser(*usr),
+		To:     to.Id,
+		Amount: req.Amount,
+		Memo:   req.Memo,
+	}, responses.TransferType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("transfer (%d) : %v -> %v, memo: %q", req.Amount, *usr, *to, req.Memo)
+}
+
+// Gets the ledger history of the user
+func (h *Handler) HistoryHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets query parameters
+	params := r.URL.Query()
+
+	var before uint64
+	var limit int
+	var beforeErr, limitErr error
+	if s := params.Get("before"); s != "" {
+		before, beforeErr = strconv.ParseUint(s, 10, 64)
+	}
+	if s := params.Get("limit"); s != "" {
+		limit, limitErr = strconv.Atoi(s)
+	}
+
+	if beforeErr != nil || limitErr != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidQuery, "before and limit should be numbers")
+
+		// Writes data
+		err := api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Gets the history
+	entries, next, err := user_service.History(r.Context(), u.Id, before, limit, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to get history, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.History{Entries: entries, Next: next}, responses.HistoryType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+}
+
+// Update name
+func (h *Handler) UpdateNameHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.UpdateName
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	usr, err := user_service.UpdateName(r.Context(), u.Id, req.Name, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to update name, reason: %v", u, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.UpdateName{User: resp}, responses.UpdateNameType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("update name (was %s) : %v", u.Name, *usr)
+
+}
+
+// Update password
+func (h *Handler) UpdatePasswordHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.UpdatePassword
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	usr, err := user_service.UpdatePassword(r.Context(), u.Id, req.Password, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to update password, reason: %v", u, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.UpdatePassword{User: resp}, responses.UpdatePasswordType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("update password: %v", *usr)
+}
+
+// Block user
+func (h *Handler) BlockHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.Block
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Checks the rank
+	if !h.checkRank(w, r, u, req.Id) {
+		return
+	}
+
+	usr, err := user_service.Block(r.Context(), req.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to block user %d, reason: %v", u, req.Id, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Block{User: resp}, responses.BlockType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("block (by %v): %v", u, *usr)
+}
+
+// Unlock user
+func (h *Handler) UnblockHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.Unblock
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+		return
+	}
+
+	// Checks the rank
+	if !h.checkRank(w, r, u, req.Id) {
+		return
+	}
+
+	usr, err := user_service.Unblock(r.Context(), req.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to unblock user %d, reason: %v", u, req.Id, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Unblock{User: resp}, responses.UnblockType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("unblock (by %v): %v", u, *usr)
+}
+
+// Sets user role
+func (h *Handler) SetRoleHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.SetRole
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+		return
+	}
+
+	// Checks the rank, the role can't be higher than the own role
+	if !h.checkRank(w, r, u, req.Id) {
+		return
+	}
+	if !IsSuper(r) && user_cfg.RoleRank[req.Role] > user_cfg.RoleRank[u.GetRole()] {
+		err = api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, fmt.Sprintf("%s can't give role %s", u.GetRole(), req.Role)))
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+		return
+	}
+
+	usr, err := user_service.SetRole(r.Context(), req.Id, req.Role, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to set role of user %d, reason: %v", u, req.Id, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.SetRole{User: resp}, responses.SetRoleType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("set role (by %v): %v", u, *usr)
+}
+
+// Adjusts user balances
+func (h *Handler) AdjustHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.Adjust
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+		return
+	}
+
+	// Checks the rank
+	if !h.checkRank(w, r, u, req.Id) {
+		return
+	}
+
+	usr, err := user_service.Adjust(r.Context(), req.Id, req.Ticker, req.Solids, req.Stocks, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to adjust user %d, reason: %v", u, req.Id, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Adjust{User: resp}, responses.AdjustType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("adjust (solids %d, stocks %d %s, by %v): %v", req.Solids, req.Stocks, req.Ticker, u, *usr)
+}
+
+// Compares the balances with the ledger, the balances are set to the ledger if correct is true
+func (h *Handler) reconcile(w http.ResponseWriter, r *http.Request, u user_cfg.User, correct bool) {
+	drifts, err := user_service.Reconcile(r.Context(), correct, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("%v unable to reconcile, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Reconcile{Drifts: drifts, Corrected: correct}, responses.ReconcileType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	for _, d := range drifts {
+		h.logger.Warnf("%v (found by %v, corrected: %t)", d, u, correct)
+	}
+}
+
+// Reports the drifts of the balances from the ledger
+func (h *Handler) ReconcileHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	h.reconcile(w, r, u, false)
+}
+
+// Sets the drifted balances to the ledger
+func (h *Handler) CorrectHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	h.reconcile(w, r, u, true)
+}
+
+// Get's user
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	// Gets body
+	var req requests.Get
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	usr, err := user_service.Get(r.Context(), req.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("user %d not got, reason:", req.Id, err)
+
+		return
+	}
+
+	// Converts user
+	resp := ToResponseUser(*usr)
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Get{User: resp}, responses.GetType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("sended user: %v", *usr)
+}
+
+// Gets the stock price of the company
+func (h *Handler) PriceHandler(w http.ResponseWriter, r *http.Request) {
+	c, buy, sell, err := user_service.GetPrice(r.Context(), r.URL.Query().Get("ticker"), h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("price not got, reason: %v", err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Price{
+		Ticker:    c.Ticker,
+		Price:     c.Price.Value,
+		Buy:       buy,
+		Sell:      sell,
+		UpdatedAt: c.Price.UpdatedAt,
+	}, responses.PriceType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+}
+
+// Parses the time query parameter (rfc 3339 or unix seconds), zero if it is empty
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// Gets the price history candles of the company
+func (h *Handler) PriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Gets query parameters
+	params := r.URL.Query()
+
+	interval := params.Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+
+	from, fromErr := parseTime(params.Get("from"))
+	to, toErr := parseTime(params.Get("to"))
+
+	if fromErr != nil || toErr != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidQuery, "from and to should be rfc 3339 or unix time")
+
+		// Writes data
+		err := api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Gets the history
+	ticker := params.Get("ticker")
+	candles, err := user_service.PriceHistory(r.Context(), ticker, interval, from, to, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("price history not got, reason: %v", err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.PriceHistory{Ticker: ticker, Interval: interval, Candles: candles}, responses.PriceHistoryType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+}
+
+// Gets all companies
+func (h *Handler) CompaniesHandler(w http.ResponseWriter, r *http.Request) {
+	companies, err := user_service.GetCompanies(r.Context(), h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Errorf("companies not got, reason: %v", err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Companies{Companies: companies}, responses.CompaniesType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+}
+
+// Creates a company
+func (h *Handler) CreateCompanyHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.CreateCompany
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Creates the company
+	c, err := req.Create(r.Context(), h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to create company, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.CreateCompany{Company: *c}, responses.CreateCompanyType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("create %v (by %v)", *c, u)
+}
+
+// Creates an api key
+func (h *Handler) CreateKeyHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.CreateKey
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Creates the key, it can't have more scopes than the creator
+	key, secret, err := req.Create(r.Context(), u.Id, Scopes(r), h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to create key, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.CreateKey{Key: ToResponseKey(*key), Secret: secret}, responses.CreateKeyType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("create key: %v", *key)
+}
+
+// Gets api keys
+func (h *Handler) KeysHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	keys, err := user_service.GetKeys(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to get keys, reason: %v", u, err)
+
+		return
+	}
+
+	// Converts keys
+	resp := make([]responses.Key, len(keys))
+	for i, key := range keys {
+		resp[i] = ToResponseKey(key)
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.Keys{Keys: resp}, responses.KeysType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("sended keys: %v", u)
+}
+
+// Revokes an api key
+func (h *Handler) RevokeKeyHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.RevokeKey
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	key, err := user_service.RevokeKey(r.Context(), u.Id, req.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to revoke key %s, reason: %v", u, req.Id, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.RevokeKey{Key: ToResponseKey(*key)}, responses.RevokeKeyType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("revoke key: %v", *key)
+}
+
+// Starts the two factor enrollment
+func (h *Handler) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	secret, uri, err := user_service.EnrollTwoFactor(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to enroll two factor, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.EnrollTwoFactor{Secret: secret, URI: uri}, responses.EnrollTwoFactorType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("%v enrolled two factor", u)
+}
+
+// Confirms the two factor enrollment
+func (h *Handler) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.ConfirmTwoFactor
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Confirms two factor
+	codes, usr, err := req.Confirm(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to confirm two factor, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.ConfirmTwoFactor{User: ToResponseUser(*usr), RecoveryCodes: codes}, responses.ConfirmTwoFactorType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("%v enabled two factor", *usr)
+}
+
+// Disables two factor
+func (h *Handler) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+	// Gets body
+	var req requests.DisableTwoFactor
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidBody)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		return
+	}
+
+	// Disables two factor
+	usr, err := req.Disable(r.Context(), u.Id, h.db)
+
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return
+		}
+
+		h.logger.Warnf("%v unable to disable two factor, reason: %v", u, err)
+
+		return
+	}
+
+	// Sends data
+	err = api.SendOkResponse(w, responses.DisableTwoFactor{User: ToResponseUser(*usr)}, responses.DisableTwoFactorType)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+
+	h.logger.Printf("%v disabled two factor", *usr)
 }
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vandi37/StocksBack/http/api"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	TooManyAttempts = "too many attempts"
+	AccountLocked   = "account is locked"
+)
+
+// Gets the client ip of the request
+func clientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Gets the limiter key of the user
+func userKey(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
+
+// Sends the limit error with the Retry-After header
+func (h *Handler) sendLimit(w http.ResponseWriter, status int, err error, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	err = api.SendErrorResponse(w, status, err)
+	if err != nil {
+		h.logger.Errorln(err)
+		return
+	}
+}
+
+// Reserves the sign in of the ip (and the user if it isn't nil) before it is verified, so the parallel sign ins can't pass the limits
+//
+// A locked user gets 423, other limits get 429. The reserved sign in must be released with releaseLimit
+func (h *Handler) reserveLimit(w http.ResponseWriter, r *http.Request, id *uint64) bool {
+	// Reserves the ip
+	wait, locked := h.ips.Reserve(clientIp(r))
+	if wait > 0 {
+		h.sendLimit(w, http.StatusTooManyRequests, vanerrors.NewSimple(TooManyAttempts, fmt.Sprintf("retry after %v", wait.Round(time.Second))), wait)
+		if locked {
+			h.logger.Warnf("locked ip %s tried to sign in", clientIp(r))
+		}
+		return false
+	}
+
+	if id == nil {
+		return true
+	}
+
+	// Reserves the user
+	wait, locked = h.users.Reserve(userKey(*id))
+	if wait > 0 {
+		h.ips.Release(clientIp(r))
+	}
+	if locked {
+		h.sendLimit(w, http.StatusLocked, vanerrors.NewSimple(AccountLocked, fmt.Sprintf("retry after %v", wait.Round(time.Second))), wait)
+		h.logger.Warnf("sign in to locked user %d from %s", *id, clientIp(r))
+		return false
+	}
+	if wait > 0 {
+		h.sendLimit(w, http.StatusTooManyRequests, vanerrors.NewSimple(TooManyAttempts, fmt.Sprintf("retry after %v", wait.Round(time.Second))), wait)
+		return false
+	}
+
+	return true
+}
+
+// Adds a failed sign in of the ip (and the user if it isn't nil)
+func (h *Handler) failLimit(r *http.Request, id *uint64) {
+	ip := clientIp(r)
+
+	wait, locked := h.ips.Fail(ip)
+	if locked {
+		h.logger.Warnf("ip %s is locked for %v after failed sign ins", ip, wait)
+	}
+
+	if id == nil {
+		return
+	}
+
+	wait, locked = h.users.Fail(userKey(*id))
+	if locked {
+		h.logger.Warnf("user %d is locked for %v after failed sign ins, last from %s", *id, wait, ip)
+	}
+}
+
+// Releases the reserved sign in of the ip (and the user if it isn't nil), the failure is added before it
+func (h *Handler) releaseLimit(r *http.Request, id *uint64) {
+	h.ips.Release(clientIp(r))
+	if id != nil {
+		h.users.Release(userKey(*id))
+	}
+}
+
+// Forgets the failed sign ins of the user
+func (h *Handler) resetLimit(id uint64) {
+	h.users.Reset(userKey(id))
+}
@@ -0,0 +1,86 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/http/handler"
+	"github.com/vandi37/StocksBack/pkg/jwt"
+	"github.com/vandi37/StocksBack/pkg/limiter"
+	"github.com/vandi37/StocksBack/pkg/logger"
+	"github.com/vandi37/StocksBack/pkg/user_service"
+)
+
+// The failures before the lockout of the sign in test
+const attempts = 3
+
+// Signs in with the wrong password many times at the same time, the parallel sign ins can't pass the backoff
+func TestConcurrentSignIn(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "db.json"))
+
+	usr, err := user_service.SignUpUser{Name: "user", Password: "Correct-Horse-1"}.SignUp(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := handler.NewHandler(db, jwt.New("secret", time.Minute), limiter.New(time.Minute, time.Minute, attempts, time.Hour), limiter.New(0, 0, 1_000_000, 0), 10*time.Second, logger.NewWriter(io.Discard))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	signIn := func(password string) (int, error) {
+		resp, err := srv.Client().Post(srv.URL+"/signin", "application/json", strings.NewReader(fmt.Sprintf(`{"id":%d,"password":%q}`, usr.Id, password)))
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = map[int]int{}
+	)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			code, err := signIn(fmt.Sprint("Wrong-Horse-", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Only the reserved sign ins are verified, the others wait
+	if codes[http.StatusUnauthorized] < 1 || codes[http.StatusUnauthorized] > attempts {
+		t.Errorf("want 1 to %d verified sign ins, got %v", attempts, codes)
+	}
+	if codes[http.StatusUnauthorized]+codes[http.StatusTooManyRequests]+codes[http.StatusLocked] != 20 {
+		t.Errorf("unexpected codes %v", codes)
+	}
+
+	// The right password waits too
+	code, err := signIn("Correct-Horse-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusTooManyRequests && code != http.StatusLocked {
+		t.Errorf("want the sign in to wait, got %d", code)
+	}
+}
@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
 	"github.com/vandi37/StocksBack/http/api"
+	"github.com/vandi37/StocksBack/pkg/jwt"
+	"github.com/vandi37/StocksBack/pkg/limiter"
 	"github.com/vandi37/StocksBack/pkg/logger"
 	"github.com/vandi37/vanerrors"
 )
@@ -13,18 +19,28 @@ import (
 type HandlerFunc func(w http.ResponseWriter, r *http.Request, DB db_cfg.DataBase) int
 
 // The handler
+//
+// timeout: the maximum time of the database work of one request, 0 is no limit
 type Handler struct {
-	logger *logger.Logger
-	db     db_cfg.DataBase
-	funcs  map[string]http.HandlerFunc
+	logger  *logger.Logger
+	db      db_cfg.DataBase
+	tokens  *jwt.Manager
+	users   *limiter.Limiter
+	ips     *limiter.Limiter
+	timeout time.Duration
+	funcs   map[string]http.HandlerFunc
 }
 
 // Created a new handler
-func NewHandler(db db_cfg.DataBase, logger *logger.Logger) *Handler {
+func NewHandler(db db_cfg.DataBase, tokens *jwt.Manager, users *limiter.Limiter, ips *limiter.Limiter, timeout time.Duration, logger *logger.Logger) *Handler {
 	// Creating handler
 	handler := Handler{
-		logger: logger,
-		db:     db,
+		logger:  logger,
+		db:      db,
+		tokens:  tokens,
+		users:   users,
+		ips:     ips,
+		timeout: timeout,
 	}
 
 	// Adding functions
@@ -32,20 +48,67 @@ func NewHandler(db db_cfg.DataBase, logger *logger.Logger) *Handler {
 		// Sign up
 		"/signup": handler.CheckMethodMiddleware(http.MethodPost, handler.SignUpHandler),
 
+		// Sign in
+		"/signin": handler.CheckMethodMiddleware(http.MethodPost, handler.SignInHandler),
+
+		// Sessions
+		"/token/refresh": handler.CheckMethodMiddleware(http.MethodPost, handler.RefreshHandler),
+		"/signout":       handler.CheckMethodMiddleware(http.MethodPost, handler.SignOutHandler),
+		"/signout/all":   handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(false, key_cfg.ACCOUNT, handler.SignOutAllHandler)),
+
 		// Stocks and solids
-		"/buy":  handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, handler.BuyStocksHandler)),
-		"/farm": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, handler.FarmHandler)),
+		"/buy":  handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.BUY, handler.BuyStocksHandler)),
+		"/sell": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.BUY, handler.SellStocksHandler)),
+		"/farm": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.FARM, handler.FarmHandler)),
+
+		// Order book
+		"/orders":        handler.CheckMethodMiddleware(http.MethodGet, handler.AuthorizationMiddleware(false, key_cfg.READ, handler.OrdersHandler)),
+		"/orders/place":  handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.BUY, handler.PlaceOrderHandler)),
+		"/orders/cancel": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(false, key_cfg.BUY, handler.CancelOrderHandler)),
+		"/orders/depth":  handler.CheckMethodMiddleware(http.MethodGet, handler.DepthHandler),
+
+		// Transfers
+		"/transfer": handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.TRANSFER, handler.TransferHandler)),
+
+		// Ledger
+		"/history": handler.CheckMethodMiddleware(http.MethodGet, handler.AuthorizationMiddleware(false, key_cfg.READ, handler.HistoryHandler)),
 
 		// Name and password
-		"/change/name":     handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, handler.UpdateNameHandler)),
-		"/change/password": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, handler.UpdatePasswordHandler)),
+		"/change/name":     handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.UpdateNameHandler)),
+		"/change/password": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.UpdatePasswordHandler)),
+
+		// Api keys
+		"/keys":        handler.CheckMethodMiddleware(http.MethodGet, handler.AuthorizationMiddleware(true, key_cfg.READ, handler.KeysHandler)),
+		"/keys/create": handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.CreateKeyHandler)),
+		"/keys/revoke": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.RevokeKeyHandler)),
+
+		// Two factor
+		"/2fa/enroll":  handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.EnrollTwoFactorHandler)),
+		"/2fa/confirm": handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.ConfirmTwoFactorHandler)),
+		"/2fa/disable": handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.ACCOUNT, handler.DisableTwoFactorHandler)),
 
 		// Block
-		"/block":   handler.KeyMiddleware(handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(false, handler.BlockHandler))),
-		"/unblock": handler.KeyMiddleware(handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(false, handler.UnblockHandler))),
+		"/block":   handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.BLOCK, handler.BlockHandler))),
+		"/unblock": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.BLOCK, handler.UnblockHandler))),
+
+		// Roles and balances
+		"/role":   handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.SET_ROLE, handler.SetRoleHandler))),
+		"/adjust": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.ADJUST_BALANCE, handler.AdjustHandler))),
+
+		// Ledger reconciliation
+		"/reconcile":         handler.CheckMethodMiddleware(http.MethodGet, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.RECONCILE, handler.ReconcileHandler))),
+		"/reconcile/correct": handler.CheckMethodMiddleware(http.MethodPatch, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.RECONCILE, handler.CorrectHandler))),
 
 		// Get
 		"/get": handler.CheckMethodMiddleware(http.MethodGet, handler.GetHandler),
+
+		// Stock price
+		"/price":         handler.CheckMethodMiddleware(http.MethodGet, handler.PriceHandler),
+		"/price/history": handler.CheckMethodMiddleware(http.MethodGet, handler.PriceHistoryHandler),
+
+		// Companies
+		"/companies":        handler.CheckMethodMiddleware(http.MethodGet, handler.CompaniesHandler),
+		"/companies/create": handler.CheckMethodMiddleware(http.MethodPost, handler.AuthorizationMiddleware(true, key_cfg.ADMIN, handler.PermissionMiddleware(user_cfg.MANAGE_MARKET, handler.CreateCompanyHandler))),
 	}
 
 	return &handler
@@ -70,6 +133,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Limits the time of the request, the context is passed to the data base
+	if h.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
 	// Runs the handler
 	fn(w, r)
 }
@@ -1,13 +1,18 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
+	"github.com/vandi37/StocksBack/config/key_cfg"
 	"github.com/vandi37/StocksBack/config/user_cfg"
 	"github.com/vandi37/StocksBack/http/api"
 	"github.com/vandi37/StocksBack/http/api/input/headers"
+	"github.com/vandi37/StocksBack/pkg/jwt"
 	"github.com/vandi37/StocksBack/pkg/user_service"
 	"github.com/vandi37/vanerrors"
 )
@@ -25,6 +30,27 @@ const (
 // function with Signing in
 type HandlerFuncUser func(w http.ResponseWriter, r *http.Request, u user_cfg.User)
 
+// The sign in data of the request
+type auth struct {
+	scopes  []key_cfg.Scope
+	isSuper bool
+}
+
+// The context key of the request sign in data
+type authKey struct{}
+
+// Gets the scopes of the signed in request
+func Scopes(r *http.Request) []key_cfg.Scope {
+	a, _ := r.Context().Value(authKey{}).(auth)
+	return a.scopes
+}
+
+// Checks is the request signed in with the admin key (superadmin)
+func IsSuper(r *http.Request) bool {
+	a, _ := r.Context().Value(authKey{}).(auth)
+	return a.isSuper
+}
+
 // Checks the method
 func (h *Handler) CheckMethodMiddleware(method string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -46,84 +72,58 @@ func (h *Handler) CheckMethodMiddleware(method string, next http.HandlerFunc) ht
 	}
 }
 
-// Signs in
-func (h *Handler) AuthorizationMiddleware(checkBlock bool, next HandlerFuncUser) http.HandlerFunc {
+// Signs in with the admin key, an api key or the bearer access token and checks the scope
+//
+// The admin key from config is the bootstrap superadmin credential, it has all scopes and permissions
+// Api keys have their own scopes
+// Access tokens have all scopes, the privileged routes are also checked by role (PermissionMiddleware)
+func (h *Handler) AuthorizationMiddleware(checkBlock bool, scope key_cfg.Scope, next HandlerFuncUser) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Gets header
-		key := r.Header.Get("Key")
-
-		if key != "" {
-			// Gets header data
-			var keyData headers.Key
-			err := json.Unmarshal([]byte(key), &keyData)
-
-			if err != nil {
-
-				// Creates an error
-				resp := vanerrors.NewSimple(InvalidHeader)
-
-				// Writes data
-				err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
-				if err != nil {
-					h.logger.Errorln(err)
-					return
-				}
-
+		var (
+			usr     *user_cfg.User
+			scopes  []key_cfg.Scope
+			ok      bool
+			isSuper bool
+		)
+
+		// Reserves the sign in with keys
+		withKey := r.Header.Get("Key") != "" || r.Header.Get("Api-Key") != ""
+		if withKey {
+			if !h.reserveLimit(w, r, nil) {
 				return
 			}
-			usr, err := keyData.SignInWithKey(h.db)
-			if err != nil {
+		}
 
-				// Writes data
-				err = api.SendErrorResponse(w, user_service.GetCode(err), err)
-				if err != nil {
-					h.logger.Errorln(err)
-					return
-				}
+		// Signs in by the header
+		if r.Header.Get("Key") != "" {
+			usr, scopes, ok = h.signInWithKey(w, r)
+			isSuper = true
+		} else if r.Header.Get("Api-Key") != "" {
+			usr, scopes, ok = h.signInWithApiKey(w, r)
+		} else {
+			usr, scopes, ok = h.signInWithToken(w, r)
+		}
 
-				h.logger.Warnf("unable to login with key, reason: %v", err)
+		if withKey {
+			h.releaseLimit(r, nil)
+		}
 
-				return
-			}
-			if checkBlock && usr.IsBlocked {
-				err = api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, "user is blocked"))
-				if err != nil {
-					h.logger.Errorln(err)
-					return
-				}
-				return
-			}
-			next(w, r, *usr)
+		if !ok {
 			return
 		}
 
-		// Gets header
-		key = r.Header.Get("Authorization")
-
-		if key == "" {
-
-			// Creates an error
-			resp := vanerrors.NewSimple(NoAuthorizationHeaders)
-
-			// Writes data
-			err := api.SendErrorResponse(w, http.StatusUnauthorized, resp)
+		// Checks the scope
+		if !slices.Contains(scopes, scope) {
+			err := api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, fmt.Sprintf("scope %s is required", scope)))
 			if err != nil {
 				h.logger.Errorln(err)
 				return
 			}
 			return
 		}
-		// Gets header data
-		var authData headers.Authorization
-		err := json.Unmarshal([]byte(key), &authData)
-
-		if err != nil {
-
-			// Creates an error
-			resp := vanerrors.NewSimple(InvalidHeader)
 
-			// Writes data
-			err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if checkBlock && usr.IsBlocked {
+			err := api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, "user is blocked"))
 			if err != nil {
 				h.logger.Errorln(err)
 				return
@@ -131,63 +131,204 @@ func (h *Handler) AuthorizationMiddleware(checkBlock bool, next HandlerFuncUser)
 			return
 		}
 
-		ok, usr, err := authData.SignIn(h.db)
-		if err != nil {
-			// Writes data
-			err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		next(w, r.WithContext(context.WithValue(r.Context(), authKey{}, auth{scopes: scopes, isSuper: isSuper})), *usr)
+	}
+}
+
+// Checks the permission of the user role (the superadmin has all permissions)
+func (h *Handler) PermissionMiddleware(permission user_cfg.Permission, next HandlerFuncUser) HandlerFuncUser {
+	return func(w http.ResponseWriter, r *http.Request, u user_cfg.User) {
+		if !IsSuper(r) && !u.Can(permission) {
+			err := api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, fmt.Sprintf("%s has no permission %s", u.GetRole(), permission)))
 			if err != nil {
 				h.logger.Errorln(err)
 				return
 			}
 
-			h.logger.Warnf("unable to login, reason: %v", err)
-
+			h.logger.Warnf("%v tried to use permission %s", u, permission)
 			return
 		}
-		if !ok {
+		next(w, r, u)
+	}
+}
 
-			// Creates an error
-			resp := vanerrors.NewSimple(WrongPassword)
+// Checks that the user outranks the target user (the superadmin outranks everyone)
+func (h *Handler) checkRank(w http.ResponseWriter, r *http.Request, u user_cfg.User, id uint64) bool {
+	if IsSuper(r) {
+		return true
+	}
 
-			// Writes data
-			err := api.SendErrorResponse(w, http.StatusUnauthorized, resp)
-			if err != nil {
-				h.logger.Errorln(err)
-				return
-			}
-			return
+	// Gets the target
+	target, err := user_service.Get(r.Context(), id, h.db)
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return false
 		}
+		return false
+	}
 
-		if checkBlock && usr.IsBlocked {
-			err = api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, "user is blocked"))
-			if err != nil {
-				h.logger.Errorln(err)
-				return
-			}
-			return
+	if !u.Outranks(*target) {
+		err = api.SendErrorResponse(w, http.StatusForbidden, vanerrors.NewSimple(NotAllowed, fmt.Sprintf("%s can't act on %s", u.GetRole(), target.GetRole())))
+		if err != nil {
+			h.logger.Errorln(err)
+			return false
+		}
+
+		h.logger.Warnf("%v tried to act on %v", u, *target)
+		return false
+	}
+
+	return true
+}
+
+// Signs in with the admin key
+func (h *Handler) signInWithKey(w http.ResponseWriter, r *http.Request) (*user_cfg.User, []key_cfg.Scope, bool) {
+	// Gets header data
+	var keyData headers.Key
+	err := json.Unmarshal([]byte(r.Header.Get("Key")), &keyData)
+
+	if err != nil {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidHeader)
+
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusBadRequest, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
+		}
+
+		return nil, nil, false
+	}
+	usr, err := keyData.SignInWithKey(r.Context(), h.db)
+	if err != nil {
+		code := user_service.GetCode(err)
+		if code == http.StatusUnauthorized {
+			h.failLimit(r, nil)
+		}
+
+		// Writes data
+		err = api.SendErrorResponse(w, code, err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
 		}
-		next(w, r, *usr)
+
+		h.logger.Warnf("unable to login with key, reason: %v", err)
+
+		return nil, nil, false
 	}
+
+	return usr, key_cfg.Scopes, true
 }
 
-// Checks admin
-func (h *Handler) KeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Checking the key header (without it not allowed)
-		key := r.Header.Get("Key")
+// Signs in with the api key
+func (h *Handler) signInWithApiKey(w http.ResponseWriter, r *http.Request) (*user_cfg.User, []key_cfg.Scope, bool) {
+	// Gets header data
+	keyData := headers.ApiKey{SignInApiKey: user_service.SignInApiKey{Key: r.Header.Get("Api-Key")}}
 
-		if key == "" {
-			// Creates an error
-			resp := vanerrors.NewSimple(InvalidHeader)
+	usr, key, err := keyData.SignIn(r.Context(), h.db)
+	if err != nil {
+		code := user_service.GetCode(err)
+		if code == http.StatusUnauthorized {
+			h.failLimit(r, nil)
+		}
 
-			// Writes data
-			err := api.SendErrorResponse(w, http.StatusForbidden, resp)
-			if err != nil {
-				h.logger.Errorln(err)
-				return
-			}
+		// Writes data
+		err = api.SendErrorResponse(w, code, err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
+		}
 
-			return
+		h.logger.Warnf("unable to login with api key, reason: %v", err)
+
+		return nil, nil, false
+	}
+
+	return usr, key.Scopes, true
+}
+
+// Signs in with the bearer access token
+func (h *Handler) signInWithToken(w http.ResponseWriter, r *http.Request) (*user_cfg.User, []key_cfg.Scope, bool) {
+	// Gets header
+	auth := r.Header.Get("Authorization")
+
+	if auth == "" {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(NoAuthorizationHeaders)
+
+		// Writes data
+		err := api.SendErrorResponse(w, http.StatusUnauthorized, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
+		}
+		return nil, nil, false
+	}
+
+	// Gets the token
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+
+		// Creates an error
+		resp := vanerrors.NewSimple(InvalidHeader, "expected bearer token")
+
+		// Writes data
+		err := api.SendErrorResponse(w, http.StatusUnauthorized, resp)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
+		}
+		return nil, nil, false
+	}
+
+	// Checks the token
+	claims, err := h.tokens.Parse(token)
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusUnauthorized, err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
+		}
+		return nil, nil, false
+	}
+
+	// Checks the session
+	session, err := user_service.CheckSession(r.Context(), claims.Session, h.db)
+	if err == nil && session.UserId != claims.Subject {
+		err = vanerrors.NewSimple(jwt.InvalidToken, "session of other user")
+	}
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, http.StatusUnauthorized, err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
 		}
+		return nil, nil, false
 	}
+
+	// Gets the user
+	usr, err := user_service.Get(r.Context(), claims.Subject, h.db)
+	if err != nil {
+		// Writes data
+		err = api.SendErrorResponse(w, user_service.GetCode(err), err)
+		if err != nil {
+			h.logger.Errorln(err)
+			return nil, nil, false
+		}
+
+		h.logger.Warnf("unable to login with token, reason: %v", err)
+
+		return nil, nil, false
+	}
+
+	return usr, key_cfg.Scopes, true
 }
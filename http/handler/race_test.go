@@ -0,0 +1,154 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/http/handler"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/StocksBack/pkg/jwt"
+	"github.com/vandi37/StocksBack/pkg/limiter"
+	"github.com/vandi37/StocksBack/pkg/logger"
+	"github.com/vandi37/StocksBack/pkg/user_service"
+)
+
+// The amount of users and the requests of every user
+const (
+	users    = 8
+	requests = 25
+)
+
+// Opens the file data base with the users, every user has enough solids for all purchases
+func open(t *testing.T, name string) db_cfg.DataBase {
+	t.Helper()
+
+	db := dbtest.Open(t, file_db.Constructor{}, func(t *testing.T) config.DatabaseCfg { return config.DatabaseCfg{Name: name} })
+
+	ctx := context.Background()
+	for i := range uint64(users) {
+		err := db.Create(ctx, user_cfg.User{Id: i, Name: fmt.Sprint("user ", i), Role: user_cfg.USER, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.UpdateSolids(ctx, i, 1_000_000, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+// Sends the request of the user signed in with the data base key
+func send(srv *httptest.Server, id uint64, method string, path string, body string) (int, string, error) {
+	req, err := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Key", fmt.Sprintf(`{"key":%q,"id":%d}`, dbtest.Key, id))
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), err
+}
+
+// Farms and buys stocks from many users at the same time, it is run with the race detector (go test -race)
+func TestConcurrentFarmAndBuy(t *testing.T) {
+	old := user_service.FarmingLimit
+	user_service.FarmingLimit = 0
+	defer func() { user_service.FarmingLimit = old }()
+
+	name := filepath.Join(t.TempDir(), "db.json")
+	db := open(t, name)
+
+	h := handler.NewHandler(db, jwt.New("secret", time.Minute), limiter.New(0, 0, 1_000_000, 0), limiter.New(0, 0, 1_000_000, 0), 10*time.Second, logger.NewWriter(io.Discard))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, users*requests*2)
+	for id := range uint64(users) {
+		// Two clients of every user, so the same user is changed at the same time
+		for _, path := range []string{"/farm", "/buy"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for range requests {
+					code, body, err := send(srv, id, http.MethodPatch, path, fmt.Sprintf(`{"ticker":%q,"num":1}`, company_cfg.DefaultTicker))
+					if err == nil && code != http.StatusOK {
+						err = fmt.Errorf("%s of user %d: %d %s", path, id, code, body)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	ctx := context.Background()
+
+	// Every purchase is saved
+	all, err := db.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, usr := range all {
+		if got := usr.Stocks(company_cfg.DefaultTicker); got != requests {
+			t.Errorf("user %d has %d stocks, want %d", usr.Id, got, requests)
+		}
+	}
+
+	// The balances match the ledger
+	drifts, err := db.GetDrifts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("the balances drifted: %v", drifts)
+	}
+
+	// The log has the same data
+	srv.Close()
+	db.Close()
+
+	reopened := dbtest.Open(t, file_db.Constructor{}, func(t *testing.T) config.DatabaseCfg { return config.DatabaseCfg{Name: name} })
+	saved, err := reopened.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := func(a, b user_cfg.User) bool {
+		return a.SolidBalance == b.SolidBalance && a.Stocks(company_cfg.DefaultTicker) == b.Stocks(company_cfg.DefaultTicker)
+	}
+	if !slices.EqualFunc(all, saved, same) {
+		t.Errorf("the saved users differ:\n%v\n%v", all, saved)
+	}
+}
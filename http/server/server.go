@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 )
 
@@ -10,9 +12,9 @@ type Server struct {
 	http.Server
 }
 
-// Creates a new server
-func NewServer(handler http.Handler, port int) *Server {
-	return &Server{http.Server{Addr: fmt.Sprint(":", port), Handler: handler}}
+// Creates a new server, the contexts of the requests are canceled when ctx is done
+func NewServer(ctx context.Context, handler http.Handler, port int) *Server {
+	return &Server{http.Server{Addr: fmt.Sprint(":", port), Handler: handler, BaseContext: func(net.Listener) context.Context { return ctx }}}
 }
 
 // Runs server
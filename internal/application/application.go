@@ -9,12 +9,17 @@ import (
 	"github.com/vandi37/StocksBack/config/config"
 	"github.com/vandi37/StocksBack/config/db_cfg"
 	"github.com/vandi37/StocksBack/config/db_cfg/constructors"
+	"github.com/vandi37/StocksBack/config/user_cfg"
 	"github.com/vandi37/StocksBack/http/handler"
 	"github.com/vandi37/StocksBack/http/server"
 	"github.com/vandi37/StocksBack/pkg/closer"
 	"github.com/vandi37/StocksBack/pkg/cron"
+	"github.com/vandi37/StocksBack/pkg/encrypt"
 	"github.com/vandi37/StocksBack/pkg/hash"
+	"github.com/vandi37/StocksBack/pkg/jwt"
+	"github.com/vandi37/StocksBack/pkg/limiter"
 	"github.com/vandi37/StocksBack/pkg/logger"
+	"github.com/vandi37/StocksBack/pkg/price"
 	"github.com/vandi37/StocksBack/pkg/user_service"
 	"github.com/vandi37/vanerrors"
 )
@@ -23,6 +28,13 @@ import (
 const (
 	ErrorUpdatingStocks  = "error updating stocks"
 	ErrorParsingDuration = "error parsing duration"
+	InvalidSellFee       = "invalid sell fee"
+	InvalidPrice         = "invalid price"
+	InvalidLimit         = "invalid limit"
+	ErrorMovingPrice     = "error moving price"
+	ErrorDownsampling    = "error downsampling"
+	ErrorReconciling     = "error reconciling"
+	NoMigrations         = "no migrations" // the data base type has no versioned migrations
 )
 
 // Thr application program
@@ -36,9 +48,9 @@ func New(config string) *Application {
 }
 
 // Cron func for updating user
-func CronFunc(db db_cfg.DataBase, logger *logger.Logger) func() error {
+func CronFunc(ctx context.Context, db db_cfg.DataBase, logger *logger.Logger) func() error {
 	return func() error {
-		users, err := user_service.StockUpdate(db)
+		users, err := user_service.StockUpdate(ctx, db)
 		for _, u := range users {
 			logger.Println("%v got solids from stocks", u)
 		}
@@ -49,6 +61,132 @@ func CronFunc(db db_cfg.DataBase, logger *logger.Logger) func() error {
 	}
 }
 
+// Cron func for moving the stock prices
+func PriceCronFunc(ctx context.Context, db db_cfg.DataBase, logger *logger.Logger) func() error {
+	return func() error {
+		companies, err := user_service.MovePrices(ctx, db)
+		for _, c := range companies {
+			logger.Printf("stock %v", c)
+		}
+		if err != nil {
+			return vanerrors.NewWrap(ErrorMovingPrice, err, vanerrors.EmptyHandler)
+		}
+		return nil
+	}
+}
+
+// Cron func for downsampling the old price changes
+func HistoryCronFunc(ctx context.Context, db db_cfg.DataBase, logger *logger.Logger) func() error {
+	return func() error {
+		n, err := user_service.DownsamplePrice(ctx, db)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorDownsampling, err, vanerrors.EmptyHandler)
+		}
+		if n > 0 {
+			logger.Printf("downsampled %d price changes", n)
+		}
+		return nil
+	}
+}
+
+// Cron func for comparing the balances with the ledger, the drifted balances are set to the ledger if correct is true
+func ReconcileCronFunc(ctx context.Context, db db_cfg.DataBase, logger *logger.Logger, correct bool) func() error {
+	return func() error {
+		drifts, err := user_service.Reconcile(ctx, correct, db)
+		for _, d := range drifts {
+			logger.Warnf("%v (corrected: %t)", d, correct)
+		}
+		if err != nil {
+			return vanerrors.NewWrap(ErrorReconciling, err, vanerrors.EmptyHandler)
+		}
+		return nil
+	}
+}
+
+// Runs the reconciliation once and exits, the drifted balances are set to the ledger if correct is true
+func (a *Application) Reconcile(ctx context.Context, correct bool) {
+	// Creates logger
+	logger := logger.New()
+
+	// Loading config
+	cfg, err := config.LoadConfig(a.Config)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// Getting database constructor
+	constructor, err := constructors.Get(cfg.Database.Type)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// Creating the data base
+	db, err := constructor.New(cfg.Database, cfg.Key)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	defer db.Close()
+
+	err = db.Init(ctx)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// Reconciling
+	err = ReconcileCronFunc(ctx, db, logger, correct)()
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	logger.Println("reconciliation done")
+}
+
+// Applies the pending migrations of the data base and exits, with dry run only prints them
+func (a *Application) Migrate(ctx context.Context, dryRun bool) {
+	// Creates logger
+	logger := logger.New()
+
+	// Loading config
+	cfg, err := config.LoadConfig(a.Config)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// Getting database constructor
+	constructor, err := constructors.Get(cfg.Database.Type)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// Creating the data base
+	db, err := constructor.New(cfg.Database, cfg.Key)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+	defer db.Close()
+
+	migrator, ok := db.(db_cfg.Migrator)
+	if !ok {
+		logger.Fatalln(vanerrors.NewSimple(NoMigrations, "the data base type "+cfg.Database.Type+" has no migrations"))
+	}
+
+	// Migrating
+	migrations, err := migrator.Migrate(ctx, dryRun)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	for _, m := range migrations {
+		if dryRun {
+			logger.Printf("pending %v", m)
+		} else {
+			logger.Printf("applied %v", m)
+		}
+	}
+
+	logger.Printf("migration done, %d migrations (dry run: %t)", len(migrations), dryRun)
+}
+
 // Runs the application
 func (a *Application) Run(ctx context.Context) {
 	// Creates logger
@@ -73,6 +211,73 @@ func (a *Application) Run(ctx context.Context) {
 		logger.Fatalln(ErrorParsingDuration)
 	}
 
+	// Getting access token lifetime
+	access, err := time.ParseDuration(cfg.Token.Access)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	// Getting refresh token lifetime
+	refresh, err := time.ParseDuration(cfg.Token.Refresh)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	// Getting sign in limits
+	backoff, err := time.ParseDuration(cfg.Limit.Backoff)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	maxBackoff, err := time.ParseDuration(cfg.Limit.MaxBackoff)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	lockout, err := time.ParseDuration(cfg.Limit.Lockout)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	// Checking sign in limits, no attempts refuse every sign in
+	if cfg.Limit.Attempts <= 0 || cfg.Limit.IpAttempts <= 0 || backoff < 0 || backoff > maxBackoff {
+		logger.Fatalln(InvalidLimit)
+	}
+
+	// Checking sell fee
+	if cfg.Market.SellFee < 0 || cfg.Market.SellFee > 100 {
+		logger.Fatalln(InvalidSellFee)
+	}
+
+	// Checking price
+	if cfg.Market.Price <= 0 || cfg.Market.MinPrice <= 0 || cfg.Market.Impact < 0 || cfg.Market.Drift < 0 {
+		logger.Fatalln(InvalidPrice)
+	}
+
+	// Getting price drift period
+	driftPeriod, err := time.ParseDuration(cfg.Market.DriftPeriod)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	// Getting price history retention
+	retention, err := time.ParseDuration(cfg.Market.Retention)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	// Getting the database timeout of one request
+	timeout, err := time.ParseDuration(cfg.Database.Timeout)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
+	// Getting ledger reconciliation period
+	reconcile, err := time.ParseDuration(cfg.Ledger.Reconcile)
+	if err != nil {
+		logger.Fatalln(ErrorParsingDuration)
+	}
+
 	// Setting context
 	if !cfg.App.IsService {
 		var stop context.CancelFunc
@@ -88,6 +293,28 @@ func (a *Application) Run(ctx context.Context) {
 	// Setting salt
 	hash.SALT = cfg.Salt
 
+	// Setting password policy
+	user_cfg.Policy = user_cfg.PasswordPolicy{
+		MinLength: cfg.Password.MinLength,
+		MaxLength: cfg.Password.MaxLength,
+		Lower:     cfg.Password.Lower,
+		Upper:     cfg.Password.Upper,
+		Digit:     cfg.Password.Digit,
+		Symbol:    cfg.Password.Symbol,
+	}
+
+	// Setting two factor authentication
+	encrypt.KEY = cfg.TwoFactor.Key
+	user_service.Issuer = cfg.TwoFactor.Issuer
+
+	// Setting market
+	user_service.SellFee = cfg.Market.SellFee
+	user_service.Market = price.New(cfg.Market.Price, cfg.Market.Impact, cfg.Market.Drift, cfg.Market.MinPrice, cfg.Market.MaxPrice)
+	user_service.HistoryRetention = retention
+
+	// Setting session lifetime
+	user_service.SessionLimit = refresh
+
 	// Creating the data base
 	db, err := constructor.New(cfg.Database, cfg.Key)
 	if err != nil {
@@ -96,7 +323,7 @@ func (a *Application) Run(ctx context.Context) {
 	closer.Add(db.Close)
 
 	// Creating the tables
-	err = db.Init()
+	err = db.Init(ctx)
 	if err != nil {
 		logger.Fatalln(err)
 	}
@@ -104,11 +331,34 @@ func (a *Application) Run(ctx context.Context) {
 	logger.Println("database connected")
 
 	// Running cron
-	cr := cron.New(time.Hour*24, 21, CronFunc(db, logger), logger)
+	cr := cron.New(time.Hour*24, 21, CronFunc(ctx, db, logger), logger)
 	cr.Run()
 
-	handler := handler.NewHandler(db, logger)
-	server := server.NewServer(handler, cfg.Port)
+	// Running price drift
+	if cfg.Market.Drift > 0 {
+		priceCron := cron.New(driftPeriod, 0, PriceCronFunc(ctx, db, logger), logger)
+		priceCron.Run()
+	}
+
+	// Running price history downsampling
+	historyCron := cron.New(time.Hour, 0, HistoryCronFunc(ctx, db, logger), logger)
+	historyCron.Run()
+
+	// Running ledger reconciliation
+	if reconcile > 0 {
+		reconcileCron := cron.New(reconcile, 0, ReconcileCronFunc(ctx, db, logger, cfg.Ledger.Correct), logger)
+		reconcileCron.Run()
+	}
+
+	// Creating token manager
+	tokens := jwt.New(cfg.Token.Secret, access)
+
+	// Creating sign in limiters (by user id and by ip)
+	users := limiter.New(backoff, maxBackoff, cfg.Limit.Attempts, lockout)
+	ips := limiter.New(backoff, maxBackoff, cfg.Limit.IpAttempts, lockout)
+
+	handler := handler.NewHandler(db, tokens, users, ips, timeout, logger)
+	server := server.NewServer(ctx, handler, cfg.Port)
 	closer.Add(server.Close)
 
 	go server.Run()
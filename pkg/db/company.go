@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/pkg/sql_db"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	NegativeStocks = "negative stocks" // the old stock balances of the users are negative, they can't be moved
+)
+
+// Creates the default company and moves the old single stock balance and price to it (the step of the companies migration)
+func migrateStocks(ctx context.Context, tx sql_db.Querier) error {
+	// Creates the default company
+	d := company_cfg.Default()
+	err := sql_db.CreateDefault(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	// Moves the old price
+	var exists bool
+	err = tx.QueryRowContext(ctx, `select to_regclass('stock_price') is not null;`).Scan(&exists)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	if exists {
+		_, err = tx.ExecContext(ctx, `update companies set price = p.value, price_updated_at = p.updated_at from stock_price p where companies.ticker = $1 and p.id = 1;`, d.Ticker)
+		if err != nil {
+			return vanerrors.NewWrap(sql_db.ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+		}
+
+		// The statements with arguments can't be joined
+		_, err = tx.ExecContext(ctx, `drop table stock_price;`)
+		if err != nil {
+			return vanerrors.NewWrap(sql_db.ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	// Moves the old stock balances
+	err = tx.QueryRowContext(ctx, `select exists (select 1 from information_schema.columns
+		where table_schema = current_schema() and table_name = 'users' and column_name = 'stock_balance');`).Scan(&exists)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	if exists {
+		// The negative balances can't be held, they are fixed before migrating so no balance is lost
+		rows, err := tx.QueryContext(ctx, `select id from users where stock_balance < 0 order by id;`)
+		if err != nil {
+			return vanerrors.NewWrap(sql_db.ErrorSelecting, err, vanerrors.EmptyHandler)
+		}
+		negative := []uint64{}
+		for rows.Next() {
+			var id uint64
+			err = rows.Scan(&id)
+			if err != nil {
+				rows.Close()
+				return vanerrors.NewWrap(sql_db.ErrorScanningRows, err, vanerrors.EmptyHandler)
+			}
+			negative = append(negative, id)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return vanerrors.NewWrap(sql_db.ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+		}
+		if len(negative) > 0 {
+			return vanerrors.NewSimple(NegativeStocks, fmt.Sprintf("the users %v have negative stock balances", negative))
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into holdings (user_id, ticker, amount) select id, $1, stock_balance from users where stock_balance <> 0
+			on conflict (user_id, ticker) do update set amount = holdings.amount + excluded.amount;`, d.Ticker)
+		if err != nil {
+			return vanerrors.NewWrap(sql_db.ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		_, err = tx.ExecContext(ctx, `alter table users drop column stock_balance;`)
+		if err != nil {
+			return vanerrors.NewWrap(sql_db.ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/pkg/sql_db"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorReadingMigrations = "error reading migrations"
+	ErrorMigrating         = "error migrating"
+	ChecksumMismatch       = "checksum mismatch" // the applied migration is edited
+	UnknownMigration       = "unknown migration" // the data base is migrated by a newer program
+)
+
+// The migrations, the files are named <version>_<name>.sql
+//
+// The applied migrations can't be edited (their checksums are checked), the changes are new migrations
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// The key of the advisory lock of the migrations, only one program migrates the data base
+const migrationLock = 0x53746f636b73
+
+// The steps that can't be written in sql, they run after the sql of the version in the same transaction
+var migrationSteps = map[int]func(ctx context.Context, tx sql_db.Querier) error{
+	2: migrateStocks,
+	3: sql_db.OpenLedger,
+}
+
+// The migration with the sql
+type migration struct {
+	db_cfg.Migration
+	sql string
+}
+
+// Reads the migrations sorted by version
+func migrations() ([]migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorReadingMigrations, err, vanerrors.EmptyHandler)
+	}
+
+	res := []migration{}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".sql")
+		version, name, _ := strings.Cut(name, "_")
+
+		v, err := strconv.Atoi(version)
+		if err != nil || v != len(res)+1 {
+			return nil, vanerrors.NewSimple(ErrorReadingMigrations, fmt.Sprintf("migration %s should have version %d", file, len(res)+1))
+		}
+
+		data, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorReadingMigrations, err, vanerrors.EmptyHandler)
+		}
+
+		sum := sha256.Sum256(data)
+		res = append(res, migration{Migration: db_cfg.Migration{Version: v, Name: name, Checksum: hex.EncodeToString(sum[:])}, sql: string(data)})
+	}
+
+	return res, nil
+}
+
+// Applies the pending migrations in one transaction and returns them, with dry run only returns them
+//
+// The checksums of the applied migrations are checked first, the data bases created before the migrations get all migrations (they don't change the existing tables)
+func (db *DB) Migrate(ctx context.Context, dryRun bool) ([]db_cfg.Migration, error) {
+	all, err := migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(sql_db.ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	// The other programs wait until the migrations are applied
+	_, err = tx.ExecContext(ctx, `select pg_advisory_xact_lock($1);`, migrationLock)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorMigrating, err, vanerrors.EmptyHandler)
+	}
+
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);`)
+	if err != nil {
+		return nil, vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	// Checks the applied migrations
+	rows, err := tx.QueryContext(ctx, `select version, name, checksum from schema_migrations order by version;`)
+	if err != nil {
+		return nil, vanerrors.NewWrap(sql_db.ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var m db_cfg.Migration
+		err = rows.Scan(&m.Version, &m.Name, &m.Checksum)
+		if err != nil {
+			rows.Close()
+			return nil, vanerrors.NewWrap(sql_db.ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+
+		if m.Version < 1 || m.Version > len(all) {
+			rows.Close()
+			return nil, vanerrors.NewSimple(UnknownMigration, fmt.Sprintf("%v is applied, but the program knows only %d migrations", m, len(all)))
+		}
+		if all[m.Version-1].Checksum != m.Checksum {
+			rows.Close()
+			return nil, vanerrors.NewSimple(ChecksumMismatch, fmt.Sprintf("%v is edited after it was applied", all[m.Version-1]))
+		}
+		applied[m.Version] = true
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(sql_db.ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	res := []db_cfg.Migration{}
+	for _, m := range all {
+		if !applied[m.Version] {
+			res = append(res, m.Migration)
+		}
+	}
+
+	if dryRun || len(res) == 0 {
+		return res, nil
+	}
+
+	// Applies the pending migrations
+	for _, m := range all {
+		if applied[m.Version] {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, m.sql)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorMigrating, fmt.Errorf("%v: %w", m, err), vanerrors.EmptyHandler)
+		}
+
+		if step, ok := migrationSteps[m.Version]; ok {
+			err = step(ctx, tx)
+			if err != nil {
+				return nil, vanerrors.NewWrap(ErrorMigrating, fmt.Errorf("%v: %w", m, err), vanerrors.EmptyHandler)
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `insert into schema_migrations (version, name, checksum, applied_at) values ($1, $2, $3, $4);`, m.Version, m.Name, m.Checksum, time.Now())
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorMigrating, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, vanerrors.NewWrap(sql_db.ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
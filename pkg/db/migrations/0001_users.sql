@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	password VARCHAR(255) NOT NULL,
+	solid_balance BIGINT DEFAULT 0,
+	is_blocked BOOLEAN DEFAULT FALSE,
+	last_farming TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	role VARCHAR(32) NOT NULL DEFAULT 'user',
+	totp_secret TEXT NOT NULL DEFAULT '',
+	totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	recovery_codes TEXT[] NOT NULL DEFAULT '{}'
+);
+
+-- Adding the new columns to the tables created before the migrations
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user',
+	ADD COLUMN IF NOT EXISTS totp_secret TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS recovery_codes TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,18 @@
+-- The old single stock balance and price are moved to the default company after this migration
+CREATE TABLE IF NOT EXISTS companies (
+	ticker VARCHAR(16) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	price DOUBLE PRECISION,
+	price_updated_at TIMESTAMP WITH TIME ZONE,
+	dividend_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS holdings (
+	user_id BIGINT NOT NULL REFERENCES users (id),
+	ticker VARCHAR(16) NOT NULL REFERENCES companies (ticker),
+	amount BIGINT NOT NULL DEFAULT 0 CHECK (amount >= 0),
+	PRIMARY KEY (user_id, ticker)
+);
+
+CREATE INDEX IF NOT EXISTS holdings_ticker ON holdings (ticker);
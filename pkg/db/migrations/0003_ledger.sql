@@ -0,0 +1,25 @@
+-- The balances the users had before the ledger get opening entries after this migration
+CREATE TABLE IF NOT EXISTS ledger (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id),
+	kind VARCHAR(32) NOT NULL,
+	reference VARCHAR(64) NOT NULL DEFAULT '',
+	ticker VARCHAR(16) NOT NULL DEFAULT '',
+	solids BIGINT NOT NULL DEFAULT 0,
+	stocks BIGINT NOT NULL DEFAULT 0,
+	solid_balance BIGINT NOT NULL,
+	stock_balance BIGINT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ledger_user ON ledger (user_id, id);
+
+-- The entries are never changed or removed
+CREATE OR REPLACE FUNCTION ledger_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'the ledger entries can''t be changed or removed';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_immutable ON ledger;
+CREATE TRIGGER ledger_immutable BEFORE UPDATE OR DELETE ON ledger FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS price_ticks (
+	ticker VARCHAR(16) NOT NULL,
+	time TIMESTAMP WITH TIME ZONE NOT NULL,
+	price DOUBLE PRECISION NOT NULL,
+	volume BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS price_candles (
+	ticker VARCHAR(16) NOT NULL,
+	start TIMESTAMP WITH TIME ZONE NOT NULL,
+	open DOUBLE PRECISION NOT NULL,
+	high DOUBLE PRECISION NOT NULL,
+	low DOUBLE PRECISION NOT NULL,
+	close DOUBLE PRECISION NOT NULL,
+	volume BIGINT NOT NULL DEFAULT 0
+);
+
+-- The old history belongs to the default company
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS ticker VARCHAR(16) NOT NULL DEFAULT 'STK';
+ALTER TABLE price_candles ADD COLUMN IF NOT EXISTS ticker VARCHAR(16) NOT NULL DEFAULT 'STK';
+ALTER TABLE price_candles DROP CONSTRAINT IF EXISTS price_candles_pkey;
+DROP INDEX IF EXISTS price_ticks_time;
+
+CREATE INDEX IF NOT EXISTS price_ticks_ticker_time ON price_ticks (ticker, time);
+CREATE UNIQUE INDEX IF NOT EXISTS price_candles_ticker_start ON price_candles (ticker, start);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS orders (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id),
+	ticker VARCHAR(16) NOT NULL REFERENCES companies (ticker),
+	side VARCHAR(8) NOT NULL,
+	price BIGINT NOT NULL,
+	amount BIGINT NOT NULL,
+	filled BIGINT NOT NULL DEFAULT 0,
+	reserved BIGINT NOT NULL DEFAULT 0,
+	status VARCHAR(16) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- The old orders are orders of the default company
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ticker VARCHAR(16) NOT NULL DEFAULT 'STK' REFERENCES companies (ticker);
+DROP INDEX IF EXISTS orders_open;
+
+CREATE INDEX IF NOT EXISTS orders_user ON orders (user_id);
+CREATE INDEX IF NOT EXISTS orders_open_ticker ON orders (ticker, side, price, created_at) WHERE status = 'open';
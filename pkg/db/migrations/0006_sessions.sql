@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id),
+	token VARCHAR(255) NOT NULL,
+	is_revoked BOOLEAN DEFAULT FALSE,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id),
+	name VARCHAR(255) NOT NULL,
+	hash VARCHAR(255) NOT NULL,
+	scopes TEXT[] NOT NULL,
+	is_revoked BOOLEAN DEFAULT FALSE,
+	expires_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- The time step of the last accepted totp code, the codes can't be used twice
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- The memo of the transfer, the length is checked by the user service
+ALTER TABLE ledger
+	ADD COLUMN IF NOT EXISTS memo TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,202 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+)
+
+// The tests of the balances and the ledger
+var balanceTests = []test{
+	{"balance/update solids", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		usr, err := db.UpdateSolids(ctx, 0, 10, reason)
+		noError(t, err)
+		if usr.SolidBalance != 10 {
+			t.Fatalf("returned %d solids", usr.SolidBalance)
+		}
+
+		usr, err = db.UpdateSolids(ctx, 0, -4, reason)
+		noError(t, err)
+		if usr.SolidBalance != 6 || get(t, db, 0).SolidBalance != 6 {
+			t.Fatalf("want 6 solids, got %d", usr.SolidBalance)
+		}
+	}},
+	{"balance/not enough balance changes nothing", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 5)
+
+		_, err := db.UpdateSolids(ctx, 0, -6, reason)
+		wantError(t, err, db_cfg.NotEnoughBalance)
+
+		_, err = db.UpdateStocks(ctx, 0, company_cfg.DefaultTicker, -1, reason)
+		wantError(t, err, db_cfg.NotEnoughBalance)
+
+		usr := get(t, db, 0)
+		if usr.SolidBalance != 5 || usr.Stocks(company_cfg.DefaultTicker) != 0 {
+			t.Fatalf("got %+v", usr)
+		}
+
+		entries, err := db.GetEntries(ctx, 0, 0, 10)
+		noError(t, err)
+		if len(entries) != 1 {
+			t.Fatalf("want the entry of the solids only, got %v", entries)
+		}
+	}},
+	{"balance/missing user is not found", func(t *testing.T, db db_cfg.DataBase) {
+		_, err := db.UpdateSolids(ctx, 3, 1, reason)
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.UpdateStocks(ctx, 3, company_cfg.DefaultTicker, 1, reason)
+		wantError(t, err, db_cfg.NotFound)
+	}},
+	{"balance/update stocks", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		usr, err := db.UpdateStocks(ctx, 0, company_cfg.DefaultTicker, 3, reason)
+		noError(t, err)
+		if usr.Stocks(company_cfg.DefaultTicker) != 3 {
+			t.Fatalf("returned %v", usr.Holdings)
+		}
+
+		_, err = db.UpdateStocks(ctx, 0, company_cfg.DefaultTicker, -3, reason)
+		noError(t, err)
+		if got := get(t, db, 0).Stocks(company_cfg.DefaultTicker); got != 0 {
+			t.Fatalf("want 0 stocks, got %d", got)
+		}
+	}},
+	{"balance/ledger entries", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		create(t, db, "bob", 0)
+
+		for _, n := range []int64{1, 2, 3} {
+			_, err := db.UpdateSolids(ctx, 0, n, ledger_cfg.Reason{Kind: ledger_cfg.FARM, Reference: "farm"})
+			noError(t, err)
+		}
+		_, err := db.UpdateStocks(ctx, 0, company_cfg.DefaultTicker, 2, reason)
+		noError(t, err)
+		_, err = db.UpdateSolids(ctx, 1, 7, reason)
+		noError(t, err)
+
+		entries, err := db.GetEntries(ctx, 0, 0, 10)
+		noError(t, err)
+		if len(entries) != 4 {
+			t.Fatalf("want 4 entries, got %v", entries)
+		}
+
+		// The newest first
+		stocks := entries[0]
+		if stocks.Ticker != company_cfg.DefaultTicker || stocks.Stocks != 2 || stocks.StockBalance != 2 || stocks.SolidBalance != 6 {
+			t.Fatalf("got stocks entry %v", stocks)
+		}
+		for i, e := range entries[1:] {
+			want := int64(3 - i)
+			if e.UserId != 0 || e.Kind != ledger_cfg.FARM || e.Reference != "farm" || e.Solids != want {
+				t.Fatalf("got solids entry %v", e)
+			}
+			if e.Id >= entries[i].Id {
+				t.Fatalf("entries aren't sorted by id: %v", entries)
+			}
+		}
+
+		limited, err := db.GetEntries(ctx, 0, 0, 2)
+		noError(t, err)
+		if len(limited) != 2 || limited[0].Id != entries[0].Id {
+			t.Fatalf("want the 2 newest entries, got %v", limited)
+		}
+
+		before, err := db.GetEntries(ctx, 0, entries[1].Id, 10)
+		noError(t, err)
+		if len(before) != 2 || before[0].Id != entries[2].Id || before[1].Id != entries[3].Id {
+			t.Fatalf("want the entries before %d, got %v", entries[1].Id, before)
+		}
+	}},
+	{"balance/no drifts", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+		create(t, db, "bob", 0)
+		_, err := db.UpdateStocks(ctx, 1, company_cfg.DefaultTicker, 4, reason)
+		noError(t, err)
+		_, _, err = db.Transfer(ctx, 0, 1, 3, reason)
+		noError(t, err)
+
+		drifts, err := db.GetDrifts(ctx)
+		noError(t, err)
+		if len(drifts) != 0 {
+			t.Fatalf("got drifts %v", drifts)
+		}
+	}},
+	{"balance/correct writes an empty entry", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+
+		usr, err := db.Correct(ctx, 0, "", ledger_cfg.Reason{Kind: ledger_cfg.CORRECTION, Reference: "fix"})
+		noError(t, err)
+		if usr.SolidBalance != 10 {
+			t.Fatalf("want 10 solids, got %d", usr.SolidBalance)
+		}
+
+		entries, err := db.GetEntries(ctx, 0, 0, 1)
+		noError(t, err)
+		if len(entries) != 1 || entries[0].Kind != ledger_cfg.CORRECTION || entries[0].Solids != 0 || entries[0].SolidBalance != 10 {
+			t.Fatalf("got %v", entries)
+		}
+	}},
+	{"balance/transfer", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+		create(t, db, "bob", 1)
+
+		from, to, err := db.Transfer(ctx, 0, 1, 4, ledger_cfg.Reason{Kind: ledger_cfg.TRANSFER, Reference: "t"})
+		noError(t, err)
+		if from.SolidBalance != 6 || to.SolidBalance != 5 {
+			t.Fatalf("returned %d and %d solids", from.SolidBalance, to.SolidBalance)
+		}
+		if get(t, db, 0).SolidBalance != 6 || get(t, db, 1).SolidBalance != 5 {
+			t.Fatal("the transfer isn't saved")
+		}
+
+		for _, id := range []uint64{0, 1} {
+			entries, err := db.GetEntries(ctx, id, 0, 1)
+			noError(t, err)
+			if len(entries) != 1 || entries[0].Kind != ledger_cfg.TRANSFER || entries[0].Reference != "t" {
+				t.Fatalf("user %d got entries %v", id, entries)
+			}
+		}
+	}},
+	{"balance/transfer memo", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+		create(t, db, "bob", 0)
+
+		memo := "for the lunch, спасибо"
+		_, _, err := db.Transfer(ctx, 0, 1, 4, ledger_cfg.Reason{Kind: ledger_cfg.TRANSFER, Reference: "t", Memo: memo})
+		noError(t, err)
+		_, err = db.UpdateSolids(ctx, 1, 1, reason)
+		noError(t, err)
+
+		// Both entries of the transfer have the memo, the other entries have none
+		from, err := db.GetEntries(ctx, 0, 0, 1)
+		noError(t, err)
+		to, err := db.GetEntries(ctx, 1, 0, 2)
+		noError(t, err)
+		if len(from) != 1 || from[0].Memo != memo || len(to) != 2 || to[1].Memo != memo {
+			t.Fatalf("the transfer entries lost the memo: %v %v", from, to)
+		}
+		if to[0].Memo != "" {
+			t.Fatalf("the adjustment entry got the memo %q", to[0].Memo)
+		}
+	}},
+	{"balance/failed transfer changes nothing", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+		create(t, db, "bob", 1)
+
+		_, _, err := db.Transfer(ctx, 0, 1, 11, reason)
+		wantError(t, err, db_cfg.NotEnoughBalance)
+
+		_, _, err = db.Transfer(ctx, 0, 5, 1, reason)
+		wantError(t, err, db_cfg.NotFound)
+
+		if get(t, db, 0).SolidBalance != 10 || get(t, db, 1).SolidBalance != 1 {
+			t.Fatal("a failed transfer changed the balances")
+		}
+	}},
+}
@@ -0,0 +1,168 @@
+package dbtest
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+)
+
+// Creates the company
+func createCompany(t *testing.T, db db_cfg.DataBase, ticker string) company_cfg.Company {
+	t.Helper()
+
+	c := company_cfg.Company{Ticker: ticker, Name: "company " + ticker, DividendRate: 0.5, CreatedAt: time.Now()}
+	err := db.CreateCompany(ctx, c)
+	if err != nil {
+		t.Fatalf("creating company %s: %v", ticker, err)
+	}
+
+	return c
+}
+
+// Gets the tickers of the companies
+func tickers(companies []company_cfg.Company) []string {
+	res := []string{}
+	for _, c := range companies {
+		res = append(res, c.Ticker)
+	}
+	return res
+}
+
+// The tests of the companies
+var companyTests = []test{
+	{"company/default company exists", func(t *testing.T, db db_cfg.DataBase) {
+		c, err := db.GetCompany(ctx, company_cfg.DefaultTicker)
+		noError(t, err)
+		if c.Ticker != company_cfg.DefaultTicker || c.Name != company_cfg.DefaultName || c.DividendRate != company_cfg.DefaultDividendRate {
+			t.Fatalf("got %v", c)
+		}
+	}},
+	{"company/create and get", func(t *testing.T, db db_cfg.DataBase) {
+		want := createCompany(t, db, "ZED")
+		createCompany(t, db, "ABC")
+
+		c, err := db.GetCompany(ctx, "ZED")
+		noError(t, err)
+		if c.Ticker != want.Ticker || c.Name != want.Name || c.DividendRate != want.DividendRate || c.Price != nil || !sameTime(c.CreatedAt, want.CreatedAt) {
+			t.Fatalf("want %v, got %v", want, c)
+		}
+
+		companies, err := db.GetCompanies(ctx)
+		noError(t, err)
+		if got := tickers(companies); !slices.Equal(got, []string{"ABC", company_cfg.DefaultTicker, "ZED"}) {
+			t.Fatalf("got companies %v", got)
+		}
+	}},
+	{"company/creating existing company fails", func(t *testing.T, db db_cfg.DataBase) {
+		createCompany(t, db, "ABC")
+
+		err := db.CreateCompany(ctx, company_cfg.Company{Ticker: "ABC", Name: "other", CreatedAt: time.Now()})
+		if err == nil {
+			t.Fatal("want error, got nil")
+		}
+
+		c, err := db.GetCompany(ctx, "ABC")
+		noError(t, err)
+		if c.Name != "company ABC" {
+			t.Fatalf("the company is replaced: %v", c)
+		}
+	}},
+	{"company/missing company is not found", func(t *testing.T, db db_cfg.DataBase) {
+		_, err := db.GetCompany(ctx, "NONE")
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.GetPrice(ctx, "NONE")
+		wantError(t, err, db_cfg.NotFound)
+
+		err = db.SetPrice(ctx, "NONE", price_cfg.Price{Value: 1, UpdatedAt: time.Now()})
+		wantError(t, err, db_cfg.NotFound)
+	}},
+}
+
+// The tests of the prices
+var priceTests = []test{
+	{"price/set and get", func(t *testing.T, db db_cfg.DataBase) {
+		p, err := db.GetPrice(ctx, company_cfg.DefaultTicker)
+		noError(t, err)
+		if p != nil {
+			t.Fatalf("want no price, got %v", p)
+		}
+
+		want := price_cfg.Price{Value: 12.5, UpdatedAt: time.Now()}
+		noError(t, db.SetPrice(ctx, company_cfg.DefaultTicker, want))
+
+		p, err = db.GetPrice(ctx, company_cfg.DefaultTicker)
+		noError(t, err)
+		if p == nil || p.Value != want.Value || !sameTime(p.UpdatedAt, want.UpdatedAt) {
+			t.Fatalf("want %v, got %v", want, p)
+		}
+
+		c, err := db.GetCompany(ctx, company_cfg.DefaultTicker)
+		noError(t, err)
+		if c.Price == nil || c.Price.Value != want.Value {
+			t.Fatalf("the company has price %v", c.Price)
+		}
+	}},
+	{"price/ticks", func(t *testing.T, db db_cfg.DataBase) {
+		createCompany(t, db, "ABC")
+
+		start := time.Now().Truncate(time.Second)
+		at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Second) }
+
+		// Added out of order
+		for _, i := range []int{2, 0, 3, 1} {
+			noError(t, db.AddTick(ctx, company_cfg.DefaultTicker, price_cfg.Tick{Time: at(i), Price: float64(i), Volume: int64(i)}))
+		}
+		noError(t, db.AddTick(ctx, "ABC", price_cfg.Tick{Time: at(1), Price: 100}))
+
+		ticks, err := db.GetTicks(ctx, company_cfg.DefaultTicker, at(1), at(3))
+		noError(t, err)
+		if len(ticks) != 2 || ticks[0].Price != 1 || ticks[1].Price != 2 || ticks[1].Volume != 2 || !sameTime(ticks[0].Time, at(1)) {
+			t.Fatalf("want the ticks 1 and 2, got %v", ticks)
+		}
+
+		n, err := db.DeleteTicks(ctx, company_cfg.DefaultTicker, at(2))
+		noError(t, err)
+		if n != 2 {
+			t.Fatalf("want 2 deleted ticks, got %d", n)
+		}
+
+		ticks, err = db.GetTicks(ctx, company_cfg.DefaultTicker, at(0), at(10))
+		noError(t, err)
+		if len(ticks) != 2 || ticks[0].Price != 2 || ticks[1].Price != 3 {
+			t.Fatalf("want the ticks 2 and 3, got %v", ticks)
+		}
+
+		ticks, err = db.GetTicks(ctx, "ABC", at(0), at(10))
+		noError(t, err)
+		if len(ticks) != 1 || ticks[0].Price != 100 {
+			t.Fatalf("the ticks of other company changed: %v", ticks)
+		}
+	}},
+	{"price/candles", func(t *testing.T, db db_cfg.DataBase) {
+		start := time.Now().Truncate(time.Minute)
+		at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Minute) }
+		candle := func(i int, price float64) price_cfg.Candle {
+			return price_cfg.Candle{Start: at(i), Open: price, High: price + 1, Low: price - 1, Close: price, Volume: int64(i)}
+		}
+
+		noError(t, db.AddCandles(ctx, company_cfg.DefaultTicker, []price_cfg.Candle{candle(1, 10), candle(0, 5)}))
+		noError(t, db.AddCandles(ctx, company_cfg.DefaultTicker, []price_cfg.Candle{candle(1, 20), candle(2, 30)}))
+
+		candles, err := db.GetCandles(ctx, company_cfg.DefaultTicker, at(0), at(2))
+		noError(t, err)
+		if len(candles) != 2 || candles[0].Open != 5 || candles[1].Open != 20 || candles[1].High != 21 || !sameTime(candles[1].Start, at(1)) {
+			t.Fatalf("want the candles 0 and the replaced 1, got %v", candles)
+		}
+
+		candles, err = db.GetCandles(ctx, company_cfg.DefaultTicker, at(2), at(3))
+		noError(t, err)
+		if len(candles) != 1 || candles[0].Close != 30 {
+			t.Fatalf("want the candle 2, got %v", candles)
+		}
+	}},
+}
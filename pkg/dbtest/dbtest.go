@@ -0,0 +1,133 @@
+// The conformance tests of the data bases, every db_cfg.DataBase implementation runs them in its tests
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The key of the data bases of the tests
+const Key = "dbtest key"
+
+// The data base constructor
+type Constructor interface {
+	New(cfg config.DatabaseCfg, key string) (db_cfg.DataBase, error)
+}
+
+// Gets the config of a new empty data base for one test
+type Config func(t *testing.T) config.DatabaseCfg
+
+// The behavioral test of the data base
+type test struct {
+	name string
+	run  func(t *testing.T, db db_cfg.DataBase)
+}
+
+// All tests
+var tests = [][]test{userTests, queryTests, balanceTests, companyTests, priceTests, orderTests, sessionTests, keyTests, txTests}
+
+// Runs all tests, every test gets a new empty data base
+func Run(t *testing.T, c Constructor, cfg Config) {
+	for _, group := range tests {
+		for _, tt := range group {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.run(t, Open(t, c, cfg))
+			})
+		}
+	}
+}
+
+// Creates and initializes a new data base, it is closed when the test ends
+func Open(t *testing.T, c Constructor, cfg Config) db_cfg.DataBase {
+	t.Helper()
+
+	db, err := c.New(cfg(t), Key)
+	if err != nil {
+		t.Fatalf("creating data base: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Init(context.Background())
+	if err != nil {
+		t.Fatalf("initializing data base: %v", err)
+	}
+
+	return db
+}
+
+// The context of the tests
+var ctx = context.Background()
+
+// The reason of the changes of the tests
+var reason = ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT, Reference: "dbtest"}
+
+// Creates the user with the next id
+func create(t *testing.T, db db_cfg.DataBase, name string, solids int64) user_cfg.User {
+	t.Helper()
+
+	id, err := db.Len(ctx)
+	if err != nil {
+		t.Fatalf("getting length: %v", err)
+	}
+
+	usr := user_cfg.User{Id: id, Name: name, Password: "hash of " + name, CreatedAt: time.Now(), Role: user_cfg.USER}
+	err = db.Create(ctx, usr)
+	if err != nil {
+		t.Fatalf("creating user %s: %v", name, err)
+	}
+
+	if solids != 0 {
+		_, err = db.UpdateSolids(ctx, id, solids, reason)
+		if err != nil {
+			t.Fatalf("adding solids to %s: %v", name, err)
+		}
+		usr.SolidBalance = solids
+	}
+
+	return usr
+}
+
+// Gets the user
+func get(t *testing.T, db db_cfg.DataBase, id uint64) *user_cfg.User {
+	t.Helper()
+
+	usr, err := db.GetOne(ctx, id)
+	if err != nil {
+		t.Fatalf("getting user %d: %v", id, err)
+	}
+
+	return usr
+}
+
+// Checks the error has the name
+func wantError(t *testing.T, err error, name string) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("want %q error, got nil", name)
+	}
+	if got := vanerrors.GetName(err); got != name {
+		t.Fatalf("want %q error, got %q (%v)", name, got, err)
+	}
+}
+
+// Checks there is no error
+func noError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Checks the times are the same (the data bases store microseconds)
+func sameTime(a time.Time, b time.Time) bool {
+	return a.Sub(b).Abs() < time.Millisecond
+}
@@ -0,0 +1,147 @@
+package dbtest
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+)
+
+// Creates the open order, the created time is the offset from the start
+func newOrder(id string, userId uint64, side order_cfg.Side, price int64, start time.Time, offset int) order_cfg.Order {
+	created := start.Add(time.Duration(offset) * time.Second)
+	return order_cfg.Order{
+		Id:        id,
+		UserId:    userId,
+		Ticker:    company_cfg.DefaultTicker,
+		Side:      side,
+		Price:     price,
+		Amount:    2,
+		Reserved:  2 * price,
+		Status:    order_cfg.OPEN,
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+}
+
+// Gets the ids of the orders
+func orderIds(orders []order_cfg.Order) []string {
+	res := []string{}
+	for _, o := range orders {
+		res = append(res, o.Id)
+	}
+	return res
+}
+
+// The reason of the order changes
+var orderReason = ledger_cfg.Reason{Kind: ledger_cfg.ORDER, Reference: "order"}
+
+// The tests of the orders
+var orderTests = []test{
+	{"order/save and get", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 100)
+
+		o := newOrder("a", 0, order_cfg.BUY, 10, time.Now(), 0)
+		users, err := db.SaveOrders(ctx, []order_cfg.Order{o}, []db_cfg.BalanceChange{{Id: 0, Solids: -20, Reason: orderReason}})
+		noError(t, err)
+		if len(users) != 1 || users[0].SolidBalance != 80 {
+			t.Fatalf("returned %v", users)
+		}
+
+		got, err := db.GetOrder(ctx, "a")
+		noError(t, err)
+		if got.UserId != 0 || got.Ticker != o.Ticker || got.Side != o.Side || got.Price != 10 || got.Amount != 2 || got.Reserved != 20 || got.Status != order_cfg.OPEN || !sameTime(got.CreatedAt, o.CreatedAt) {
+			t.Fatalf("want %v, got %v", o, got)
+		}
+
+		// Updating the order
+		o.Filled, o.Reserved, o.Status, o.UpdatedAt = 2, 0, order_cfg.FILLED, o.UpdatedAt.Add(time.Second)
+		_, err = db.SaveOrders(ctx, []order_cfg.Order{o}, []db_cfg.BalanceChange{{Id: 0, Ticker: company_cfg.DefaultTicker, Stocks: 2, Reason: orderReason}})
+		noError(t, err)
+
+		got, err = db.GetOrder(ctx, "a")
+		noError(t, err)
+		if got.Filled != 2 || got.Reserved != 0 || got.Status != order_cfg.FILLED || !sameTime(got.UpdatedAt, o.UpdatedAt) {
+			t.Fatalf("the order isn't updated: %v", got)
+		}
+		if usr := get(t, db, 0); usr.SolidBalance != 80 || usr.Stocks(company_cfg.DefaultTicker) != 2 {
+			t.Fatalf("got %+v", usr)
+		}
+	}},
+	{"order/failed save changes nothing", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+
+		o := newOrder("a", 0, order_cfg.BUY, 10, time.Now(), 0)
+		_, err := db.SaveOrders(ctx, []order_cfg.Order{o}, []db_cfg.BalanceChange{
+			{Id: 0, Solids: -5, Reason: orderReason},
+			{Id: 0, Solids: -15, Reason: orderReason},
+		})
+		wantError(t, err, db_cfg.NotEnoughBalance)
+
+		_, err = db.GetOrder(ctx, "a")
+		wantError(t, err, db_cfg.NotFound)
+		if got := get(t, db, 0).SolidBalance; got != 10 {
+			t.Fatalf("want 10 solids, got %d", got)
+		}
+	}},
+	{"order/missing order is not found", func(t *testing.T, db db_cfg.DataBase) {
+		_, err := db.GetOrder(ctx, "none")
+		wantError(t, err, db_cfg.NotFound)
+	}},
+	{"order/orders of the user", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		create(t, db, "bob", 0)
+
+		start := time.Now()
+		_, err := db.SaveOrders(ctx, []order_cfg.Order{
+			newOrder("a", 0, order_cfg.BUY, 1, start, 0),
+			newOrder("b", 0, order_cfg.SELL, 1, start, 2),
+			newOrder("c", 1, order_cfg.BUY, 1, start, 3),
+			newOrder("d", 0, order_cfg.BUY, 1, start, 1),
+		}, nil)
+		noError(t, err)
+
+		orders, err := db.GetOrders(ctx, 0)
+		noError(t, err)
+		if got := orderIds(orders); !slices.Equal(got, []string{"b", "d", "a"}) {
+			t.Fatalf("want the newest first, got %v", got)
+		}
+	}},
+	{"order/open orders", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		start := time.Now()
+		closed := newOrder("closed", 0, order_cfg.BUY, 50, start, 0)
+		closed.Status = order_cfg.CANCELED
+		other := newOrder("other", 0, order_cfg.BUY, 50, start, 0)
+		other.Ticker = "ABC"
+		createCompany(t, db, "ABC")
+
+		_, err := db.SaveOrders(ctx, []order_cfg.Order{
+			newOrder("b1", 0, order_cfg.BUY, 10, start, 0),
+			newOrder("b2", 0, order_cfg.BUY, 20, start, 1),
+			newOrder("b3", 0, order_cfg.BUY, 10, start, 2),
+			newOrder("s1", 0, order_cfg.SELL, 30, start, 3),
+			newOrder("s2", 0, order_cfg.SELL, 25, start, 4),
+			newOrder("s3", 0, order_cfg.SELL, 30, start, 1),
+			closed, other,
+		}, nil)
+		noError(t, err)
+
+		buys, err := db.GetOpenOrders(ctx, company_cfg.DefaultTicker, order_cfg.BUY)
+		noError(t, err)
+		if got := orderIds(buys); !slices.Equal(got, []string{"b2", "b1", "b3"}) {
+			t.Fatalf("want the highest buy price first, got %v", got)
+		}
+
+		sells, err := db.GetOpenOrders(ctx, company_cfg.DefaultTicker, order_cfg.SELL)
+		noError(t, err)
+		if got := orderIds(sells); !slices.Equal(got, []string{"s2", "s3", "s1"}) {
+			t.Fatalf("want the lowest sell price first, got %v", got)
+		}
+	}},
+}
@@ -0,0 +1,139 @@
+package dbtest
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/query"
+)
+
+// Creates the users of the query tests
+//
+// alice: 10 solids, 5 stocks
+// bob: 20 solids, blocked
+// carol: 30 solids, 1 stock, admin
+// dave: 40 solids, blocked
+func queryUsers(t *testing.T, db db_cfg.DataBase) {
+	t.Helper()
+
+	create(t, db, "alice", 10)
+	create(t, db, "bob", 20)
+	create(t, db, "carol", 30)
+	create(t, db, "dave", 40)
+
+	_, err := db.UpdateStocks(ctx, 0, company_cfg.DefaultTicker, 5, reason)
+	noError(t, err)
+	_, err = db.UpdateStocks(ctx, 2, company_cfg.DefaultTicker, 1, reason)
+	noError(t, err)
+	_, err = db.UpdateBlock(ctx, 1, true)
+	noError(t, err)
+	_, err = db.UpdateBlock(ctx, 3, true)
+	noError(t, err)
+	_, err = db.UpdateRole(ctx, 2, user_cfg.ADMIN)
+	noError(t, err)
+}
+
+// Creates the condition
+func cond(field query.UserField, sign query.Sign, not bool, y any) query.QuerySetting {
+	return query.QuerySetting{Separator: query.NOT_SEPARATOR, Type: field, Sign: sign, Not: not, Y: y}
+}
+
+// The separators
+var (
+	and = query.QuerySetting{Separator: query.AND}
+	or  = query.QuerySetting{Separator: query.OR}
+)
+
+// Gets the names of the users
+func names(users []user_cfg.User) []string {
+	res := []string{}
+	for _, u := range users {
+		res = append(res, u.Name)
+	}
+	return res
+}
+
+// The query and the names of the selected users
+type queryCase struct {
+	name  string
+	query query.Query
+	want  []string
+}
+
+// The query semantics of all data bases
+var queryCases = []queryCase{
+	{"id equal", query.Query{cond(query.ID, query.EQUAL, false, uint64(2))}, []string{"carol"}},
+	{"id not equal", query.Query{cond(query.ID, query.EQUAL, true, uint64(2))}, []string{"alice", "bob", "dave"}},
+	{"name equal", query.Query{cond(query.NAME, query.EQUAL, false, "bob")}, []string{"bob"}},
+	{"name less", query.Query{cond(query.NAME, query.LESS, false, "c")}, []string{"alice", "bob"}},
+	{"solids more", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, int64(20))}, []string{"carol", "dave"}},
+	{"solids not more (less or equal)", query.Query{cond(query.SOLID_BALANCE, query.MORE, true, int64(20))}, []string{"alice", "bob"}},
+	{"solids not less (more or equal)", query.Query{cond(query.SOLID_BALANCE, query.LESS, true, 30)}, []string{"carol", "dave"}},
+	{"unsigned solids", query.Query{cond(query.SOLID_BALANCE, query.LESS, false, uint64(15))}, []string{"alice"}},
+	{"stocks more", query.Query{cond(query.STOCK_BALANCE, query.MORE, false, uint64(0))}, []string{"alice", "carol"}},
+	{"blocked", query.Query{cond(query.IS_BLOCKED, query.EQUAL, false, true)}, []string{"bob", "dave"}},
+	{"role", query.Query{cond(query.ROLE, query.EQUAL, false, string(user_cfg.ADMIN))}, []string{"carol"}},
+	{"created before", query.Query{cond(query.CREATED_AT, query.LESS, false, time.Now().Add(time.Hour))}, []string{"alice", "bob", "carol", "dave"}},
+	{"and", query.Query{cond(query.IS_BLOCKED, query.EQUAL, false, false), and, cond(query.STOCK_BALANCE, query.MORE, false, uint64(0))}, []string{"alice", "carol"}},
+	{"or", query.Query{cond(query.NAME, query.EQUAL, false, "alice"), or, cond(query.NAME, query.EQUAL, false, "dave")}, []string{"alice", "dave"}},
+	{"and before or", query.Query{
+		cond(query.NAME, query.EQUAL, false, "alice"), or,
+		cond(query.IS_BLOCKED, query.EQUAL, false, true), and, cond(query.SOLID_BALANCE, query.MORE, false, int64(30)),
+	}, []string{"alice", "dave"}},
+	{"nothing", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, int64(1000))}, []string{}},
+}
+
+// The tests of the queries
+var queryTests = []test{
+	{"query/get all by", func(t *testing.T, db db_cfg.DataBase) {
+		queryUsers(t, db)
+
+		for _, c := range queryCases {
+			users, err := db.GetAllBy(ctx, c.query)
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			if got := names(users); !slices.Equal(got, c.want) {
+				t.Errorf("%s (%s): want %v, got %v", c.name, c.query, c.want, got)
+			}
+		}
+	}},
+	{"query/get num by limits the users", func(t *testing.T, db db_cfg.DataBase) {
+		queryUsers(t, db)
+
+		q := query.Query{cond(query.SOLID_BALANCE, query.MORE, false, int64(0))}
+		for _, num := range []int{1, 2, 3} {
+			users, err := db.GetNumBy(ctx, q, num)
+			noError(t, err)
+			if got, want := names(users), []string{"alice", "bob", "carol"}[:num]; !slices.Equal(got, want) {
+				t.Errorf("limit %d: want %v, got %v", num, want, got)
+			}
+		}
+
+		users, err := db.GetNumBy(ctx, q, -1)
+		noError(t, err)
+		if len(users) != 4 {
+			t.Errorf("no limit: want 4 users, got %v", names(users))
+		}
+	}},
+	{"query/get one by", func(t *testing.T, db db_cfg.DataBase) {
+		queryUsers(t, db)
+
+		usr, err := db.GetOneBy(ctx, query.Query{cond(query.IS_BLOCKED, query.EQUAL, false, true)})
+		noError(t, err)
+		if usr == nil || usr.Name != "bob" {
+			t.Fatalf("want bob, got %v", usr)
+		}
+
+		usr, err = db.GetOneBy(ctx, query.Query{cond(query.NAME, query.EQUAL, false, "nobody")})
+		noError(t, err)
+		if usr != nil {
+			t.Fatalf("want nil, got %v", usr)
+		}
+	}},
+}
@@ -0,0 +1,156 @@
+package dbtest
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
+)
+
+// The tests of the sessions
+var sessionTests = []test{
+	{"session/create and get", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		want := session_cfg.Session{Id: "s", UserId: 0, Token: "hash", ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+		noError(t, db.CreateSession(ctx, want))
+
+		s, err := db.GetSession(ctx, "s")
+		noError(t, err)
+		if s.UserId != 0 || s.Token != "hash" || s.IsRevoked || !sameTime(s.ExpiresAt, want.ExpiresAt) || !sameTime(s.CreatedAt, want.CreatedAt) {
+			t.Fatalf("want %v, got %v", want, s)
+		}
+	}},
+	{"session/update token", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		noError(t, db.CreateSession(ctx, session_cfg.Session{Id: "s", Token: "old", ExpiresAt: time.Now(), CreatedAt: time.Now()}))
+
+		expires := time.Now().Add(time.Hour)
+		s, err := db.UpdateSessionToken(ctx, "s", "new", expires)
+		noError(t, err)
+
+		got, err := db.GetSession(ctx, "s")
+		noError(t, err)
+		for _, s := range []*session_cfg.Session{s, got} {
+			if s.Token != "new" || !sameTime(s.ExpiresAt, expires) {
+				t.Fatalf("the token isn't updated: %v", s)
+			}
+		}
+	}},
+	{"session/revoke", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		create(t, db, "bob", 0)
+		for _, s := range []session_cfg.Session{{Id: "a1", UserId: 0}, {Id: "a2", UserId: 0}, {Id: "a3", UserId: 0}, {Id: "b1", UserId: 1}} {
+			s.ExpiresAt, s.CreatedAt = time.Now().Add(time.Hour), time.Now()
+			noError(t, db.CreateSession(ctx, s))
+		}
+
+		s, err := db.RevokeSession(ctx, "a1")
+		noError(t, err)
+		if !s.IsRevoked {
+			t.Fatalf("returned %v", s)
+		}
+
+		n, err := db.RevokeSessions(ctx, 0)
+		noError(t, err)
+		if n != 2 {
+			t.Fatalf("want 2 revoked sessions, got %d", n)
+		}
+
+		for id, revoked := range map[string]bool{"a1": true, "a2": true, "a3": true, "b1": false} {
+			s, err := db.GetSession(ctx, id)
+			noError(t, err)
+			if s.IsRevoked != revoked {
+				t.Fatalf("session %s: want revoked %v, got %v", id, revoked, s.IsRevoked)
+			}
+		}
+	}},
+	{"session/missing session is not found", func(t *testing.T, db db_cfg.DataBase) {
+		_, err := db.GetSession(ctx, "none")
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.UpdateSessionToken(ctx, "none", "token", time.Now())
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.RevokeSession(ctx, "none")
+		wantError(t, err, db_cfg.NotFound)
+	}},
+}
+
+// The tests of the api keys
+var keyTests = []test{
+	{"key/create and get", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		want := key_cfg.Key{Id: "k", UserId: 0, Name: "bot", Hash: "hash", Scopes: []key_cfg.Scope{key_cfg.READ, key_cfg.FARM}, ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}
+		noError(t, db.CreateKey(ctx, want))
+
+		k, err := db.GetKey(ctx, "k")
+		noError(t, err)
+		if k.UserId != 0 || k.Name != "bot" || k.Hash != "hash" || k.IsRevoked || !slices.Equal(k.Scopes, want.Scopes) || !sameTime(k.ExpiresAt, want.ExpiresAt) || !sameTime(k.CreatedAt, want.CreatedAt) {
+			t.Fatalf("want %v, got %v", want, k)
+		}
+	}},
+	{"key/zero expiry", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		noError(t, db.CreateKey(ctx, key_cfg.Key{Id: "k", Name: "bot", Hash: "hash", Scopes: []key_cfg.Scope{key_cfg.READ}, CreatedAt: time.Now()}))
+
+		k, err := db.GetKey(ctx, "k")
+		noError(t, err)
+		if !k.ExpiresAt.IsZero() {
+			t.Fatalf("want no expiry, got %s", k.ExpiresAt)
+		}
+	}},
+	{"key/keys of the user", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		create(t, db, "bob", 0)
+
+		start := time.Now()
+		for i, k := range []key_cfg.Key{{Id: "a1", UserId: 0}, {Id: "b1", UserId: 1}, {Id: "a2", UserId: 0}} {
+			k.Name, k.Hash, k.Scopes, k.CreatedAt = k.Id, "hash "+k.Id, []key_cfg.Scope{key_cfg.READ}, start.Add(time.Duration(i)*time.Second)
+			noError(t, db.CreateKey(ctx, k))
+		}
+
+		keys, err := db.GetKeys(ctx, 0)
+		noError(t, err)
+		ids := []string{}
+		for _, k := range keys {
+			ids = append(ids, k.Id)
+		}
+		if !slices.Equal(ids, []string{"a1", "a2"}) {
+			t.Fatalf("want keys a1 and a2, got %v", ids)
+		}
+
+		keys, err = db.GetKeys(ctx, 5)
+		noError(t, err)
+		if len(keys) != 0 {
+			t.Fatalf("want no keys, got %v", keys)
+		}
+	}},
+	{"key/revoke", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		noError(t, db.CreateKey(ctx, key_cfg.Key{Id: "k", Name: "bot", Hash: "hash", Scopes: []key_cfg.Scope{key_cfg.READ}, CreatedAt: time.Now()}))
+
+		k, err := db.RevokeKey(ctx, "k")
+		noError(t, err)
+		if !k.IsRevoked || !slices.Equal(k.Scopes, []key_cfg.Scope{key_cfg.READ}) {
+			t.Fatalf("returned %v", k)
+		}
+
+		k, err = db.GetKey(ctx, "k")
+		noError(t, err)
+		if !k.IsRevoked {
+			t.Fatalf("the key isn't revoked: %v", k)
+		}
+	}},
+	{"key/missing key is not found", func(t *testing.T, db db_cfg.DataBase) {
+		_, err := db.GetKey(ctx, "none")
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.RevokeKey(ctx, "none")
+		wantError(t, err, db_cfg.NotFound)
+	}},
+}
@@ -0,0 +1,141 @@
+package dbtest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The error of the function of the transaction
+const failed = "failed"
+
+// The tests of the transactions
+var txTests = []test{
+	{"tx/commit", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+			_, err := tx.UpdateSolids(ctx, 0, 5, reason)
+			if err != nil {
+				return err
+			}
+			_, err = tx.UpdateName(ctx, 0, "bob")
+			return err
+		})
+		noError(t, err)
+
+		if usr := get(t, db, 0); usr.SolidBalance != 5 || usr.Name != "bob" {
+			t.Fatalf("the changes aren't committed: %+v", usr)
+		}
+	}},
+	{"tx/rollback", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+
+		err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+			_, err := tx.UpdateSolids(ctx, 0, 5, reason)
+			if err != nil {
+				return err
+			}
+
+			// The changes are seen inside the transaction
+			usr, err := tx.GetOne(ctx, 0)
+			if err != nil {
+				return err
+			}
+			if usr.SolidBalance != 15 {
+				t.Errorf("want 15 solids inside the transaction, got %d", usr.SolidBalance)
+			}
+
+			return vanerrors.NewSimple(failed)
+		})
+		wantError(t, err, failed)
+
+		if got := get(t, db, 0).SolidBalance; got != 10 {
+			t.Fatalf("the changes aren't rolled back: %d solids", got)
+		}
+		entries, err := db.GetEntries(ctx, 0, 0, 10)
+		noError(t, err)
+		if len(entries) != 1 {
+			t.Fatalf("the ledger entries aren't rolled back: %v", entries)
+		}
+	}},
+	{"tx/failed operation keeps the transaction", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+
+		err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+			_, err := tx.UpdateSolids(ctx, 0, -20, reason)
+			if vanerrors.GetName(err) != db_cfg.NotEnoughBalance {
+				t.Errorf("want %q error, got %v", db_cfg.NotEnoughBalance, err)
+			}
+
+			_, err = tx.UpdateSolids(ctx, 0, -3, reason)
+			return err
+		})
+		noError(t, err)
+
+		if got := get(t, db, 0).SolidBalance; got != 7 {
+			t.Fatalf("want 7 solids, got %d", got)
+		}
+	}},
+	{"tx/nested rollback", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+			_, err := tx.UpdateSolids(ctx, 0, 1, reason)
+			if err != nil {
+				return err
+			}
+
+			err = tx.WithTx(ctx, func(nested db_cfg.DataBase) error {
+				_, err := nested.UpdateSolids(ctx, 0, 10, reason)
+				if err != nil {
+					return err
+				}
+				return vanerrors.NewSimple(failed)
+			})
+			if vanerrors.GetName(err) != failed {
+				t.Errorf("want %q error, got %v", failed, err)
+			}
+
+			return tx.WithTx(ctx, func(nested db_cfg.DataBase) error {
+				_, err := nested.UpdateSolids(ctx, 0, 100, reason)
+				return err
+			})
+		})
+		noError(t, err)
+
+		if got := get(t, db, 0).SolidBalance; got != 101 {
+			t.Fatalf("want 101 solids, got %d", got)
+		}
+	}},
+	{"tx/concurrent transactions", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		// Reads and writes the balance, the updates are lost without the isolation
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+					usr, err := tx.GetOne(ctx, 0)
+					if err != nil {
+						return err
+					}
+					_, err = tx.UpdateName(ctx, 0, usr.Name+"+")
+					return err
+				})
+				if err != nil {
+					t.Errorf("running transaction: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := len(get(t, db, 0).Name); got != len("alice")+20 {
+			t.Fatalf("want 20 updates, got %d", got-len("alice"))
+		}
+	}},
+}
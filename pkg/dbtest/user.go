@@ -0,0 +1,207 @@
+package dbtest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+)
+
+// The tests of the users
+var userTests = []test{
+	{"user/create and get", func(t *testing.T, db db_cfg.DataBase) {
+		created := time.Now().Add(-time.Hour)
+		usr := user_cfg.User{
+			Id:        0,
+			Name:      "alice",
+			Password:  "hash",
+			CreatedAt: created,
+			Role:      user_cfg.MODERATOR,
+			TwoFactor: user_cfg.TwoFactor{Secret: "secret", Enabled: true, RecoveryCodes: []string{"a", "b"}},
+			Holdings:  user_cfg.Holdings{company_cfg.DefaultTicker: 3},
+		}
+		noError(t, db.Create(ctx, usr))
+
+		got := get(t, db, 0)
+		if got.Id != 0 || got.Name != "alice" || got.Password != "hash" || got.Role != user_cfg.MODERATOR || got.IsBlocked {
+			t.Fatalf("got %+v", got)
+		}
+		if !sameTime(got.CreatedAt, created) || !got.LastFarming.IsZero() {
+			t.Fatalf("got created at %s and last farming %s", got.CreatedAt, got.LastFarming)
+		}
+		if got.TwoFactor.Secret != "secret" || !got.TwoFactor.Enabled || !slices.Equal(got.TwoFactor.RecoveryCodes, []string{"a", "b"}) {
+			t.Fatalf("got two factor %+v", got.TwoFactor)
+		}
+		if got.Stocks(company_cfg.DefaultTicker) != 3 {
+			t.Fatalf("got holdings %v", got.Holdings)
+		}
+	}},
+	{"user/len is the next id", func(t *testing.T, db db_cfg.DataBase) {
+		n, err := db.Len(ctx)
+		noError(t, err)
+		if n != 0 {
+			t.Fatalf("empty data base has length %d", n)
+		}
+
+		create(t, db, "alice", 0)
+		create(t, db, "bob", 0)
+
+		n, err = db.Len(ctx)
+		noError(t, err)
+		if n != 2 {
+			t.Fatalf("want length 2, got %d", n)
+		}
+	}},
+	{"user/concurrent ids", func(t *testing.T, db db_cfg.DataBase) {
+		// Every sign up gets the next id in its transaction
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+					id, err := tx.Len(ctx)
+					if err != nil {
+						return err
+					}
+					return tx.Create(ctx, user_cfg.User{Id: id, Name: fmt.Sprint("user ", i), CreatedAt: time.Now(), Role: user_cfg.USER})
+				})
+				if err != nil {
+					t.Errorf("creating user: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		n, err := db.Len(ctx)
+		noError(t, err)
+		if n != 10 {
+			t.Fatalf("want length 10, got %d", n)
+		}
+	}},
+	{"user/get all", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+		create(t, db, "bob", 0)
+
+		users, err := db.GetAll(ctx)
+		noError(t, err)
+		if len(users) != 2 || users[0].Name != "alice" || users[1].Name != "bob" {
+			t.Fatalf("got %v", users)
+		}
+	}},
+	{"user/missing user is not found", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		_, err := db.GetOne(ctx, 7)
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.UpdateName(ctx, 7, "bob")
+		wantError(t, err, db_cfg.NotFound)
+
+		_, err = db.UpdateLastFarm(ctx, 7)
+		wantError(t, err, db_cfg.NotFound)
+	}},
+	{"user/returned user is a copy", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 10)
+
+		usr := get(t, db, 0)
+		usr.Name = "changed"
+		usr.SolidBalance = 1000
+
+		if got := get(t, db, 0); got.Name != "alice" || got.SolidBalance != 10 {
+			t.Fatalf("changing the returned user changed the data base: %v", got)
+		}
+	}},
+	{"user/updates return the updated user", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		check := func(usr *user_cfg.User, err error, ok func(u *user_cfg.User) bool) {
+			t.Helper()
+			noError(t, err)
+			if !ok(usr) {
+				t.Fatalf("returned %+v", usr)
+			}
+			if got := get(t, db, 0); !ok(got) {
+				t.Fatalf("saved %+v", got)
+			}
+		}
+
+		usr, err := db.UpdateName(ctx, 0, "bob")
+		check(usr, err, func(u *user_cfg.User) bool { return u.Name == "bob" })
+
+		usr, err = db.UpdatePassword(ctx, 0, "new hash")
+		check(usr, err, func(u *user_cfg.User) bool { return u.Password == "new hash" && u.Name == "bob" })
+
+		usr, err = db.UpdateBlock(ctx, 0, true)
+		check(usr, err, func(u *user_cfg.User) bool { return u.IsBlocked })
+
+		usr, err = db.UpdateRole(ctx, 0, user_cfg.ADMIN)
+		check(usr, err, func(u *user_cfg.User) bool { return u.Role == user_cfg.ADMIN })
+
+		tf := user_cfg.TwoFactor{Secret: "s", Enabled: true, RecoveryCodes: []string{"c"}, LastStep: 7}
+		usr, err = db.UpdateTwoFactor(ctx, 0, tf)
+		check(usr, err, func(u *user_cfg.User) bool {
+			return u.TwoFactor.Secret == "s" && u.TwoFactor.Enabled && slices.Equal(u.TwoFactor.RecoveryCodes, tf.RecoveryCodes) && u.TwoFactor.LastStep == 7
+		})
+	}},
+	{"user/update last farm sets last farming", func(t *testing.T, db db_cfg.DataBase) {
+		created := create(t, db, "alice", 0).CreatedAt
+
+		before := time.Now()
+		usr, err := db.UpdateLastFarm(ctx, 0)
+		noError(t, err)
+
+		for _, u := range []*user_cfg.User{usr, get(t, db, 0)} {
+			if u.LastFarming.Before(before.Add(-time.Millisecond)) || u.LastFarming.After(time.Now()) {
+				t.Fatalf("last farming %s isn't now", u.LastFarming)
+			}
+			if !sameTime(u.CreatedAt, created) {
+				t.Fatalf("created at changed from %s to %s", created, u.CreatedAt)
+			}
+		}
+	}},
+	{"user/check key", func(t *testing.T, db db_cfg.DataBase) {
+		ok, err := db.CheckKey(ctx, Key)
+		noError(t, err)
+		if !ok {
+			t.Fatal("the key isn't accepted")
+		}
+
+		ok, err = db.CheckKey(ctx, "wrong")
+		noError(t, err)
+		if ok {
+			t.Fatal("a wrong key is accepted")
+		}
+
+		ok, err = db.CheckKey(ctx, "")
+		noError(t, err)
+		if ok {
+			t.Fatal("an empty key is accepted")
+		}
+	}},
+	{"user/concurrent updates", func(t *testing.T, db db_cfg.DataBase) {
+		create(t, db, "alice", 0)
+
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := db.UpdateSolids(ctx, 0, 1, reason)
+				if err != nil {
+					t.Errorf("updating solids: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := get(t, db, 0).SolidBalance; got != 20 {
+			t.Fatalf("want 20 solids, got %d", got)
+		}
+	}},
+}
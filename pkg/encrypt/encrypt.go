@@ -0,0 +1,87 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorEncrypting = "error encrypting" // error encrypting
+	ErrorDecrypting = "error decrypting" // error decrypting
+	EmptyKey        = "empty key"        // the encryption key isn't set
+)
+
+// The encryption key (the aes-256 key is the sha-256 of it), it is set by the application
+//
+// Nothing is encrypted or decrypted while it is empty
+var (
+	KEY string
+)
+
+// Creates the aes-256-gcm cipher
+func gcm() (cipher.AEAD, error) {
+	if KEY == "" {
+		return nil, vanerrors.NewSimple(EmptyKey)
+	}
+
+	key := sha256.Sum256([]byte(KEY))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypts the text, returns base64 of nonce and cipher text
+func Encrypt(text string) (string, error) {
+	aead, err := gcm()
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorEncrypting, err, vanerrors.EmptyHandler)
+	}
+
+	// Creating nonce
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorEncrypting, err, vanerrors.EmptyHandler)
+	}
+
+	// Encrypting
+	data := aead.Seal(nonce, nonce, []byte(text), nil)
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypts the text encrypted with Encrypt
+func Decrypt(text string) (string, error) {
+	aead, err := gcm()
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorDecrypting, err, vanerrors.EmptyHandler)
+	}
+
+	// Decoding
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorDecrypting, err, vanerrors.EmptyHandler)
+	}
+	if len(data) < aead.NonceSize() {
+		return "", vanerrors.NewSimple(ErrorDecrypting, "data is too short")
+	}
+
+	// Decrypting
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	res, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorDecrypting, err, vanerrors.EmptyHandler)
+	}
+
+	return string(res), nil
+}
@@ -0,0 +1,37 @@
+package encrypt_test
+
+import (
+	"testing"
+
+	"github.com/vandi37/StocksBack/pkg/encrypt"
+	"github.com/vandi37/vanerrors"
+)
+
+func TestEncrypt(t *testing.T) {
+	old := encrypt.KEY
+	defer func() { encrypt.KEY = old }()
+
+	// Nothing is encrypted with the empty key
+	encrypt.KEY = ""
+	_, err := encrypt.Encrypt("secret")
+	if vanerrors.GetName(err) != encrypt.ErrorEncrypting {
+		t.Fatalf("want %q error, got %v", encrypt.ErrorEncrypting, err)
+	}
+
+	encrypt.KEY = "key"
+	text, err := encrypt.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := encrypt.Decrypt(text)
+	if err != nil || got != "secret" {
+		t.Fatalf("want secret, got %q %v", got, err)
+	}
+
+	// The other key doesn't decrypt it
+	encrypt.KEY = "other key"
+	_, err = encrypt.Decrypt(text)
+	if err == nil {
+		t.Fatal("decrypted with the other key")
+	}
+}
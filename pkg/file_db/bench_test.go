@@ -0,0 +1,142 @@
+package file_db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/StocksBack/pkg/query"
+)
+
+// The amount of users of the benchmarks
+const benchUsers = 100_000
+
+// The queries of the benchmarks
+var benchQueries = []struct {
+	name  string
+	query query.Query
+}{
+	// The daily dividends: every 10th user has stocks, every 100th user is blocked
+	{"stock update", query.Query{cond(query.STOCK_BALANCE, query.MORE, false, uint64(0)), and, cond(query.IS_BLOCKED, query.EQUAL, false, false)}},
+	{"richest", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, int64(benchUsers-100))}},
+	{"name", query.Query{cond(query.NAME, query.EQUAL, false, "user 777")}},
+	{"blocked", query.Query{cond(query.IS_BLOCKED, query.EQUAL, false, true)}},
+}
+
+// Opens the memory data base with the users from a fixture, the indexes of the fields are created
+func openBench(b *testing.B, fields []query.UserField) db_cfg.DataBase {
+	b.Helper()
+
+	users := make([]user_cfg.User, benchUsers)
+	for i := range users {
+		users[i] = user_cfg.User{Id: uint64(i), Name: fmt.Sprint("user ", i), SolidBalance: int64(i), IsBlocked: i%100 == 0, Role: user_cfg.USER}
+		if i%10 == 0 {
+			users[i].Holdings = user_cfg.Holdings{company_cfg.DefaultTicker: 1}
+		}
+	}
+
+	// The fixture is a document of the file data base
+	data, err := json.Marshal(map[string]any{"users": users})
+	if err != nil {
+		b.Fatal(err)
+	}
+	name := filepath.Join(b.TempDir(), "fixture.json")
+	err = os.WriteFile(name, data, 0666)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	old := file_db.Indexed
+	file_db.Indexed = fields
+	defer func() { file_db.Indexed = old }()
+
+	db, err := file_db.MemoryConstructor{}.New(config.DatabaseCfg{Name: name}, dbtest.Key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	err = db.Init(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return db
+}
+
+// Compares the queries of all users and of the indexes
+func BenchmarkQuery(b *testing.B) {
+	for _, mode := range []struct {
+		name   string
+		fields []query.UserField
+	}{{"scan", nil}, {"indexed", file_db.Indexed}} {
+		db := openBench(b, mode.fields)
+
+		for _, q := range benchQueries {
+			b.Run(fmt.Sprintf("%s/%s", q.name, mode.name), func(b *testing.B) {
+				for range b.N {
+					_, err := db.GetAllBy(context.Background(), q.query)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Shows the cost of keeping the indexes current
+func BenchmarkUpdate(b *testing.B) {
+	for _, mode := range []struct {
+		name   string
+		fields []query.UserField
+	}{{"scan", nil}, {"indexed", file_db.Indexed}} {
+		db := openBench(b, mode.fields)
+
+		b.Run(mode.name, func(b *testing.B) {
+			for i := range b.N {
+				_, err := db.UpdateSolids(context.Background(), uint64(i%benchUsers), 1, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Shows the cost of undoing the changes of a failed transaction
+func BenchmarkRollback(b *testing.B) {
+	for _, mode := range []struct {
+		name   string
+		fields []query.UserField
+	}{{"scan", nil}, {"indexed", file_db.Indexed}} {
+		db := openBench(b, mode.fields)
+
+		b.Run(mode.name, func(b *testing.B) {
+			for i := range b.N {
+				err := db.WithTx(context.Background(), func(tx db_cfg.DataBase) error {
+					_, err := tx.UpdateSolids(context.Background(), uint64(i%benchUsers), 1, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+					if err != nil {
+						return err
+					}
+					return errRollback
+				})
+				if err != errRollback {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// The error that fails the transactions of the benchmarks
+var errRollback = errors.New("rollback")
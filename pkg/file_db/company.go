@@ -0,0 +1,63 @@
+package file_db
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	CompanyExists = "company exists"
+)
+
+// Finds the company index
+func (db *FileDB) findCompany(ticker string) int {
+	for i, c := range db.companies {
+		if c.Ticker == ticker {
+			return i
+		}
+	}
+	return -1
+}
+
+// Creates a new company
+func (db *FileDB) CreateCompany(ctx context.Context, c company_cfg.Company) error {
+	defer db.lock()()
+
+	if db.findCompany(c.Ticker) >= 0 {
+		return vanerrors.NewSimple(CompanyExists)
+	}
+
+	// Ads the company and saves the data base
+	mark := len(db.undo)
+	put(db.store, &db.companies, len(db.companies), c)
+
+	return db.save(mark, change{Company: &c})
+}
+
+// Selects the company
+func (db *FileDB) GetCompany(ctx context.Context, ticker string) (*company_cfg.Company, error) {
+	defer db.rlock()()
+
+	i := db.findCompany(ticker)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	c := db.companies[i]
+	return &c, nil
+}
+
+// Selects all companies sorted by ticker
+func (db *FileDB) GetCompanies(ctx context.Context) ([]company_cfg.Company, error) {
+	defer db.rlock()()
+
+	res := slices.Clone(db.companies)
+	slices.SortFunc(res, func(a, b company_cfg.Company) int { return strings.Compare(a.Ticker, b.Ticker) })
+	return res, nil
+}
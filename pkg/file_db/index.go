@@ -0,0 +1,169 @@
+package file_db
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/query"
+)
+
+// The indexed user fields, the queries with these fields in the leading comparison don't check all users
+//
+// It is read when the data base is initialized, nil turns the indexes off
+var Indexed = []query.UserField{query.SOLID_BALANCE, query.STOCK_BALANCE, query.NAME, query.IS_BLOCKED}
+
+// The index of the users by the field
+type index interface {
+	// Sets the indexed users
+	build(users []user_cfg.User)
+	// Replaces the old user (nil for a new user) with the saved one (nil for a removed user)
+	set(old *user_cfg.User, usr *user_cfg.User)
+	// Gets the positions of the users in the range
+	span(r query.Range) (int, int)
+	// Gets the ids of the users between the positions
+	ids(i int, j int) []uint64
+}
+
+// The indexed value of the user
+type entry[K any] struct {
+	key K
+	id  uint64
+}
+
+// The users sorted by the value of the field, then by id
+type sortedIndex[K any] struct {
+	key     func(u user_cfg.User) K
+	compare func(x K, y K) int
+	entries []entry[K]
+}
+
+// Creates the index of the field, nil if the field can't be indexed
+func newIndex(field query.UserField) index {
+	switch field {
+	case query.NAME:
+		return &sortedIndex[string]{key: func(u user_cfg.User) string { return u.Name }, compare: strings.Compare}
+	case query.PASSWORD:
+		return &sortedIndex[string]{key: func(u user_cfg.User) string { return u.Password }, compare: strings.Compare}
+	case query.ROLE:
+		return &sortedIndex[string]{key: func(u user_cfg.User) string { return string(u.GetRole()) }, compare: strings.Compare}
+	case query.SOLID_BALANCE:
+		return &sortedIndex[int64]{key: func(u user_cfg.User) int64 { return u.SolidBalance }, compare: cmp.Compare[int64]}
+	case query.STOCK_BALANCE:
+		return &sortedIndex[int64]{key: func(u user_cfg.User) int64 { return u.TotalStocks() }, compare: cmp.Compare[int64]}
+	case query.IS_BLOCKED:
+		return &sortedIndex[bool]{key: func(u user_cfg.User) bool { return u.IsBlocked }, compare: query.CompareBools}
+	case query.LAST_FARMING:
+		return &sortedIndex[time.Time]{key: func(u user_cfg.User) time.Time { return u.LastFarming }, compare: time.Time.Compare}
+	case query.CREATED_AT:
+		return &sortedIndex[time.Time]{key: func(u user_cfg.User) time.Time { return u.CreatedAt }, compare: time.Time.Compare}
+	}
+	return nil
+}
+
+// Compares the entries by the value, then by id
+func (x *sortedIndex[K]) compareEntries(a entry[K], b entry[K]) int {
+	return cmp.Or(x.compare(a.key, b.key), cmp.Compare(a.id, b.id))
+}
+
+// Sets the indexed users
+func (x *sortedIndex[K]) build(users []user_cfg.User) {
+	x.entries = make([]entry[K], len(users))
+	for i, u := range users {
+		x.entries[i] = entry[K]{key: x.key(u), id: u.Id}
+	}
+	slices.SortFunc(x.entries, x.compareEntries)
+}
+
+// Replaces the old user (nil for a new user) with the saved one (nil for a removed user)
+func (x *sortedIndex[K]) set(old *user_cfg.User, usr *user_cfg.User) {
+	// The value isn't changed
+	if old != nil && usr != nil && x.compare(x.key(*old), x.key(*usr)) == 0 {
+		return
+	}
+
+	if old != nil {
+		if i, ok := slices.BinarySearchFunc(x.entries, entry[K]{key: x.key(*old), id: old.Id}, x.compareEntries); ok {
+			x.entries = slices.Delete(x.entries, i, i+1)
+		}
+	}
+
+	if usr != nil {
+		e := entry[K]{key: x.key(*usr), id: usr.Id}
+		if i, ok := slices.BinarySearchFunc(x.entries, e, x.compareEntries); !ok {
+			x.entries = slices.Insert(x.entries, i, e)
+		}
+	}
+}
+
+// Gets the positions of the users in the range
+func (x *sortedIndex[K]) span(r query.Range) (int, int) {
+	i := sort.Search(len(x.entries), func(n int) bool { return r.AfterFrom(x.entries[n].key) })
+	j := sort.Search(len(x.entries), func(n int) bool { return !r.BeforeTo(x.entries[n].key) })
+	return i, max(i, j)
+}
+
+// Gets the ids of the users between the positions
+func (x *sortedIndex[K]) ids(i int, j int) []uint64 {
+	res := make([]uint64, 0, j-i)
+	for _, e := range x.entries[i:j] {
+		res = append(res, e.id)
+	}
+	return res
+}
+
+// Creates the indexes of the users
+func (s *store) buildIndexes() {
+	s.indexes = map[query.UserField]index{}
+	for _, field := range Indexed {
+		x := newIndex(field)
+		if x == nil {
+			continue
+		}
+		x.build(s.data)
+		s.indexes[field] = x
+	}
+}
+
+// Updates the indexes of the changed user, old is the user before the change (nil for a new user), usr is nil for a removed user
+func (s *store) reindex(old *user_cfg.User, usr *user_cfg.User) {
+	for _, x := range s.indexes {
+		x.set(old, usr)
+	}
+}
+
+// Checks is the field indexed
+func (s *store) indexed(field query.UserField) bool {
+	_, ok := s.indexes[field]
+	return ok
+}
+
+// Gets the users the query is run on: the users in the range of the index of the leading comparison or all users
+//
+// The users are sorted by id like all users, so the query finds the same users
+func (s *store) candidates(q query.Query) []user_cfg.User {
+	r, ok := q.Plan(s.indexed)
+	if !ok {
+		return s.data
+	}
+
+	x := s.indexes[r.Field]
+	i, j := x.span(r)
+
+	// Checking all users is faster if the most of them are in the range
+	if (j-i)*2 > len(s.data) {
+		return s.data
+	}
+
+	ids := x.ids(i, j)
+	slices.Sort(ids)
+
+	res := make([]user_cfg.User, len(ids))
+	for n, id := range ids {
+		res[n] = s.data[id]
+	}
+	return res
+}
@@ -0,0 +1,196 @@
+package file_db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/StocksBack/pkg/query"
+	"github.com/vandi37/vanerrors"
+)
+
+// The comparison of the query
+func cond(field query.UserField, sign query.Sign, not bool, y any) query.QuerySetting {
+	return query.QuerySetting{Separator: query.NOT_SEPARATOR, Type: field, Sign: sign, Not: not, Y: y}
+}
+
+// The separators of the query
+var (
+	and = query.QuerySetting{Separator: query.AND}
+	or  = query.QuerySetting{Separator: query.OR}
+)
+
+// The queries checked with and without the indexes
+var indexQueries = []query.Query{
+	{cond(query.SOLID_BALANCE, query.MORE, false, int64(900))},
+	{cond(query.SOLID_BALANCE, query.MORE, true, uint64(50))},
+	{cond(query.SOLID_BALANCE, query.LESS, false, 100.5)},
+	{cond(query.SOLID_BALANCE, query.LESS, true, 990)},
+	{cond(query.SOLID_BALANCE, query.EQUAL, false, int64(500))},
+	{cond(query.SOLID_BALANCE, query.EQUAL, true, int64(500))},
+	{cond(query.SOLID_BALANCE, query.MORE, false, "500")},
+	{cond(query.STOCK_BALANCE, query.MORE, false, uint64(0)), and, cond(query.IS_BLOCKED, query.EQUAL, false, false)},
+	{cond(query.NAME, query.EQUAL, false, "user 7")},
+	{cond(query.NAME, query.LESS, false, "user 2"), and, cond(query.SOLID_BALANCE, query.MORE, false, 300)},
+	{cond(query.IS_BLOCKED, query.EQUAL, false, true)},
+	{cond(query.IS_BLOCKED, query.EQUAL, false, true), or, cond(query.SOLID_BALANCE, query.LESS, false, 10)},
+	{cond(query.ROLE, query.EQUAL, false, string(user_cfg.USER))},
+}
+
+// Opens the memory data base with the indexes of the fields
+func openIndexed(t *testing.T, fields []query.UserField) db_cfg.DataBase {
+	t.Helper()
+
+	old := file_db.Indexed
+	file_db.Indexed = fields
+	defer func() { file_db.Indexed = old }()
+
+	return dbtest.Open(t, file_db.MemoryConstructor{}, func(t *testing.T) config.DatabaseCfg { return config.DatabaseCfg{} })
+}
+
+// Checks the indexed data base finds the same users as checking all users
+func sameResults(t *testing.T, indexed db_cfg.DataBase, scanned db_cfg.DataBase) {
+	t.Helper()
+
+	ctx := context.Background()
+	for _, q := range indexQueries {
+		for _, num := range []int{-1, 1, 5} {
+			want, err := scanned.GetNumBy(ctx, q, num)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := indexed.GetNumBy(ctx, q, num)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, want, func(a, b user_cfg.User) bool { return a.Id == b.Id }) {
+				t.Fatalf("%s (limit %d): want %d users, got %d", q, num, len(want), len(got))
+			}
+		}
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	indexed := openIndexed(t, file_db.Indexed)
+	scanned := openIndexed(t, nil)
+
+	// The changes are made in both data bases
+	ctx := context.Background()
+	r := rand.New(rand.NewPCG(1, 2))
+	both := func(fn func(db db_cfg.DataBase) error) {
+		t.Helper()
+		for _, db := range []db_cfg.DataBase{indexed, scanned} {
+			err := fn(db)
+			if err != nil && !errors.Is(err, errFailed) {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := range uint64(200) {
+		solids, stocks, blocked := r.Int64N(1000), r.Int64N(3), r.IntN(10) == 0
+		both(func(db db_cfg.DataBase) error {
+			err := db.Create(ctx, user_cfg.User{Id: i, Name: fmt.Sprint("user ", i), Role: user_cfg.USER, IsBlocked: blocked})
+			if err != nil {
+				return err
+			}
+			_, err = db.UpdateSolids(ctx, i, solids, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+			if err != nil {
+				return err
+			}
+			_, err = db.UpdateStocks(ctx, i, company_cfg.DefaultTicker, stocks, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+			return err
+		})
+	}
+	sameResults(t, indexed, scanned)
+
+	// The indexes are changed by the updates
+	for range 300 {
+		id, n := r.Uint64N(200), r.Int64N(200)-100
+		switch r.IntN(5) {
+		case 0:
+			both(func(db db_cfg.DataBase) error {
+				_, err := db.UpdateSolids(ctx, id, n, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+				if vanerrors.GetName(err) == db_cfg.NotEnoughBalance {
+					return errFailed
+				}
+				return err
+			})
+		case 1:
+			both(func(db db_cfg.DataBase) error {
+				_, err := db.UpdateBlock(ctx, id, n > 0)
+				return err
+			})
+		case 2:
+			both(func(db db_cfg.DataBase) error {
+				_, err := db.UpdateName(ctx, id, fmt.Sprint("user ", n))
+				return err
+			})
+		case 3:
+			// Both users are changed by one operation
+			both(func(db db_cfg.DataBase) error {
+				_, _, err := db.Transfer(ctx, id, (id+1)%200, n, ledger_cfg.Reason{Kind: ledger_cfg.TRANSFER})
+				if vanerrors.GetName(err) == db_cfg.NotEnoughBalance {
+					return errFailed
+				}
+				return err
+			})
+		case 4:
+			// The changes of the failed transaction are restored
+			both(func(db db_cfg.DataBase) error {
+				return db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+					_, err := tx.UpdateSolids(ctx, id, 1000, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+					if err != nil {
+						return err
+					}
+					return errFailed
+				})
+			})
+		}
+	}
+	sameResults(t, indexed, scanned)
+}
+
+func TestIndexesReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 5)
+	_, err = db.UpdateSolids(context.Background(), 3, 50, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// The indexes have the users of the log
+	db, err = open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	got, err := db.GetAllBy(context.Background(), query.Query{cond(query.SOLID_BALANCE, query.MORE, false, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Id != 3 {
+		t.Fatalf("want user 3, got %v", got)
+	}
+}
+
+// The error of the changes that fail in both data bases
+var errFailed = errors.New("failed")
@@ -0,0 +1,95 @@
+package file_db
+
+import (
+	"context"
+	"slices"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	KeyExists = "key exists"
+)
+
+// Finds the key index
+func (db *FileDB) findKey(id string) int {
+	for i, k := range db.keys {
+		if k.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Creates a new api key
+func (db *FileDB) CreateKey(ctx context.Context, k key_cfg.Key) error {
+	defer db.lock()()
+
+	// Checks the id
+	if db.findKey(k.Id) >= 0 {
+		return vanerrors.NewSimple(KeyExists)
+	}
+
+	// Ads the key and saves the data base
+	mark := len(db.undo)
+	put(db.store, &db.keys, len(db.keys), k)
+
+	return db.save(mark, change{Key: &k})
+}
+
+// Selects the api key by id
+func (db *FileDB) GetKey(ctx context.Context, id string) (*key_cfg.Key, error) {
+	defer db.rlock()()
+
+	i := db.findKey(id)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	k := db.keys[i]
+	k.Scopes = slices.Clone(k.Scopes)
+	return &k, nil
+}
+
+// Selects all api keys of the user
+func (db *FileDB) GetKeys(ctx context.Context, userId uint64) ([]key_cfg.Key, error) {
+	defer db.rlock()()
+
+	var res []key_cfg.Key
+	for _, k := range db.keys {
+		if k.UserId == userId {
+			k.Scopes = slices.Clone(k.Scopes)
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+// Revokes the api key
+func (db *FileDB) RevokeKey(ctx context.Context, id string) (*key_cfg.Key, error) {
+	defer db.lock()()
+
+	i := db.findKey(id)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	// Updating key
+	k := db.keys[i]
+	k.IsRevoked = true
+
+	// Saving the data base
+	mark := len(db.undo)
+	put(db.store, &db.keys, i, k)
+
+	err := db.save(mark, change{Key: &k})
+	if err != nil {
+		return nil, err
+	}
+
+	k.Scopes = slices.Clone(k.Scopes)
+	return &k, nil
+}
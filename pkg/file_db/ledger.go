@@ -0,0 +1,167 @@
+package file_db
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// Applies the balance changes and writes the ledger entries, the changes are journaled
+//
+// Returns the changed users and the written entries, the changes aren't undone if it fails
+func (db *FileDB) applyChanges(changes []db_cfg.BalanceChange) ([]user_cfg.User, []ledger_cfg.Entry, error) {
+	now := time.Now()
+
+	users := make([]user_cfg.User, 0, len(changes))
+	entries := []ledger_cfg.Entry{}
+	for _, c := range changes {
+		if c.Id >= uint64(len(db.data)) {
+			return nil, nil, vanerrors.NewSimple(db_cfg.NotFound)
+		}
+
+		usr := db.data[c.Id]
+		if usr.SolidBalance+c.Solids < 0 || usr.Stocks(c.Ticker)+c.Stocks < 0 {
+			return nil, nil, vanerrors.NewSimple(db_cfg.NotEnoughBalance)
+		}
+
+		usr.SolidBalance += c.Solids
+		usr.AddStocks(c.Ticker, c.Stocks)
+		db.putUser(usr)
+		users = append(users, usr)
+
+		// Writes the ledger entry
+		if c.Solids != 0 || c.Stocks != 0 {
+			e := ledger_cfg.NewEntry(usr, c.Reason, c.Ticker, c.Solids, c.Stocks, now)
+			e.Id = uint64(len(db.ledger)) + 1
+			put(db.store, &db.ledger, len(db.ledger), e)
+			entries = append(entries, e)
+		}
+	}
+
+	return users, entries, nil
+}
+
+// Applies the balance changes with one save
+func (db *FileDB) updateBalances(changes ...db_cfg.BalanceChange) ([]user_cfg.User, error) {
+	mark := len(db.undo)
+
+	users, entries, err := db.applyChanges(changes)
+	if err != nil {
+		db.rollback(mark)
+		return nil, err
+	}
+
+	// Saving the data base, the changes are undone if saving fails
+	err = db.save(mark, balanceChanges(users, entries)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Writes the opening entries of the users without ledger entries (the balances they had before the ledger)
+func (db *FileDB) openLedger() {
+	recorded := map[uint64]bool{}
+	for _, e := range db.ledger {
+		recorded[e.UserId] = true
+	}
+
+	now := time.Now()
+	for _, usr := range db.data {
+		if recorded[usr.Id] {
+			continue
+		}
+
+		for _, e := range ledger_cfg.Opening(usr, now) {
+			e.Id = uint64(len(db.ledger)) + 1
+			db.ledger = append(db.ledger, e)
+		}
+	}
+}
+
+// Selects the ledger entries of the user with the id less then before (all if before is zero), the newest first
+func (db *FileDB) GetEntries(ctx context.Context, userId uint64, before uint64, limit int) ([]ledger_cfg.Entry, error) {
+	defer db.rlock()()
+
+	res := []ledger_cfg.Entry{}
+
+	// The ids are the positions in the ledger
+	end := len(db.ledger)
+	if before > 0 && before <= uint64(end) {
+		end = int(before) - 1
+	}
+
+	for i := end - 1; i >= 0 && (limit <= 0 || len(res) < limit); i-- {
+		if db.ledger[i].UserId == userId {
+			res = append(res, db.ledger[i])
+		}
+	}
+
+	return res, nil
+}
+
+// Compares the stored balances of all users with the sums of the ledger entries
+func (db *FileDB) GetDrifts(ctx context.Context) ([]ledger_cfg.Drift, error) {
+	defer db.rlock()()
+
+	sums := ledger_cfg.Sums(db.ledger)
+
+	res := []ledger_cfg.Drift{}
+	for _, usr := range db.data {
+		res = append(res, ledger_cfg.Compare(usr, sums[usr.Id])...)
+	}
+
+	return res, nil
+}
+
+// Sets the solids (the empty ticker) or the stocks of the company of the user to the sum of the ledger entries with one save
+func (db *FileDB) Correct(ctx context.Context, id uint64, ticker string, reason ledger_cfg.Reason) (*user_cfg.User, error) {
+	defer db.lock()()
+
+	// Checking id
+	if id >= uint64(len(db.data)) {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	// Sums the ledger of the user
+	var sum int64
+	for _, e := range db.ledger {
+		if e.UserId != id {
+			continue
+		}
+		if ticker == "" {
+			sum += e.Solids
+		} else if e.Ticker == ticker {
+			sum += e.Stocks
+		}
+	}
+
+	// Sets the balance to the ledger
+	usr := db.data[id]
+	if ticker == "" {
+		usr.SolidBalance = sum
+	} else {
+		usr.AddStocks(ticker, sum-usr.Stocks(ticker))
+	}
+
+	// Writes the entry without changes
+	e := ledger_cfg.NewEntry(usr, reason, ticker, 0, 0, time.Now())
+	e.Id = uint64(len(db.ledger)) + 1
+
+	// Saving the data base, the changes are undone if saving fails
+	mark := len(db.undo)
+	db.putUser(usr)
+	put(db.store, &db.ledger, len(db.ledger), e)
+
+	err := db.save(mark, change{User: &usr}, change{Entry: &e})
+	if err != nil {
+		return nil, err
+	}
+
+	return &usr, nil
+}
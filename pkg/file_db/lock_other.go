@@ -0,0 +1,10 @@
+//go:build !unix
+
+package file_db
+
+import "os"
+
+// The file isn't locked on the systems without flock
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package file_db
+
+import (
+	"os"
+	"syscall"
+)
+
+// Takes the exclusive advisory lock of the file without waiting, it is released when the file is closed
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
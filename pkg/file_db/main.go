@@ -1,14 +1,26 @@
 package file_db
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"encoding/json"
 	"io"
 	"os"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/vandi37/StocksBack/config/company_cfg"
 	"github.com/vandi37/StocksBack/config/config"
 	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
 	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/hash"
 	"github.com/vandi37/StocksBack/pkg/query"
 	"github.com/vandi37/vanerrors"
 )
@@ -20,115 +32,355 @@ const (
 	ErrorDecodingData = "error decoding data"
 	InvalidQuery      = "invalid query"
 	InvalidId         = "invalid id"
+	AlreadyOpened     = "already opened" // the data base is used by another process
 )
 
-// The file data base
+// The file data base, the data is a json snapshot and a log of the changes after it
+//
+// tx: the data base is locked by WithTx, the changes are written at the end of it, not by every method
 type FileDB struct {
-	*os.File
-	data []user_cfg.User
-	key  string
+	*store
+	tx bool
+}
+
+// The data of the file data base
+//
+// name: the snapshot file, empty if the data is only kept in memory
+// log: the log of the changes after the snapshot (the snapshot file with the .log extension)
+// size, seq, records: the size of the log, the number of the last record and the amount of records in the log
+// pending: the changes of the transaction of WithTx
+// undo: the journal of the changes of the data of the current operation or transaction
+// mu: locks the data for every method and WithTx, the read methods share it
+// fixture: the json document the memory data base is seeded from
+// indexes: the indexes of the users by the Indexed fields
+type store struct {
+	name      string
+	log       *os.File
+	size      int64
+	seq       uint64
+	records   int
+	pending   []change
+	undo      []func()
+	mu        sync.RWMutex
+	fixture   []byte
+	indexes   map[query.UserField]index
+	data      []user_cfg.User
+	sessions  []session_cfg.Session
+	keys      []key_cfg.Key
+	companies []company_cfg.Company
+	ticks     map[string][]price_cfg.Tick
+	candles   map[string][]price_cfg.Candle
+	orders    []order_cfg.Order
+	ledger    []ledger_cfg.Entry
+	key       string
+}
+
+// The document stored in the file
+//
+// Version: the amount of the applied upgrades
+// Sequence: the number of the last log record in the document
+// Price is the price of the old single stock, it is only read
+type document struct {
+	Version   int                   `json:"version"`
+	Sequence  uint64                `json:"sequence"`
+	Users     []user_cfg.User       `json:"users"`
+	Sessions  []session_cfg.Session `json:"sessions"`
+	Keys      []key_cfg.Key         `json:"keys"`
+	Companies []company_cfg.Company `json:"companies"`
+	Price     *price_cfg.Price      `json:"price,omitempty"`
+	Ticks     []tick                `json:"ticks"`
+	Candles   []candle              `json:"candles"`
+	Orders    []order_cfg.Order     `json:"orders"`
+	Ledger    []ledger_cfg.Entry    `json:"ledger"`
+}
+
+// The price change of the company (the old changes have no ticker)
+type tick struct {
+	Ticker string `json:"ticker,omitempty"`
+	price_cfg.Tick
+}
+
+// The minute candle of the company (the old candles have no ticker)
+type candle struct {
+	Ticker string `json:"ticker,omitempty"`
+	price_cfg.Candle
+}
+
+// The old user fields
+type legacyUser struct {
+	StockBalance int64 `json:"stock_balance"`
 }
 
 // The db constructor
 type Constructor struct{}
 
-// Creates a new file data base
+// Creates a new file data base, the name is the snapshot file
 func (c Constructor) New(cfg config.DatabaseCfg, key string) (db_cfg.DataBase, error) {
-	// Opens the file
-	file, err := os.OpenFile(cfg.Name, os.O_RDWR|os.O_CREATE, 0666)
+	// Opens the log
+	log, err := os.OpenFile(cfg.Name+".log", os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, vanerrors.NewWrap(ErrorOpeningFile, err, vanerrors.EmptyHandler)
 	}
 
-	return &FileDB{
-		File: file,
-		data: []user_cfg.User{},
-		key:  key,
-	}, nil
+	// The log is locked until it is closed, so the second process fails (the snapshot is replaced by the compaction, so it can't be locked)
+	err = lockFile(log)
+	if err != nil {
+		log.Close()
+		return nil, vanerrors.NewWrap(AlreadyOpened, err, vanerrors.EmptyHandler)
+	}
+
+	s := newStore(key)
+	s.name, s.log = cfg.Name, log
+	return &FileDB{store: s}, nil
 }
 
-// Created tables (a array of users)
-func (db *FileDB) Init() error {
-	// Decoding data
-	usrArr := []user_cfg.User{}
-	err := json.NewDecoder(db).Decode(&usrArr)
+// Creates the empty data
+func newStore(key string) *store {
+	s := &store{key: key}
+	s.reset()
+	return s
+}
+
+// Removes all data
+func (s *store) reset() {
+	s.data = []user_cfg.User{}
+	s.sessions = []session_cfg.Session{}
+	s.keys = []key_cfg.Key{}
+	s.companies = []company_cfg.Company{}
+	s.ticks = map[string][]price_cfg.Tick{}
+	s.candles = map[string][]price_cfg.Candle{}
+	s.orders = []order_cfg.Order{}
+	s.ledger = []ledger_cfg.Entry{}
+	s.seq = 0
+	s.buildIndexes()
+}
 
-	// setting data
-	db.data = usrArr
+// Locks the data base until the returned function is called, the transaction of WithTx already has the lock
+func (db *FileDB) lock() func() {
+	if db.tx {
+		return func() {}
+	}
 
-	if err == io.EOF {
-		// Saving data if the file is empty
-		err = db.Save()
-		if err != nil {
-			return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
-		}
-	} else if err != nil {
-		return vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+	db.mu.Lock()
+	return func() {
+		db.commit()
+		db.compactIfDue()
+		db.mu.Unlock()
 	}
+}
 
-	return nil
+// Locks the data base for reading until the returned function is called, the transaction of WithTx already has the lock
+func (db *FileDB) rlock() func() {
+	if db.tx {
+		return func() {}
+	}
+
+	db.mu.RLock()
+	return db.mu.RUnlock
 }
 
-// Saves the data in the file
-func (db *FileDB) Save() error {
-	// Marshals data
-	jsonData, err := json.Marshal(db.data)
+// Created tables (a document with users, sessions and keys), the old documents are upgraded
+//
+// The log after the snapshot is replayed and compacted
+func (db *FileDB) Init(ctx context.Context) error {
+	defer db.lock()()
+
+	r, err := db.reader()
+	if err != nil {
+		return err
+	}
+
+	changed, err := db.load(r)
 	if err != nil {
-		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+		return err
 	}
 
-	// Writes at 0 offset
-	_, err = db.WriteAt(jsonData, 0)
+	n, err := db.replay()
 	if err != nil {
-		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+		return err
+	}
+	db.buildIndexes()
+
+	if changed || n > 0 {
+		return db.Compact()
 	}
 
 	return nil
 }
 
-// Created a new user
-func (db *FileDB) Create(usr user_cfg.User) error {
-	// Gets the user data
-	usrArr := db.data
+// Loads the data from the json document, the old documents are upgraded
+//
+// Returns is anything changed
+func (db *FileDB) load(r io.Reader) (bool, error) {
+	// Decoding data
+	var raw json.RawMessage
+	err := json.NewDecoder(r).Decode(&raw)
 
-	// Checks the id
-	if usr.Id != uint64(len(usrArr)) {
-		return vanerrors.NewSimple(InvalidId)
+	if err == io.EOF {
+		// The empty document has the default company
+		db.companies = append(db.companies, company_cfg.Default())
+		return true, nil
+	} else if err != nil {
+		return false, vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
 	}
 
-	// Ads the user
-	usrArr = append(usrArr, usr)
+	// The old files are an array of users
+	var old legacy
+	var version int
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		usrArr := []user_cfg.User{}
+		err = json.Unmarshal(raw, &usrArr)
+		if err != nil {
+			return false, vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+		}
+
+		// setting data
+		db.data = usrArr
+		old.users = raw
+	} else {
+		doc := document{}
+		err = json.Unmarshal(raw, &doc)
+		if err != nil {
+			return false, vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+		}
+
+		version = doc.Version
+		err = checkVersion(version)
+		if err != nil {
+			return false, err
+		}
+		db.seq = doc.Sequence
+
+		// setting data
+		if doc.Users != nil {
+			db.data = doc.Users
+		}
+		if doc.Sessions != nil {
+			db.sessions = doc.Sessions
+		}
+		if doc.Keys != nil {
+			db.keys = doc.Keys
+		}
+		if doc.Companies != nil {
+			db.companies = doc.Companies
+		}
+		for _, t := range doc.Ticks {
+			ticker := cmp.Or(t.Ticker, company_cfg.DefaultTicker)
+			db.ticks[ticker] = append(db.ticks[ticker], t.Tick)
+		}
+		for _, c := range doc.Candles {
+			ticker := cmp.Or(c.Ticker, company_cfg.DefaultTicker)
+			db.candles[ticker] = append(db.candles[ticker], c.Candle)
+		}
+		if doc.Orders != nil {
+			db.orders = doc.Orders
+		}
+		if doc.Ledger != nil {
+			db.ledger = doc.Ledger
+		}
 
-	// Saving users to the data
-	db.data = usrArr
+		var users struct {
+			Users json.RawMessage `json:"users"`
+		}
+		err = json.Unmarshal(raw, &users)
+		if err != nil {
+			return false, vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+		}
+		old.users, old.price = users.Users, doc.Price
+	}
 
-	// Saving the data base
-	err := db.Save()
+	// Upgrading the old document
+	err = db.upgrade(version, old)
 	if err != nil {
-		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+		return false, err
+	}
+
+	return version < len(upgrades), nil
+}
+
+// Creates the default company and moves the old stock balances, the old price and the old orders to it
+func (db *FileDB) migrateStocks(rawUsers json.RawMessage, price *price_cfg.Price) error {
+	// Creates the default company
+	if db.findCompany(company_cfg.DefaultTicker) < 0 {
+		c := company_cfg.Default()
+		c.Price = price
+		db.companies = append(db.companies, c)
+	}
+
+	// Moves the old stock balances
+	if len(rawUsers) > 0 && !bytes.Equal(rawUsers, []byte("null")) {
+		legacy := []legacyUser{}
+		err := json.Unmarshal(rawUsers, &legacy)
+		if err != nil {
+			return err
+		}
+
+		for i, u := range legacy {
+			if i < len(db.data) && u.StockBalance != 0 {
+				db.data[i].AddStocks(company_cfg.DefaultTicker, u.StockBalance)
+			}
+		}
+	}
+
+	// The old orders are orders of the default company
+	for i := range db.orders {
+		if db.orders[i].Ticker == "" {
+			db.orders[i].Ticker = company_cfg.DefaultTicker
+		}
 	}
 
 	return nil
 }
 
+// Gets the document of the data
+func (db *FileDB) document() document {
+	return document{Version: len(upgrades), Sequence: db.seq, Users: db.data, Sessions: db.sessions, Keys: db.keys, Companies: db.companies, Ticks: db.allTicks(), Candles: db.allCandles(), Orders: db.orders, Ledger: db.ledger}
+}
+
+// Created a new user
+func (db *FileDB) Create(ctx context.Context, usr user_cfg.User) error {
+	defer db.lock()()
+
+	// Checks the id
+	if usr.Id != uint64(len(db.data)) {
+		return vanerrors.NewSimple(InvalidId)
+	}
+
+	// Ads the user and saves the data base
+	mark := len(db.undo)
+	db.putUser(usr)
+
+	return db.save(mark, change{User: &usr})
+}
+
 // Gets all users
-func (db *FileDB) GetAll() ([]user_cfg.User, error) {
-	return db.data, nil
+func (db *FileDB) GetAll(ctx context.Context) ([]user_cfg.User, error) {
+	defer db.rlock()()
+
+	// Returns a copy, the users can't be changed without saving
+	return slices.Clone(db.data), nil
 }
 
 // Selecting user by id
-func (db *FileDB) GetOne(id uint64) (*user_cfg.User, error) {
+func (db *FileDB) GetOne(ctx context.Context, id uint64) (*user_cfg.User, error) {
+	defer db.rlock()()
+
 	usrArr := db.data
 	if len(usrArr) <= int(id) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
-	return &usrArr[id], nil
+
+	// Returns a copy, the user can't be changed without saving
+	usr := usrArr[id]
+	return &usr, nil
 }
 
 // Selecting by query with limit
-func (db *FileDB) GetNumBy(q query.Query, num int) ([]user_cfg.User, error) {
-	// Gets the user data
-	usrArr := db.data
+func (db *FileDB) GetNumBy(ctx context.Context, q query.Query, num int) ([]user_cfg.User, error) {
+	defer db.rlock()()
+
+	// Gets the user data, the indexed queries get only the users in the range of the index
+	usrArr := db.candidates(q)
 
 	// If num is les then zero sets it to length of users
 	if num < 0 {
@@ -140,14 +392,14 @@ func (db *FileDB) GetNumBy(q query.Query, num int) ([]user_cfg.User, error) {
 }
 
 // Selects users by query
-func (db *FileDB) GetAllBy(q query.Query) ([]user_cfg.User, error) {
-	return db.GetNumBy(q, -1)
+func (db *FileDB) GetAllBy(ctx context.Context, q query.Query) ([]user_cfg.User, error) {
+	return db.GetNumBy(ctx, q, -1)
 }
 
 // Selects user by query
-func (db *FileDB) GetOneBy(q query.Query) (*user_cfg.User, error) {
+func (db *FileDB) GetOneBy(ctx context.Context, q query.Query) (*user_cfg.User, error) {
 	// Selects one user
-	res, err := db.GetNumBy(q, 1)
+	res, err := db.GetNumBy(ctx, q, 1)
 
 	if err != nil {
 		return nil, err
@@ -162,130 +414,166 @@ func (db *FileDB) GetOneBy(q query.Query) (*user_cfg.User, error) {
 
 // Updates the user
 func (db *FileDB) update(usr user_cfg.User) error {
-	// Gets the user data
-	usrArr := db.data
-
 	// Checks the if the id is valid
-	if len(usrArr) <= int(usr.Id) {
-		return vanerrors.NewSimple(InvalidId)
+	if len(db.data) <= int(usr.Id) {
+		return vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
-	// Updates the user
-	usrArr[usr.Id] = usr
+	// Updates the user and saves the data base
+	mark := len(db.undo)
+	db.putUser(usr)
 
-	// Saving users to the data
-	db.data = usrArr
+	return db.save(mark, change{User: &usr})
+}
+
+// Update solids
+func (db *FileDB) UpdateSolids(ctx context.Context, id uint64, num int64, reason ledger_cfg.Reason) (*user_cfg.User, error) {
+	defer db.lock()()
 
-	// Saving the data base
-	err := db.Save()
+	users, err := db.updateBalances(db_cfg.BalanceChange{Id: id, Solids: num, Reason: reason})
 	if err != nil {
-		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+		return nil, err
 	}
 
-	return nil
+	return &users[0], nil
 }
 
-// Update solids
-func (db *FileDB) UpdateSolids(id uint64, num int64) (*user_cfg.User, error) {
+// Update stocks of the company
+func (db *FileDB) UpdateStocks(ctx context.Context, id uint64, ticker string, num int64, reason ledger_cfg.Reason) (*user_cfg.User, error) {
+	defer db.lock()()
+
+	users, err := db.updateBalances(db_cfg.BalanceChange{Id: id, Ticker: ticker, Stocks: num, Reason: reason})
+	if err != nil {
+		return nil, err
+	}
+
+	return &users[0], nil
+}
+
+// Update name
+func (db *FileDB) UpdateName(ctx context.Context, id uint64, name string) (*user_cfg.User, error) {
+	defer db.lock()()
+
 	// Checking id
 	if id >= uint64(len(db.data)) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
 	// Getting user
 	usr := db.data[id]
 
 	// Updating user
-	usr.SolidBalance += num
+	usr.Name = name
 
 	return &usr, db.update(usr)
 }
 
-// Update stocks
-func (db *FileDB) UpdateStocks(id uint64, num int64) (*user_cfg.User, error) {
+// Update password
+func (db *FileDB) UpdatePassword(ctx context.Context, id uint64, password string) (*user_cfg.User, error) {
+	defer db.lock()()
+
 	// Checking id
 	if id >= uint64(len(db.data)) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
 	// Getting user
 	usr := db.data[id]
 
 	// Updating user
-	usr.StockBalance += num
+	usr.Password = password
 
 	return &usr, db.update(usr)
 }
 
-// Update name
-func (db *FileDB) UpdateName(id uint64, name string) (*user_cfg.User, error) {
+// Changing block
+func (db *FileDB) UpdateBlock(ctx context.Context, id uint64, block bool) (*user_cfg.User, error) {
+	defer db.lock()()
+
 	// Checking id
 	if id >= uint64(len(db.data)) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
 	// Getting user
 	usr := db.data[id]
 
 	// Updating user
-	usr.Name = name
+	usr.IsBlocked = block
 
 	return &usr, db.update(usr)
 }
 
-// Update password
-func (db *FileDB) UpdatePassword(id uint64, password string) (*user_cfg.User, error) {
+// Changing role
+func (db *FileDB) UpdateRole(ctx context.Context, id uint64, role user_cfg.Role) (*user_cfg.User, error) {
+	defer db.lock()()
+
 	// Checking id
 	if id >= uint64(len(db.data)) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
 	// Getting user
 	usr := db.data[id]
 
 	// Updating user
-	usr.Password = password
+	usr.Role = role
 
 	return &usr, db.update(usr)
 }
 
-// Changing block
-func (db *FileDB) UpdateBlock(id uint64, block bool) (*user_cfg.User, error) {
+// Changing two factor authentication data
+func (db *FileDB) UpdateTwoFactor(ctx context.Context, id uint64, tf user_cfg.TwoFactor) (*user_cfg.User, error) {
+	defer db.lock()()
+
 	// Checking id
 	if id >= uint64(len(db.data)) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
 	// Getting user
 	usr := db.data[id]
 
 	// Updating user
-	usr.IsBlocked = block
+	usr.TwoFactor = tf
 
 	return &usr, db.update(usr)
 }
 
 // Changing last farm
-func (db *FileDB) UpdateLastFarm(id uint64) (*user_cfg.User, error) {
+func (db *FileDB) UpdateLastFarm(ctx context.Context, id uint64) (*user_cfg.User, error) {
+	defer db.lock()()
+
 	// Checking id
 	if id >= uint64(len(db.data)) {
-		return nil, vanerrors.NewSimple(InvalidId)
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
 	}
 
 	// Getting user
 	usr := db.data[id]
 
 	// Updating user
-	usr.CreatedAt = time.Now()
+	usr.LastFarming = time.Now()
 
 	return &usr, db.update(usr)
 }
 
 // Gets the length of users
-func (db *FileDB) Len() (uint64, error) {
+func (db *FileDB) Len(ctx context.Context) (uint64, error) {
+	defer db.rlock()()
+
 	return uint64(len(db.data)), nil
 }
 
-func (db *FileDB) CheckKey(key string) (bool, error) {
-	return db.key == key, nil
+// Checks key in constant time, nothing is accepted if the admin key is empty
+func (db *FileDB) CheckKey(ctx context.Context, key string) (bool, error) {
+	return hash.CompareKey(db.key, key), nil
+}
+
+// Closes the log (and unlocks it), the transaction of WithTx and the memory data base don't close anything
+func (db *FileDB) Close() error {
+	if db.tx || db.log == nil {
+		return nil
+	}
+	return db.log.Close()
 }
@@ -0,0 +1,157 @@
+package file_db_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/vanerrors"
+)
+
+func TestFileDB(t *testing.T) {
+	dbtest.Run(t, file_db.Constructor{}, func(t *testing.T) config.DatabaseCfg {
+		return config.DatabaseCfg{Type: "file", Name: filepath.Join(t.TempDir(), "db.json")}
+	})
+}
+
+func TestMemoryDB(t *testing.T) {
+	dbtest.Run(t, file_db.MemoryConstructor{}, func(t *testing.T) config.DatabaseCfg {
+		return config.DatabaseCfg{Type: "memory"}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	// The old document is an array of users with the single stock balance
+	err := os.WriteFile(name, []byte(`[{"id":0,"name":"alice","password":"hash","solid_balance":5,"stock_balance":3}]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrate := func(dryRun bool) []db_cfg.Migration {
+		t.Helper()
+
+		db, err := file_db.Constructor{}.New(config.DatabaseCfg{Name: name}, dbtest.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		migrations, err := db.(db_cfg.Migrator).Migrate(context.Background(), dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return migrations
+	}
+
+	if got := migrate(true); len(got) != 3 || got[0].Version != 1 || got[2].Version != 3 {
+		t.Fatalf("want 3 pending upgrades, got %v", got)
+	}
+	if got := migrate(true); len(got) != 3 {
+		t.Fatalf("dry run applied the upgrades, %d are pending", len(got))
+	}
+	if got := migrate(false); len(got) != 3 {
+		t.Fatalf("want 3 applied upgrades, got %v", got)
+	}
+	if got := migrate(true); len(got) != 0 {
+		t.Fatalf("want no pending upgrades, got %v", got)
+	}
+
+	db := dbtest.Open(t, file_db.Constructor{}, func(t *testing.T) config.DatabaseCfg { return config.DatabaseCfg{Name: name} })
+	usr, err := db.GetOne(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.Role != user_cfg.USER || usr.Stocks(company_cfg.DefaultTicker) != 3 {
+		t.Fatalf("the user isn't upgraded: %+v", usr)
+	}
+	drifts, err := db.GetDrifts(context.Background())
+	if err != nil || len(drifts) != 0 {
+		t.Fatalf("the ledger isn't opened: %v %v", drifts, err)
+	}
+	db.Close()
+
+	// The newer documents can't be read
+	err = os.WriteFile(name, []byte(`{"version":100}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = file_db.Constructor{}.New(config.DatabaseCfg{Name: name}, dbtest.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Init(context.Background())
+	if vanerrors.GetName(err) != file_db.UnknownVersion {
+		t.Fatalf("want %q error, got %v", file_db.UnknownVersion, err)
+	}
+}
+
+func TestAlreadyOpened(t *testing.T) {
+	cfg := config.DatabaseCfg{Name: filepath.Join(t.TempDir(), "db.json")}
+
+	db, err := file_db.Constructor{}.New(cfg, dbtest.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second instance fails without waiting
+	_, err = file_db.Constructor{}.New(cfg, dbtest.Key)
+	if vanerrors.GetName(err) != file_db.AlreadyOpened {
+		t.Fatalf("want %q error, got %v", file_db.AlreadyOpened, err)
+	}
+
+	// The closed data base can be opened again
+	db.Close()
+	db, err = file_db.Constructor{}.New(cfg, dbtest.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+}
+
+func TestGetAllCopy(t *testing.T) {
+	db := dbtest.Open(t, file_db.MemoryConstructor{}, func(t *testing.T) config.DatabaseCfg { return config.DatabaseCfg{} })
+
+	err := db.Create(context.Background(), user_cfg.User{Id: 0, Name: "alice", Role: user_cfg.USER})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := db.GetAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	users[0].Name = "bob"
+
+	usr, err := db.GetOne(context.Background(), 0)
+	if err != nil || usr.Name != "alice" {
+		t.Fatalf("the stored user is changed by the result: %v %v", usr, err)
+	}
+}
+
+func TestEmptyKey(t *testing.T) {
+	db, err := file_db.MemoryConstructor{}.New(config.DatabaseCfg{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// The empty key doesn't sign in as the superadmin
+	ok, err := db.CheckKey(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("the empty key is accepted")
+	}
+}
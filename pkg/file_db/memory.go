@@ -0,0 +1,112 @@
+package file_db
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/query"
+	"github.com/vandi37/vanerrors"
+)
+
+// The memory db constructor, the data is only kept in memory (for tests and ephemeral instances)
+//
+// The name of the config is the optional json fixture the data is seeded from on Init (a document of the file data base)
+type MemoryConstructor struct{}
+
+// Creates a new memory data base
+func (c MemoryConstructor) New(cfg config.DatabaseCfg, key string) (db_cfg.DataBase, error) {
+	var fixture []byte
+	if cfg.Name != "" {
+		var err error
+		fixture, err = os.ReadFile(cfg.Name)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorOpeningFile, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	s := newStore(key)
+	s.fixture = fixture
+	return &FileDB{store: s}, nil
+}
+
+// Gets the json document of the data, it can be restored or used as a fixture
+func (db *FileDB) Snapshot() ([]byte, error) {
+	defer db.rlock()()
+
+	data, err := json.Marshal(db.document())
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+	}
+
+	return data, nil
+}
+
+// The data before Restore, reset replaces the collections, so they aren't copied
+type snapshot struct {
+	data      []user_cfg.User
+	sessions  []session_cfg.Session
+	keys      []key_cfg.Key
+	companies []company_cfg.Company
+	ticks     map[string][]price_cfg.Tick
+	candles   map[string][]price_cfg.Candle
+	orders    []order_cfg.Order
+	ledger    []ledger_cfg.Entry
+	indexes   map[query.UserField]index
+	seq       uint64
+}
+
+// Gets the data before Restore
+func (db *FileDB) snapshot() snapshot {
+	return snapshot{
+		data:      db.data,
+		sessions:  db.sessions,
+		keys:      db.keys,
+		companies: db.companies,
+		ticks:     db.ticks,
+		candles:   db.candles,
+		orders:    db.orders,
+		ledger:    db.ledger,
+		indexes:   db.indexes,
+		seq:       db.seq,
+	}
+}
+
+// Restores the data before Restore
+func (db *FileDB) restore(s snapshot) {
+	db.data, db.sessions, db.keys, db.companies = s.data, s.sessions, s.keys, s.companies
+	db.ticks, db.candles, db.orders, db.ledger = s.ticks, s.candles, s.orders, s.ledger
+	db.indexes, db.seq = s.indexes, s.seq
+}
+
+// Replaces the data with the json document of Snapshot, the data isn't changed if it fails
+func (db *FileDB) Restore(data []byte) error {
+	defer db.lock()()
+
+	s := db.snapshot()
+	db.reset()
+
+	// The new snapshot replaces the log, its records can't be newer than the snapshot
+	_, err := db.load(bytes.NewReader(data))
+	if err == nil {
+		db.buildIndexes()
+		db.seq = max(db.seq, s.seq)
+		err = db.Compact()
+	}
+	if err != nil {
+		// The sequence is restored too, so the next records aren't skipped by the replay
+		db.restore(s)
+		return err
+	}
+
+	return nil
+}
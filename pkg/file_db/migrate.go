@@ -0,0 +1,145 @@
+package file_db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	UnknownVersion = "unknown version" // the document is written by a newer program
+)
+
+// The old data of the document that isn't kept after the upgrades
+//
+// users: the raw users with the old fields
+// price: the price of the old single stock
+type legacy struct {
+	users json.RawMessage
+	price *price_cfg.Price
+}
+
+// The upgrade of the document from the previous version
+type upgrade struct {
+	name string
+	run  func(db *FileDB, old legacy) error
+}
+
+// The upgrades of the document, the version of the document is the amount of applied upgrades
+//
+// The documents without version (and the old arrays of users) have version 0, the new upgrades are added to the end
+var upgrades = []upgrade{
+	{"roles", func(db *FileDB, old legacy) error {
+		// Old users have no role
+		for i := range db.data {
+			db.data[i].Role = db.data[i].GetRole()
+		}
+		return nil
+	}},
+	{"companies", func(db *FileDB, old legacy) error {
+		// Moves the old single stock balance and price to the default company
+		return db.migrateStocks(old.users, old.price)
+	}},
+	{"ledger", func(db *FileDB, old legacy) error {
+		// The balances before the ledger
+		db.openLedger()
+		return nil
+	}},
+}
+
+// Gets the stored snapshot, the memory data base reads the fixture
+func (db *FileDB) reader() (io.Reader, error) {
+	if db.name == "" {
+		return bytes.NewReader(db.fixture), nil
+	}
+
+	// The snapshot is created by the first compaction
+	data, err := os.ReadFile(db.name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, vanerrors.NewWrap(ErrorOpeningFile, err, vanerrors.EmptyHandler)
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+// Gets the version of the stored document, the empty document has the current version
+func (db *FileDB) version() (int, error) {
+	var doc struct {
+		Version int `json:"version"`
+	}
+
+	r, err := db.reader()
+	if err != nil {
+		return 0, err
+	}
+
+	var raw json.RawMessage
+	err = json.NewDecoder(r).Decode(&raw)
+	if err == io.EOF {
+		return len(upgrades), nil
+	} else if err != nil {
+		return 0, vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+	}
+
+	// The old files are an array of users
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		return 0, nil
+	}
+
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+	}
+
+	return doc.Version, checkVersion(doc.Version)
+}
+
+// Checks the program knows the version
+func checkVersion(version int) error {
+	if version < 0 || version > len(upgrades) {
+		return vanerrors.NewSimple(UnknownVersion, fmt.Sprintf("the document has version %d, but the program knows only %d versions", version, len(upgrades)))
+	}
+	return nil
+}
+
+// Upgrades the loaded data from the version to the current version
+func (db *FileDB) upgrade(version int, old legacy) error {
+	for _, u := range upgrades[version:] {
+		err := u.run(db, old)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorDecodingData, err, vanerrors.EmptyHandler)
+		}
+	}
+	return nil
+}
+
+// Upgrades the stored document to the current version and returns the applied upgrades, with dry run only returns them
+//
+// It initializes the data base, so it is used instead of Init
+func (db *FileDB) Migrate(ctx context.Context, dryRun bool) ([]db_cfg.Migration, error) {
+	unlock := db.rlock()
+	version, err := db.version()
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []db_cfg.Migration{}
+	for i, u := range upgrades[version:] {
+		res = append(res, db_cfg.Migration{Version: version + i + 1, Name: u.name})
+	}
+
+	if dryRun {
+		return res, nil
+	}
+
+	return res, db.Init(ctx)
+}
@@ -0,0 +1,105 @@
+package file_db
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/orderbook"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const ()
+
+// Finds the order index
+func (db *FileDB) findOrder(id string) int {
+	for i, o := range db.orders {
+		if o.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Creates or updates the orders and applies the balance changes with one save
+func (db *FileDB) SaveOrders(ctx context.Context, orders []order_cfg.Order, changes []db_cfg.BalanceChange) ([]user_cfg.User, error) {
+	defer db.lock()()
+
+	// Applies the changes
+	mark := len(db.undo)
+	users, entries, err := db.applyChanges(changes)
+	if err != nil {
+		db.rollback(mark)
+		return nil, err
+	}
+
+	// Saves the orders
+	written := balanceChanges(users, entries)
+	for _, o := range orders {
+		i := db.findOrder(o.Id)
+		if i < 0 {
+			i = len(db.orders)
+		}
+		put(db.store, &db.orders, i, o)
+		written = append(written, change{Order: &o})
+	}
+
+	// Saving the data base, the changes are undone if saving fails
+	err = db.save(mark, written...)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Selects the order
+func (db *FileDB) GetOrder(ctx context.Context, id string) (*order_cfg.Order, error) {
+	defer db.rlock()()
+
+	i := db.findOrder(id)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	o := db.orders[i]
+	return &o, nil
+}
+
+// Selects all orders of the user, the newest first
+func (db *FileDB) GetOrders(ctx context.Context, userId uint64) ([]order_cfg.Order, error) {
+	defer db.rlock()()
+
+	res := []order_cfg.Order{}
+	for _, o := range db.orders {
+		if o.UserId == userId {
+			res = append(res, o)
+		}
+	}
+
+	// Sorted like the sql data bases: by created time, then by id
+	slices.SortFunc(res, func(a, b order_cfg.Order) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(a.Id, b.Id))
+	})
+	return res, nil
+}
+
+// Selects the open orders of the company of the side sorted by the price-time priority
+func (db *FileDB) GetOpenOrders(ctx context.Context, ticker string, side order_cfg.Side) ([]order_cfg.Order, error) {
+	defer db.rlock()()
+
+	res := []order_cfg.Order{}
+	for _, o := range db.orders {
+		if o.Ticker == ticker && o.Side == side && o.IsOpen() {
+			res = append(res, o)
+		}
+	}
+
+	orderbook.Sort(res)
+	return res, nil
+}
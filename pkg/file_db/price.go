@@ -0,0 +1,149 @@
+package file_db
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// Gets the stock price of the company, nil if it isn't saved yet
+func (db *FileDB) GetPrice(ctx context.Context, ticker string) (*price_cfg.Price, error) {
+	defer db.rlock()()
+
+	i := db.findCompany(ticker)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	if db.companies[i].Price == nil {
+		return nil, nil
+	}
+	p := *db.companies[i].Price
+	return &p, nil
+}
+
+// Saves the stock price of the company
+func (db *FileDB) SetPrice(ctx context.Context, ticker string, p price_cfg.Price) error {
+	defer db.lock()()
+
+	i := db.findCompany(ticker)
+	if i < 0 {
+		return vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	// Saving the data base
+	c := db.companies[i]
+	c.Price = &p
+
+	mark := len(db.undo)
+	put(db.store, &db.companies, i, c)
+
+	return db.save(mark, change{Company: &c})
+}
+
+// Gets the price changes of all companies sorted by ticker and time
+func (db *FileDB) allTicks() []tick {
+	res := []tick{}
+	for _, ticker := range slices.Sorted(maps.Keys(db.ticks)) {
+		for _, t := range db.ticks[ticker] {
+			res = append(res, tick{Ticker: ticker, Tick: t})
+		}
+	}
+	return res
+}
+
+// Gets the minute candles of all companies sorted by ticker and time
+func (db *FileDB) allCandles() []candle {
+	res := []candle{}
+	for _, ticker := range slices.Sorted(maps.Keys(db.candles)) {
+		for _, c := range db.candles[ticker] {
+			res = append(res, candle{Ticker: ticker, Candle: c})
+		}
+	}
+	return res
+}
+
+// Adds a price change of the company
+func (db *FileDB) AddTick(ctx context.Context, ticker string, t price_cfg.Tick) error {
+	defer db.lock()()
+
+	// Saving the data base
+	mark := len(db.undo)
+	db.putTick(ticker, t)
+
+	return db.save(mark, change{Tick: &tick{Ticker: ticker, Tick: t}})
+}
+
+// Gets the index of the first tick not before the time
+func tickIndex(ticks []price_cfg.Tick, t time.Time) int {
+	return sort.Search(len(ticks), func(i int) bool { return !ticks[i].Time.Before(t) })
+}
+
+// Selects the price changes of the company from (including) to (excluding)
+func (db *FileDB) GetTicks(ctx context.Context, ticker string, from time.Time, to time.Time) ([]price_cfg.Tick, error) {
+	defer db.rlock()()
+
+	ticks := db.ticks[ticker]
+	i, j := tickIndex(ticks, from), tickIndex(ticks, to)
+	if j < i {
+		j = i
+	}
+	return slices.Clone(ticks[i:j]), nil
+}
+
+// Removes the price changes of the company before the time
+func (db *FileDB) DeleteTicks(ctx context.Context, ticker string, before time.Time) (int64, error) {
+	defer db.lock()()
+
+	mark := len(db.undo)
+	n := db.cutTicks(ticker, before)
+	if n == 0 {
+		return 0, nil
+	}
+
+	// Saving the data base
+	err := db.save(mark, change{DeleteTicks: &tickCut{Ticker: ticker, Before: before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(n), nil
+}
+
+// Gets the index of the first candle not before the time
+func candleIndex(candles []price_cfg.Candle, t time.Time) int {
+	return sort.Search(len(candles), func(i int) bool { return !candles[i].Start.Before(t) })
+}
+
+// Saves the minute candles of the company with one save
+func (db *FileDB) AddCandles(ctx context.Context, ticker string, candles []price_cfg.Candle) error {
+	defer db.lock()()
+
+	mark := len(db.undo)
+	changes := make([]change, 0, len(candles))
+	for _, c := range candles {
+		db.putCandle(ticker, c)
+		changes = append(changes, change{Candle: &candle{Ticker: ticker, Candle: c}})
+	}
+
+	// Saving the data base
+	return db.save(mark, changes...)
+}
+
+// Selects the minute candles of the company from (including) to (excluding)
+func (db *FileDB) GetCandles(ctx context.Context, ticker string, from time.Time, to time.Time) ([]price_cfg.Candle, error) {
+	defer db.rlock()()
+
+	candles := db.candles[ticker]
+	i, j := candleIndex(candles, from), candleIndex(candles, to)
+	if j < i {
+		j = i
+	}
+	return slices.Clone(candles[i:j]), nil
+}
@@ -0,0 +1,124 @@
+package file_db
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	SessionExists = "session exists"
+)
+
+// Finds the session index
+func (db *FileDB) findSession(id string) int {
+	for i, s := range db.sessions {
+		if s.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Creates a new session
+func (db *FileDB) CreateSession(ctx context.Context, s session_cfg.Session) error {
+	defer db.lock()()
+
+	// Checks the id
+	if db.findSession(s.Id) >= 0 {
+		return vanerrors.NewSimple(SessionExists)
+	}
+
+	// Ads the session and saves the data base
+	mark := len(db.undo)
+	put(db.store, &db.sessions, len(db.sessions), s)
+
+	return db.save(mark, change{Session: &s})
+}
+
+// Selects the session by id
+func (db *FileDB) GetSession(ctx context.Context, id string) (*session_cfg.Session, error) {
+	defer db.rlock()()
+
+	i := db.findSession(id)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	s := db.sessions[i]
+	return &s, nil
+}
+
+// Updates the session
+func (db *FileDB) updateSession(id string, fn func(s *session_cfg.Session)) (*session_cfg.Session, error) {
+	i := db.findSession(id)
+	if i < 0 {
+		return nil, vanerrors.NewSimple(db_cfg.NotFound)
+	}
+
+	// Updating session
+	s := db.sessions[i]
+	fn(&s)
+
+	// Saving the data base
+	mark := len(db.undo)
+	put(db.store, &db.sessions, i, s)
+
+	err := db.save(mark, change{Session: &s})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Updates the refresh token of the session
+func (db *FileDB) UpdateSessionToken(ctx context.Context, id string, token string, expiresAt time.Time) (*session_cfg.Session, error) {
+	defer db.lock()()
+
+	return db.updateSession(id, func(s *session_cfg.Session) {
+		s.Token = token
+		s.ExpiresAt = expiresAt
+	})
+}
+
+// Revokes the session
+func (db *FileDB) RevokeSession(ctx context.Context, id string) (*session_cfg.Session, error) {
+	defer db.lock()()
+
+	return db.updateSession(id, func(s *session_cfg.Session) {
+		s.IsRevoked = true
+	})
+}
+
+// Revokes all active sessions of the user
+func (db *FileDB) RevokeSessions(ctx context.Context, userId uint64) (int64, error) {
+	defer db.lock()()
+
+	mark := len(db.undo)
+	changes := []change{}
+	for i, s := range db.sessions {
+		if s.UserId == userId && !s.IsRevoked {
+			s.IsRevoked = true
+			put(db.store, &db.sessions, i, s)
+			changes = append(changes, change{Session: &s})
+		}
+	}
+
+	// Nothing to save
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	// Saving the data base
+	err := db.save(mark, changes...)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(changes)), nil
+}
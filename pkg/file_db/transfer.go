@@ -0,0 +1,23 @@
+package file_db
+
+import (
+	"context"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+)
+
+// Moves solids from one user to another with one save
+func (db *FileDB) Transfer(ctx context.Context, from uint64, to uint64, amount int64, reason ledger_cfg.Reason) (*user_cfg.User, *user_cfg.User, error) {
+	defer db.lock()()
+
+	users, err := db.updateBalances(
+		db_cfg.BalanceChange{Id: from, Solids: -amount, Reason: reason},
+		db_cfg.BalanceChange{Id: to, Solids: amount, Reason: reason},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &users[0], &users[1], nil
+}
@@ -0,0 +1,52 @@
+package file_db
+
+import (
+	"context"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// Runs the function in one transaction, the data base is locked until it ends
+//
+// The changes are written as one log record if the function returns nil, otherwise the journaled changes are undone, the error of the function is returned as it is
+// WithTx of the transaction is nested, only the changes of its function are undone if it fails
+func (db *FileDB) WithTx(ctx context.Context, fn func(tx db_cfg.DataBase) error) error {
+	if db.tx {
+		mark, n := len(db.undo), len(db.pending)
+
+		err := fn(db)
+		if err != nil {
+			db.rollback(mark)
+			db.pending = db.pending[:n]
+		}
+
+		return err
+	}
+
+	defer db.lock()()
+
+	mark := len(db.undo)
+	defer func() { db.pending = nil }()
+
+	// The methods of the transaction don't lock the data base and don't write the log
+	err := fn(&FileDB{store: db.store, tx: true})
+	if err != nil {
+		db.rollback(mark)
+		return err
+	}
+
+	// The changes of a canceled operation aren't saved
+	if ctx.Err() != nil {
+		db.rollback(mark)
+		return ctx.Err()
+	}
+
+	err = db.append(db.pending)
+	if err != nil {
+		db.rollback(mark)
+		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
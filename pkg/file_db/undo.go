@@ -0,0 +1,141 @@
+package file_db
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The changes of the data are journaled: the journal keeps only the old values of the changed records,
+// so a failed operation or transaction is undone without copying the data
+//
+// The journal is cleared when the data base is unlocked
+
+// Records the function that undoes the change
+func (s *store) journal(undo func()) {
+	s.undo = append(s.undo, undo)
+}
+
+// Undoes the changes after the mark (the length of the journal when the operation started)
+func (s *store) rollback(mark int) {
+	for i := len(s.undo) - 1; i >= mark; i-- {
+		s.undo[i]()
+	}
+	clear(s.undo[mark:])
+	s.undo = s.undo[:mark]
+}
+
+// Forgets the journal, the changes are saved
+func (s *store) commit() {
+	clear(s.undo)
+	s.undo = s.undo[:0]
+}
+
+// Writes the changes of the operation started at the mark, the changes of the data are undone if it fails
+func (db *FileDB) save(mark int, changes ...change) error {
+	err := db.write(changes...)
+	if err != nil {
+		db.rollback(mark)
+		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+	}
+	return nil
+}
+
+// Sets the value at the position or appends it (the position is the length), the change is journaled
+func put[T any](s *store, p *[]T, i int, v T) {
+	if i == len(*p) {
+		*p = append(*p, v)
+		s.journal(func() {
+			clear((*p)[i:])
+			*p = (*p)[:i]
+		})
+		return
+	}
+
+	old := (*p)[i]
+	(*p)[i] = v
+	s.journal(func() { (*p)[i] = old })
+}
+
+// Sets the value of the key, the change is journaled
+func putKey[K comparable, V any](s *store, m map[K]V, k K, v V) {
+	old, ok := m[k]
+	m[k] = v
+	s.journal(func() {
+		if ok {
+			m[k] = old
+		} else {
+			delete(m, k)
+		}
+	})
+}
+
+// Sets the user (the user with the next id is added), the change is journaled with the indexes
+func (s *store) putUser(usr user_cfg.User) {
+	if usr.Id == uint64(len(s.data)) {
+		s.data = append(s.data, usr)
+		s.reindex(nil, &usr)
+		s.journal(func() {
+			s.reindex(&usr, nil)
+			clear(s.data[usr.Id:])
+			s.data = s.data[:usr.Id]
+		})
+		return
+	}
+
+	old := s.data[usr.Id]
+	s.data[usr.Id] = usr
+	s.reindex(&old, &usr)
+	s.journal(func() {
+		s.data[usr.Id] = old
+		s.reindex(&usr, &old)
+	})
+}
+
+// Adds the price change of the company, the changes stay sorted by time
+//
+// The changes are appended in place, only the changes before the last one are copied
+func (s *store) putTick(ticker string, t price_cfg.Tick) {
+	ticks := s.ticks[ticker]
+	if n := len(ticks); n == 0 || !t.Time.Before(ticks[n-1].Time) {
+		putKey(s, s.ticks, ticker, append(ticks, t))
+		return
+	}
+
+	// After the changes with the same time
+	i := sort.Search(len(ticks), func(i int) bool { return ticks[i].Time.After(t.Time) })
+	putKey(s, s.ticks, ticker, slices.Insert(slices.Clone(ticks), i, t))
+}
+
+// Removes the price changes of the company before the time, returns the amount of removed changes
+func (s *store) cutTicks(ticker string, before time.Time) int {
+	ticks := s.ticks[ticker]
+	i := tickIndex(ticks, before)
+	if i > 0 {
+		putKey(s, s.ticks, ticker, slices.Clone(ticks[i:]))
+	}
+	return i
+}
+
+// Adds the minute candle of the company, the candle with the same start is replaced
+//
+// The candles are changed in place, only the candles before the last one are copied
+func (s *store) putCandle(ticker string, c price_cfg.Candle) {
+	candles := s.candles[ticker]
+	i := candleIndex(candles, c.Start)
+
+	switch {
+	case i < len(candles) && candles[i].Start.Equal(c.Start):
+		old := candles[i]
+		candles[i] = c
+		s.journal(func() { candles[i] = old })
+	case i == len(candles):
+		putKey(s, s.candles, ticker, append(candles, c))
+	default:
+		putKey(s, s.candles, ticker, slices.Insert(slices.Clone(candles), i, c))
+	}
+}
@@ -0,0 +1,316 @@
+package file_db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorWritingLog = "error writing log"
+	ErrorReadingLog = "error reading log"
+	ErrorCompacting = "error compacting"
+	CorruptedLog    = "corrupted log" // a record before the end of the log is damaged
+)
+
+// The amount of log records after that the data is compacted to a new snapshot
+var CompactAfter = 1000
+
+// The change of the data written to the log, only one field is set
+//
+// The users, companies, orders, sessions and keys are the saved values, the ledger entries and the ticks are added
+type change struct {
+	User        *user_cfg.User       `json:"user,omitempty"`
+	Entry       *ledger_cfg.Entry    `json:"entry,omitempty"`
+	Company     *company_cfg.Company `json:"company,omitempty"`
+	Order       *order_cfg.Order     `json:"order,omitempty"`
+	Session     *session_cfg.Session `json:"session,omitempty"`
+	Key         *key_cfg.Key         `json:"key,omitempty"`
+	Tick        *tick                `json:"tick,omitempty"`
+	DeleteTicks *tickCut             `json:"delete_ticks,omitempty"`
+	Candle      *candle              `json:"candle,omitempty"`
+}
+
+// The removal of the price changes of the company before the time
+type tickCut struct {
+	Ticker string    `json:"ticker"`
+	Before time.Time `json:"before"`
+}
+
+// The record of the log, the changes of one operation or transaction
+//
+// Seq: the number of the record, the snapshot has the number of the last record it contains
+type record struct {
+	Seq     uint64   `json:"seq"`
+	Changes []change `json:"changes"`
+}
+
+// Gets the changes of the saved users and the written ledger entries
+func balanceChanges(users []user_cfg.User, entries []ledger_cfg.Entry) []change {
+	res := make([]change, 0, len(users)+len(entries))
+	for _, u := range users {
+		res = append(res, change{User: &u})
+	}
+	for _, e := range entries {
+		res = append(res, change{Entry: &e})
+	}
+	return res
+}
+
+// Writes the changes of one operation, the transaction of WithTx writes all its changes when it ends
+func (db *FileDB) write(changes ...change) error {
+	if db.tx {
+		db.pending = append(db.pending, changes...)
+		return nil
+	}
+	return db.append(changes)
+}
+
+// Appends the record with the changes to the log and syncs it
+//
+// Every record is one line: the crc-32 of the json, a space and the json
+func (db *FileDB) append(changes []change) error {
+	if db.log == nil || len(changes) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(record{Seq: db.seq + 1, Changes: changes})
+	if err != nil {
+		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+	}
+	line := fmt.Appendf(nil, "%08x %s\n", crc32.ChecksumIEEE(data), data)
+
+	_, err = db.log.Write(line)
+	if err == nil {
+		err = db.log.Sync()
+	}
+	if err != nil {
+		// The part of the record that is written is removed, so the next records aren't after a damaged one
+		db.log.Truncate(db.size)
+		db.log.Seek(db.size, io.SeekStart)
+		return vanerrors.NewWrap(ErrorWritingLog, err, vanerrors.EmptyHandler)
+	}
+
+	db.size += int64(len(line))
+	db.seq++
+	db.records++
+
+	return nil
+}
+
+// Compacts the data after CompactAfter records, it is called on unlock when the changes are applied to the data
+//
+// The changes are already saved, so the failed compaction is tried again after the next record
+func (db *FileDB) compactIfDue() {
+	if db.records >= CompactAfter {
+		db.Compact()
+	}
+}
+
+// Parses the record line, the record is damaged if the checksum is wrong
+func parseRecord(line []byte) (record, bool) {
+	sum, data, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return record{}, false
+	}
+
+	want, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil || crc32.ChecksumIEEE(data) != uint32(want) {
+		return record{}, false
+	}
+
+	var r record
+	err = json.Unmarshal(data, &r)
+	return r, err == nil
+}
+
+// Applies the records of the log that aren't in the snapshot
+//
+// The damaged record at the end of the log is a torn write, it is removed, the damaged record before valid records is CorruptedLog
+// Returns the amount of the read records
+func (db *FileDB) replay() (int, error) {
+	if db.log == nil {
+		return 0, nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(db.log, 0, math.MaxInt64))
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorReadingLog, err, vanerrors.EmptyHandler)
+	}
+
+	var size int64
+	var n int
+	for rest := data; len(rest) > 0; {
+		line, after, found := bytes.Cut(rest, []byte("\n"))
+
+		r, ok := parseRecord(line)
+		if !found || !ok {
+			// Checks that only the last record is damaged
+			for _, l := range bytes.Split(after, []byte("\n")) {
+				if _, ok := parseRecord(l); ok {
+					return 0, vanerrors.NewSimple(CorruptedLog, fmt.Sprintf("the record at %d is damaged", size))
+				}
+			}
+			break
+		}
+
+		// The records of the snapshot are skipped
+		if r.Seq > db.seq {
+			if r.Seq != db.seq+1 {
+				return 0, vanerrors.NewSimple(CorruptedLog, fmt.Sprintf("the record %d is after the record %d", r.Seq, db.seq))
+			}
+
+			for _, c := range r.Changes {
+				err = db.apply(c)
+				if err != nil {
+					return 0, err
+				}
+			}
+			db.seq = r.Seq
+		}
+
+		size += int64(len(line)) + 1
+		n++
+		rest = after
+	}
+
+	// Removes the torn write
+	if size < int64(len(data)) {
+		err = db.log.Truncate(size)
+		if err != nil {
+			return 0, vanerrors.NewWrap(ErrorReadingLog, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	_, err = db.log.Seek(size, io.SeekStart)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorReadingLog, err, vanerrors.EmptyHandler)
+	}
+
+	db.size, db.records = size, n
+	return n, nil
+}
+
+// Gets the position of the record or the length if there is no such record
+func position(i int, n int) int {
+	if i < 0 {
+		return n
+	}
+	return i
+}
+
+// Applies the change of the log to the data
+func (db *FileDB) apply(c change) error {
+	switch {
+	case c.User != nil:
+		if c.User.Id > uint64(len(db.data)) {
+			return vanerrors.NewSimple(CorruptedLog, fmt.Sprintf("the user %d is after the user %d", c.User.Id, len(db.data)))
+		}
+		db.putUser(*c.User)
+	case c.Entry != nil:
+		put(db.store, &db.ledger, len(db.ledger), *c.Entry)
+	case c.Company != nil:
+		put(db.store, &db.companies, position(db.findCompany(c.Company.Ticker), len(db.companies)), *c.Company)
+	case c.Order != nil:
+		put(db.store, &db.orders, position(db.findOrder(c.Order.Id), len(db.orders)), *c.Order)
+	case c.Session != nil:
+		put(db.store, &db.sessions, position(db.findSession(c.Session.Id), len(db.sessions)), *c.Session)
+	case c.Key != nil:
+		put(db.store, &db.keys, position(db.findKey(c.Key.Id), len(db.keys)), *c.Key)
+	case c.Tick != nil:
+		db.putTick(c.Tick.Ticker, c.Tick.Tick)
+	case c.DeleteTicks != nil:
+		db.cutTicks(c.DeleteTicks.Ticker, c.DeleteTicks.Before)
+	case c.Candle != nil:
+		db.putCandle(c.Candle.Ticker, c.Candle.Candle)
+	default:
+		return vanerrors.NewSimple(CorruptedLog, "the change is empty")
+	}
+
+	return nil
+}
+
+// Writes a new snapshot of the data and clears the log (the memory data base isn't saved)
+//
+// The snapshot is written to a temporary file that replaces the old one, so the old snapshot is kept if it fails
+func (db *FileDB) Compact() error {
+	if db.tx || db.name == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(db.document())
+	if err != nil {
+		return vanerrors.NewWrap(ErrorEncodingData, err, vanerrors.EmptyHandler)
+	}
+
+	tmp := db.name + ".tmp"
+	err = writeFile(tmp, data)
+	if err != nil {
+		os.Remove(tmp)
+		return vanerrors.NewWrap(ErrorCompacting, err, vanerrors.EmptyHandler)
+	}
+
+	err = os.Rename(tmp, db.name)
+	if err != nil {
+		os.Remove(tmp)
+		return vanerrors.NewWrap(ErrorCompacting, err, vanerrors.EmptyHandler)
+	}
+
+	// The rename is saved with the directory
+	dir, err := os.Open(filepath.Dir(db.name))
+	if err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	// The records are in the snapshot now, they are skipped if clearing the log fails
+	if db.log != nil {
+		err = db.log.Truncate(0)
+		if err == nil {
+			_, err = db.log.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			err = db.log.Sync()
+		}
+		if err != nil {
+			return vanerrors.NewWrap(ErrorCompacting, err, vanerrors.EmptyHandler)
+		}
+		db.size, db.records = 0, 0
+	}
+
+	return nil
+}
+
+// Writes and syncs the file
+func writeFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
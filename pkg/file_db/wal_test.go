@@ -0,0 +1,260 @@
+package file_db_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/vanerrors"
+)
+
+// Opens the file data base without closing it
+func open(t *testing.T, name string) (db_cfg.DataBase, error) {
+	t.Helper()
+
+	db, err := file_db.Constructor{}.New(config.DatabaseCfg{Name: name}, dbtest.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, db.Init(context.Background())
+}
+
+// Creates the users, every user is one log record
+func fill(t *testing.T, db db_cfg.DataBase, n int) {
+	t.Helper()
+
+	for i := range n {
+		err := db.Create(context.Background(), user_cfg.User{Id: uint64(i), Name: "user", Role: user_cfg.USER})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Reads the log lines
+func logLines(t *testing.T, name string) [][]byte {
+	t.Helper()
+
+	data, err := os.ReadFile(name + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+// Checks the amount of users
+func wantUsers(t *testing.T, db db_cfg.DataBase, n uint64) {
+	t.Helper()
+
+	got, err := db.Len(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != n {
+		t.Fatalf("want %d users, got %d", n, got)
+	}
+}
+
+func TestLogReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 3)
+	_, err = db.UpdateSolids(context.Background(), 1, 5, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes are only in the log
+	if n := len(logLines(t, name)); n != 4 {
+		t.Fatalf("want 4 log records, got %d", n)
+	}
+	snapshot, _ := os.ReadFile(name)
+	if bytes.Contains(snapshot, []byte(`"user"`)) {
+		t.Fatal("the snapshot is rewritten by every change")
+	}
+	db.Close()
+
+	db, err = open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	wantUsers(t, db, 3)
+	usr, err := db.GetOne(context.Background(), 1)
+	if err != nil || usr.SolidBalance != 5 {
+		t.Fatalf("the log isn't replayed: %v %v", usr, err)
+	}
+
+	// The replayed log is compacted
+	if data, _ := os.ReadFile(name + ".log"); len(data) != 0 {
+		t.Fatalf("the log isn't compacted: %s", data)
+	}
+}
+
+func TestTornWrite(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 2)
+	db.Close()
+
+	// The last record is written partly
+	lines := logLines(t, name)
+	torn := append(bytes.Join(lines, []byte("\n")), '\n')
+	torn = append(torn, lines[1][:len(lines[1])/2]...)
+	err = os.WriteFile(name+".log", torn, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = open(t, name)
+	if err != nil {
+		t.Fatalf("the torn write isn't removed: %v", err)
+	}
+	wantUsers(t, db, 2)
+
+	// The next records are readable
+	err = db.Create(context.Background(), user_cfg.User{Id: 2, Name: "user", Role: user_cfg.USER})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	wantUsers(t, db, 3)
+}
+
+func TestCorruptedLog(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 2)
+	db.Close()
+
+	// The first record is damaged, the second one is valid
+	lines := logLines(t, name)
+	lines[0] = bytes.Replace(lines[0], []byte(`"user"`), []byte(`"resu"`), 1)
+	err = os.WriteFile(name+".log", append(bytes.Join(lines, []byte("\n")), '\n'), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = open(t, name)
+	defer db.Close()
+	if vanerrors.GetName(err) != file_db.CorruptedLog {
+		t.Fatalf("want %q error, got %v", file_db.CorruptedLog, err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	old := file_db.CompactAfter
+	file_db.CompactAfter = 3
+	defer func() { file_db.CompactAfter = old }()
+
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 7)
+
+	// 6 records are in the snapshot
+	if lines := logLines(t, name); len(lines) != 1 {
+		t.Fatalf("want 1 log record after the compaction, got %d", len(lines))
+	}
+	if _, err := os.Stat(name + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("the temporary snapshot isn't removed: %v", err)
+	}
+	db.Close()
+
+	db, err = open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	wantUsers(t, db, 7)
+}
+
+func TestTransactionRecord(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.WithTx(context.Background(), func(tx db_cfg.DataBase) error {
+		fill(t, tx, 3)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes of the transaction are one record, so they are replayed together or not at all
+	if lines := logLines(t, name); len(lines) != 1 {
+		t.Fatalf("want 1 log record, got %d", len(lines))
+	}
+}
+
+func TestFailedRestore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "db.json")
+
+	db, err := open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 3)
+
+	// The data isn't changed by the failed restore
+	err = db.(*file_db.FileDB).Restore([]byte("{bad"))
+	if err == nil {
+		t.Fatal("the bad document is restored")
+	}
+	_, err = db.UpdateSolids(context.Background(), 1, 500, ledger_cfg.Reason{Kind: ledger_cfg.ADJUSTMENT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// The records after the failed restore are replayed
+	db, err = open(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	wantUsers(t, db, 3)
+	usr, err := db.GetOne(context.Background(), 1)
+	if err != nil || usr.SolidBalance != 500 {
+		t.Fatalf("the record after the failed restore is lost: %v %v", usr, err)
+	}
+}
@@ -1,24 +1,113 @@
 package hash
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"strings"
 
 	"github.com/vandi37/vanerrors"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/sha3"
 )
 
 // The errors
 const (
 	ErrorGettingHash = "error getting hash" // error getting hash
+	InvalidHash      = "invalid hash"       // invalid hash
 )
 
-// The salt
+// The salt of the legacy sha-3-256 hashes
 var (
 	SALT = ""
 )
 
-// A function that's getting the password and returning it's hash (sha-3-256)
+// The argon2id parameters
+var (
+	ArgonTime    uint32 = 1
+	ArgonMemory  uint32 = 64 * 1024
+	ArgonThreads uint8  = 4
+	ArgonKeyLen  uint32 = 32
+	ArgonSaltLen        = 16
+)
+
+// The argon2id hash prefix (PHC string format)
+const (
+	ARGON2ID = "$argon2id$"
+)
+
+// The argon2id hash parameters
+type params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// A function that's getting the password and returning it's hash (argon2id in PHC string format)
+//
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
 func HashPassword(password string) (string, error) {
+	// Creating a random salt
+	salt := make([]byte, ArgonSaltLen)
+	_, err := rand.Read(salt)
+
+	// In case of error returning the error
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorGettingHash, err, vanerrors.EmptyHandler)
+	}
+
+	// Getting the key
+	key := argon2.IDKey([]byte(password), salt, ArgonTime, ArgonMemory, ArgonThreads, ArgonKeyLen)
+
+	// Returning the encoded hash
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		ARGON2ID, argon2.Version, ArgonMemory, ArgonTime, ArgonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Parses the argon2id hash
+func parse(hash string) (*params, []byte, []byte, error) {
+	// $ argon2id $ v=19 $ m=65536,t=1,p=4 $ salt $ hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, vanerrors.NewSimple(InvalidHash, "wrong amount of parts")
+	}
+
+	// Checking version
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, nil, nil, vanerrors.NewSimple(InvalidHash, "unsupported version")
+	}
+
+	// Getting parameters
+	var p params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil {
+		return nil, nil, nil, vanerrors.NewSimple(InvalidHash, "invalid parameters")
+	}
+
+	// Getting salt
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, vanerrors.NewSimple(InvalidHash, "invalid salt")
+	}
+
+	// Getting key
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, vanerrors.NewSimple(InvalidHash, "invalid key")
+	}
+
+	return &p, salt, key, nil
+}
+
+// A function that's getting the legacy hash of the password (sha-3-256 with the global salt)
+func legacyHash(password string) (string, error) {
 	// Creating a 256 byte hash as a slice of bytes
 	hash := sha3.New256()
 	_, err := hash.Write([]byte(password))
@@ -36,15 +125,61 @@ func HashPassword(password string) (string, error) {
 }
 
 // A function to compare hash of a password and the password
+//
+// It accepts argon2id hashes and legacy sha-3-256 hashes
 func CompareHash(password string, hash string) (bool, error) {
-	// Creating the hash of the password string
-	hashedPassword, err := HashPassword(password)
+	// Legacy hash
+	if !strings.HasPrefix(hash, ARGON2ID) {
+		hashedPassword, err := legacyHash(password)
 
-	// In case of error returning the error
+		// In case of error returning the error
+		if err != nil {
+			return false, err
+		}
+
+		return subtle.ConstantTimeCompare([]byte(hashedPassword), []byte(hash)) == 1, nil
+	}
+
+	// Parsing the hash
+	p, salt, key, err := parse(hash)
 	if err != nil {
 		return false, err
 	}
 
+	// Creating the key of the password with the same parameters
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+
 	// Returning true if the hash are the same. If not false
-	return hashedPassword == hash, nil
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// Checks does the hash need to be replaced (it is legacy or has other parameters)
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, ARGON2ID) {
+		return true
+	}
+
+	p, salt, key, err := parse(hash)
+	if err != nil {
+		return true
+	}
+
+	return p.time != ArgonTime || p.memory != ArgonMemory || p.threads != ArgonThreads ||
+		len(salt) != ArgonSaltLen || len(key) != int(ArgonKeyLen)
+}
+
+// A function to hash random tokens (sha-256), they have enough entropy to not need a salt
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// A function to compare the token and it's hash
+func CompareToken(token string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
+
+// A function to compare the secret key in constant time, the empty key matches nothing
+func CompareKey(key string, other string) bool {
+	return key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(other)) == 1
 }
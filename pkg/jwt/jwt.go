@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorSigningToken = "error signing token" // error signing token
+	InvalidToken      = "invalid token"       // invalid token
+	TokenExpired      = "token expired"       // token expired
+)
+
+// The supported algorithm
+const (
+	ALGORITHM = "HS256"
+	TYPE      = "JWT"
+)
+
+// The token header
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// The token claims
+//
+// Subject: the user id
+// Session: the session id
+// IssuedAt: unix time of issuing
+// ExpiresAt: unix time of expiring
+type Claims struct {
+	Subject   uint64 `json:"sub"`
+	Session   string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// The token manager (signs and parses tokens)
+type Manager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// Creates a new token manager
+func New(secret string, ttl time.Duration) *Manager {
+	return &Manager{secret: []byte(secret), ttl: ttl}
+}
+
+// Encodes a part of the token
+func encode(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Decodes a part of the token
+func decode(s string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Signs the data
+func (m *Manager) sign(data string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issues a new access token for the user session
+func (m *Manager) Issue(id uint64, session string) (string, *Claims, error) {
+	now := time.Now()
+	claims := Claims{
+		Subject:   id,
+		Session:   session,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.ttl).Unix(),
+	}
+
+	// Encoding header
+	header, err := encode(Header{Algorithm: ALGORITHM, Type: TYPE})
+	if err != nil {
+		return "", nil, vanerrors.NewWrap(ErrorSigningToken, err, vanerrors.EmptyHandler)
+	}
+
+	// Encoding claims
+	payload, err := encode(claims)
+	if err != nil {
+		return "", nil, vanerrors.NewWrap(ErrorSigningToken, err, vanerrors.EmptyHandler)
+	}
+
+	// Signing
+	data := header + "." + payload
+	return data + "." + m.sign(data), &claims, nil
+}
+
+// Parses the token and checks it's signature and expiry
+func (m *Manager) Parse(token string) (*Claims, error) {
+	// Splitting the token
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, vanerrors.NewSimple(InvalidToken, "token should have 3 parts")
+	}
+
+	// Checking the header
+	var header Header
+	err := decode(parts[0], &header)
+	if err != nil {
+		return nil, vanerrors.NewSimple(InvalidToken, "invalid header")
+	}
+	if header.Algorithm != ALGORITHM {
+		return nil, vanerrors.NewSimple(InvalidToken, "unsupported algorithm")
+	}
+
+	// Checking the signature
+	if !hmac.Equal([]byte(m.sign(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, vanerrors.NewSimple(InvalidToken, "invalid signature")
+	}
+
+	// Getting claims
+	var claims Claims
+	err = decode(parts[1], &claims)
+	if err != nil {
+		return nil, vanerrors.NewSimple(InvalidToken, "invalid claims")
+	}
+
+	// Checking expiry
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, vanerrors.NewSimple(TokenExpired)
+	}
+
+	return &claims, nil
+}
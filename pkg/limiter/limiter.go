@@ -0,0 +1,168 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// The failed attempts of one key
+type attempt struct {
+	failures int
+	pending  int
+	until    time.Time
+	locked   bool
+	last     time.Time
+}
+
+// Tracks failed attempts by key with exponential backoff and temporary lockout
+//
+// Backoff: the wait after the first failure, it doubles after every next failure
+// MaxBackoff: the maximum wait between attempts
+// Attempts: the amount of failures before the lockout
+// Lockout: the lockout duration, the failures are also forgotten after it passes without new failures
+// Now: the clock, it could be replaced to check the limiter with a fixed time
+type Limiter struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Attempts   int
+	Lockout    time.Duration
+	Now        func() time.Time
+
+	mu       sync.Mutex
+	attempts map[string]*attempt
+	clean    int
+}
+
+// The minimum amount of keys before the stale keys are cleaned
+const cleanSize = 1024
+
+// The minimum wait of the attempts refused while the other attempts of the key are verified
+const pendingWait = time.Second
+
+// Creates a new limiter
+func New(backoff time.Duration, maxBackoff time.Duration, attempts int, lockout time.Duration) *Limiter {
+	return &Limiter{
+		Backoff:    backoff,
+		MaxBackoff: maxBackoff,
+		Attempts:   attempts,
+		Lockout:    lockout,
+		Now:        time.Now,
+		attempts:   map[string]*attempt{},
+		clean:      cleanSize,
+	}
+}
+
+// Checks is the attempt stale (it could be forgotten), the attempts being verified aren't stale
+func (l *Limiter) stale(a *attempt, now time.Time) bool {
+	return a.pending == 0 && !now.Before(a.until) && now.Sub(a.last) >= l.Lockout
+}
+
+// Reserves the attempt of the key before it is verified, returns the time to wait and is the key locked
+//
+// The attempt is allowed if the wait is 0, then it must be released after the verification (and failed before if it fails).
+// The pending attempts count as failures, so the parallel attempts can't pass the backoff:
+// a key without failures has at most Attempts pending attempts, a key with failures has at most one
+func (l *Limiter) Reserve(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	l.cleanStale(now)
+
+	a, ok := l.attempts[key]
+	if !ok {
+		a = &attempt{}
+		l.attempts[key] = a
+	}
+
+	// The lockout passed, starting again
+	if a.locked && !now.Before(a.until) {
+		*a = attempt{pending: a.pending}
+	}
+
+	if now.Before(a.until) {
+		return a.until.Sub(now), a.locked
+	}
+
+	// The other attempts are verified
+	if a.failures+a.pending >= l.Attempts || (a.failures > 0 && a.pending > 0) {
+		return max(l.Backoff, pendingWait), false
+	}
+
+	a.pending++
+	return 0, false
+}
+
+// Releases the reserved attempt of the key
+func (l *Limiter) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok || a.pending == 0 {
+		return
+	}
+
+	a.pending--
+	if a.failures == 0 && a.pending == 0 {
+		delete(l.attempts, key)
+	}
+}
+
+// Adds a failed attempt, returns the time to wait and is the key locked by this failure
+func (l *Limiter) Fail(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	l.cleanStale(now)
+
+	a, ok := l.attempts[key]
+	if !ok || l.stale(a, now) {
+		a = &attempt{}
+		l.attempts[key] = a
+	}
+
+	a.failures++
+	a.last = now
+
+	// Locks the key
+	if a.failures >= l.Attempts {
+		a.locked = true
+		a.until = now.Add(l.Lockout)
+		return l.Lockout, true
+	}
+
+	// Gets the backoff
+	wait := l.Backoff
+	for i := 1; i < a.failures && wait < l.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, l.MaxBackoff)
+
+	a.until = now.Add(wait)
+	return wait, false
+}
+
+// Forgets the failed attempts of the key
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, key)
+}
+
+// Removes the stale keys, it runs only if there are a lot of keys
+func (l *Limiter) cleanStale(now time.Time) {
+	if len(l.attempts) < l.clean {
+		return
+	}
+
+	for key, a := range l.attempts {
+		if l.stale(a, now) {
+			delete(l.attempts, key)
+		}
+	}
+
+	l.clean = max(cleanSize, len(l.attempts)*2)
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/vandi37/vanerrors/vanstack"
@@ -52,8 +53,13 @@ type Logger struct {
 	levelMap map[LogLevel]string
 }
 
-// Creates a logger with pairs
+// Creates a logger with pairs, the logs directory is created if it doesn't exist
 func New() *Logger {
+	err := os.MkdirAll(filepath.Dir(INFO_a_WARN), 0777)
+	if err != nil {
+		panic(err)
+	}
+
 	wIaW, err := os.OpenFile(INFO_a_WARN, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
 		panic(err)
@@ -72,6 +78,17 @@ func New() *Logger {
 	return &logger
 }
 
+// Creates a logger writing all levels to the writer (for tests and ephemeral instances)
+func NewWriter(w io.Writer) *Logger {
+	return &Logger{
+		wInfo:    w,
+		wWarn:    w,
+		wError:   w,
+		wFatal:   w,
+		levelMap: StringLogLevel,
+	}
+}
+
 func writeln(w io.Writer, prefix string, a []any) {
 	fmt.Fprintln(w, append([]any{prefix, time.Now().Format(FORMAT)}, a...)...)
 }
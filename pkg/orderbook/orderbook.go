@@ -0,0 +1,166 @@
+package orderbook
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+)
+
+// The result of placing an order
+//
+// Orders: the changed orders, the placed order is the last
+// Fills: the trades
+// Changes: the balance changes of the users (the reserve of the placed order and the settlement of the trades)
+type Match struct {
+	Orders  []order_cfg.Order
+	Fills   []order_cfg.Fill
+	Changes []db_cfg.BalanceChange
+}
+
+// The price level of the book
+type Level struct {
+	Price  int64 `json:"price"`
+	Amount int64 `json:"amount"`
+	Orders int   `json:"orders"`
+}
+
+// Sorts the orders of one side by the price-time priority
+func Sort(orders []order_cfg.Order) {
+	slices.SortFunc(orders, func(a, b order_cfg.Order) int {
+		if a.Before(b) {
+			return -1
+		} else if b.Before(a) {
+			return 1
+		}
+		return 0
+	})
+}
+
+// Checks can the orders trade
+func crosses(o order_cfg.Order, other order_cfg.Order) bool {
+	if o.Side == order_cfg.BUY {
+		return o.Price >= other.Price
+	}
+	return o.Price <= other.Price
+}
+
+// Matches the new order with the open orders of the same company of the other side (sorted by the price-time priority)
+//
+// The trades are done at the price of the resting order, the orders of the same user are skipped
+// The id of the new order is the ledger reference of all balance changes
+func Place(o order_cfg.Order, book []order_cfg.Order, now time.Time) Match {
+	changes := map[uint64]*db_cfg.BalanceChange{}
+	change := func(id uint64) *db_cfg.BalanceChange {
+		if changes[id] == nil {
+			changes[id] = &db_cfg.BalanceChange{Id: id, Ticker: o.Ticker, Reason: ledger_cfg.Reason{Kind: ledger_cfg.ORDER, Reference: o.Id}}
+		}
+		return changes[id]
+	}
+
+	// Reserves the funds of the new order
+	if o.Side == order_cfg.BUY {
+		change(o.UserId).Solids -= o.Reserved
+	} else {
+		change(o.UserId).Stocks -= o.Reserved
+	}
+
+	res := Match{}
+
+	for _, other := range book {
+		if o.Rest() == 0 || !crosses(o, other) {
+			break
+		}
+		if other.UserId == o.UserId || !other.IsOpen() {
+			continue
+		}
+
+		// Trades
+		amount := min(o.Rest(), other.Rest())
+		price := other.Price
+
+		buy, sell := &o, &other
+		if o.Side == order_cfg.SELL {
+			buy, sell = &other, &o
+		}
+
+		// The buyer gets stocks and the difference of the reserve
+		buy.Filled += amount
+		buy.Reserved -= amount * buy.Price
+		change(buy.UserId).Stocks += amount
+		change(buy.UserId).Solids += amount * (buy.Price - price)
+
+		// The seller gets solids
+		sell.Filled += amount
+		sell.Reserved -= amount
+		change(sell.UserId).Solids += amount * price
+
+		// Closes the filled order
+		if other.Rest() == 0 {
+			other.Status = order_cfg.FILLED
+		}
+		other.UpdatedAt = now
+
+		res.Orders = append(res.Orders, other)
+		res.Fills = append(res.Fills, order_cfg.Fill{Buy: buy.Id, Sell: sell.Id, Price: price, Amount: amount})
+	}
+
+	if o.Rest() == 0 {
+		o.Status = order_cfg.FILLED
+	}
+	o.UpdatedAt = now
+	res.Orders = append(res.Orders, o)
+
+	// Gets the changes sorted by user id
+	for _, c := range changes {
+		if c.Solids != 0 || c.Stocks != 0 {
+			res.Changes = append(res.Changes, *c)
+		}
+	}
+	slices.SortFunc(res.Changes, func(a, b db_cfg.BalanceChange) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+
+	return res
+}
+
+// Cancels the open order, returns the order with the balance change returning the reserve
+func Cancel(o order_cfg.Order, now time.Time) (order_cfg.Order, db_cfg.BalanceChange) {
+	change := db_cfg.BalanceChange{Id: o.UserId, Ticker: o.Ticker, Reason: ledger_cfg.Reason{Kind: ledger_cfg.ORDER, Reference: o.Id}}
+	if o.Side == order_cfg.BUY {
+		change.Solids = o.Reserved
+	} else {
+		change.Stocks = o.Reserved
+	}
+
+	o.Reserved = 0
+	o.Status = order_cfg.CANCELED
+	o.UpdatedAt = now
+
+	return o, change
+}
+
+// Gets the price levels of the open orders of one side (sorted by the price-time priority)
+func Depth(orders []order_cfg.Order, levels int) []Level {
+	res := []Level{}
+
+	for _, o := range orders {
+		if !o.IsOpen() {
+			continue
+		}
+		if len(res) > 0 && res[len(res)-1].Price == o.Price {
+			res[len(res)-1].Amount += o.Rest()
+			res[len(res)-1].Orders++
+			continue
+		}
+		if len(res) == levels {
+			break
+		}
+		res = append(res, Level{Price: o.Price, Amount: o.Rest(), Orders: 1})
+	}
+
+	return res
+}
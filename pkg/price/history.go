@@ -0,0 +1,113 @@
+package price
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGettingHistory    = "error getting history"
+	ErrorDownsamplingTicks = "error downsampling ticks"
+)
+
+// The smallest candle interval, the old ticks are stored as candles of it
+const Minute = time.Minute
+
+// Creates the candles of the ticks (sorted by time)
+func Candles(ticks []price_cfg.Tick, interval time.Duration) []price_cfg.Candle {
+	res := []price_cfg.Candle{}
+
+	for _, t := range ticks {
+		start := t.Time.Truncate(interval)
+		if len(res) > 0 && res[len(res)-1].Start.Equal(start) {
+			res[len(res)-1].Add(t.Candle(start))
+			continue
+		}
+		res = append(res, t.Candle(start))
+	}
+
+	return res
+}
+
+// Merges the candles (sorted by time) into candles of a bigger interval
+func Merge(candles []price_cfg.Candle, interval time.Duration) []price_cfg.Candle {
+	res := []price_cfg.Candle{}
+
+	for _, c := range candles {
+		start := c.Start.Truncate(interval)
+		if len(res) > 0 && res[len(res)-1].Start.Equal(start) {
+			res[len(res)-1].Add(c)
+			continue
+		}
+		c.Start = start
+		res = append(res, c)
+	}
+
+	return res
+}
+
+// Gets the candles of the company of the interval between from and to
+//
+// The stored minute candles (old ticks) and the ticks are merged
+func History(ctx context.Context, ticker string, interval time.Duration, from time.Time, to time.Time, db db_cfg.DataBase) ([]price_cfg.Candle, error) {
+	// Gets the whole intervals
+	from = from.Truncate(interval)
+
+	// Gets the stored candles
+	candles, err := db.GetCandles(ctx, ticker, from, to)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorGettingHistory, err, vanerrors.EmptyHandler)
+	}
+
+	// Gets the ticks
+	ticks, err := db.GetTicks(ctx, ticker, from, to)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorGettingHistory, err, vanerrors.EmptyHandler)
+	}
+
+	// The ticks are always newer than the stored candles
+	candles = append(candles, Candles(ticks, Minute)...)
+
+	return Merge(candles, interval), nil
+}
+
+// Replaces the ticks of the company older than the retention with minute candles in one transaction, returns the amount of removed ticks
+func (e *Engine) Downsample(ctx context.Context, ticker string, retention time.Duration, db db_cfg.DataBase) (int64, error) {
+	// Gets the old ticks (only whole minutes)
+	before := e.Now().Add(-retention).Truncate(Minute)
+
+	var n int64
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		ticks, err := tx.GetTicks(ctx, ticker, time.Time{}, before)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorDownsamplingTicks, err, vanerrors.EmptyHandler)
+		}
+		if len(ticks) == 0 {
+			return nil
+		}
+
+		// Saves the candles
+		err = tx.AddCandles(ctx, ticker, Candles(ticks, Minute))
+		if err != nil {
+			return vanerrors.NewWrap(ErrorDownsamplingTicks, err, vanerrors.EmptyHandler)
+		}
+
+		// Removes the ticks
+		n, err = tx.DeleteTicks(ctx, ticker, before)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorDownsamplingTicks, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,223 @@
+package price
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGettingPrice = "error getting price"
+	ErrorSavingPrice  = "error saving price"
+	TradeIsTooBig     = "trade is too big"
+)
+
+// The price engine
+//
+// The price moves on a bonding curve: every bought stock multiplies the price by e^Impact, every sold one divides it,
+// so the cost of n stocks is the integral of the curve: price * (e^(Impact*n) - 1) / Impact
+// (every company has its own price, the parameters are the same for all companies)
+//
+// Initial: the price if there is no price of the company in the data base
+// Impact: the relative price move of one traded stock
+// Drift: the standard deviation of the random relative price move (see Move)
+// Min, Max: the price limits
+// Now: the clock
+//
+// The engine has no lock, the price changes run in a transaction of the data base (the price is locked by it)
+type Engine struct {
+	Initial float64
+	Impact  float64
+	Drift   float64
+	Min     float64
+	Max     float64
+	Now     func() time.Time
+}
+
+// Creates a new price engine
+func New(initial float64, impact float64, drift float64, min float64, max float64) *Engine {
+	return &Engine{
+		Initial: initial,
+		Impact:  impact,
+		Drift:   drift,
+		Min:     min,
+		Max:     max,
+		Now:     time.Now,
+	}
+}
+
+// Gets the stored price or the initial price
+func (e *Engine) get(ctx context.Context, ticker string, db db_cfg.DataBase) (price_cfg.Price, error) {
+	p, err := db.GetPrice(ctx, ticker)
+	if err != nil {
+		return price_cfg.Price{}, vanerrors.NewWrap(ErrorGettingPrice, err, vanerrors.EmptyHandler)
+	}
+	if p == nil {
+		return price_cfg.Price{Value: e.clamp(e.Initial), UpdatedAt: e.Now()}, nil
+	}
+	return *p, nil
+}
+
+// Saves the price and adds it to the history
+func (e *Engine) set(ctx context.Context, ticker string, value float64, volume int64, db db_cfg.DataBase) (*price_cfg.Price, error) {
+	p := price_cfg.Price{Value: e.clamp(value), UpdatedAt: e.Now()}
+
+	err := db.SetPrice(ctx, ticker, p)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSavingPrice, err, vanerrors.EmptyHandler)
+	}
+
+	err = db.AddTick(ctx, ticker, price_cfg.Tick{Time: p.UpdatedAt, Price: p.Value, Volume: volume})
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSavingPrice, err, vanerrors.EmptyHandler)
+	}
+
+	return &p, nil
+}
+
+// Keeps the price in the limits
+func (e *Engine) clamp(value float64) float64 {
+	if e.Max > 0 {
+		value = min(value, e.Max)
+	}
+	return max(value, e.Min)
+}
+
+// Gets the value of n stocks starting at the price (the area under the curve)
+func (e *Engine) area(price float64, n float64) float64 {
+	if e.Impact == 0 {
+		return price * n
+	}
+	return price * math.Expm1(e.Impact*n) / e.Impact
+}
+
+// Converts the value to solids
+func toSolids(value float64, round func(float64) float64) (int64, error) {
+	value = round(value)
+	if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 || value >= math.MaxInt64 {
+		return 0, vanerrors.NewSimple(TradeIsTooBig)
+	}
+	return int64(value), nil
+}
+
+// Gets the current price of the company
+func (e *Engine) Price(ctx context.Context, ticker string, db db_cfg.DataBase) (*price_cfg.Price, error) {
+	p, err := e.get(ctx, ticker, db)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Gets the cost of buying n stocks and the amount of selling n stocks at the price (rounded in favor of the market)
+func (e *Engine) Quote(price price_cfg.Price, n int64) (int64, int64, error) {
+	cost, err := toSolids(e.area(price.Value, float64(n)), math.Ceil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	amount, err := toSolids(-e.area(price.Value, -float64(n)), math.Floor)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return cost, amount, nil
+}
+
+// Buys n stocks of the company, fn gets the cost and the transaction and should pay it in the transaction
+//
+// The trades are done one by one (the price is locked), the price is moved only if fn succeeds
+func (e *Engine) Buy(ctx context.Context, ticker string, n int64, db db_cfg.DataBase, fn func(cost int64, tx db_cfg.DataBase) error) (int64, *price_cfg.Price, error) {
+	var cost int64
+	var newPrice *price_cfg.Price
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		p, err := e.get(ctx, ticker, tx)
+		if err != nil {
+			return err
+		}
+
+		// Gets the cost
+		cost, _, err = e.Quote(p, n)
+		if err != nil {
+			return err
+		}
+
+		// Pays
+		err = fn(cost, tx)
+		if err != nil {
+			return err
+		}
+
+		// Moves the price up
+		newPrice, err = e.set(ctx, ticker, p.Value*math.Exp(e.Impact*float64(n)), n, tx)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return cost, newPrice, nil
+}
+
+// Sells n stocks of the company, fn gets the amount and the transaction and should pay it in the transaction
+//
+// The trades are done one by one (the price is locked), the price is moved only if fn succeeds
+func (e *Engine) Sell(ctx context.Context, ticker string, n int64, db db_cfg.DataBase, fn func(amount int64, tx db_cfg.DataBase) error) (int64, *price_cfg.Price, error) {
+	var amount int64
+	var newPrice *price_cfg.Price
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		p, err := e.get(ctx, ticker, tx)
+		if err != nil {
+			return err
+		}
+
+		// Gets the amount
+		_, amount, err = e.Quote(p, n)
+		if err != nil {
+			return err
+		}
+
+		// Pays
+		err = fn(amount, tx)
+		if err != nil {
+			return err
+		}
+
+		// Moves the price down
+		newPrice, err = e.set(ctx, ticker, p.Value*math.Exp(-e.Impact*float64(n)), -n, tx)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return amount, newPrice, nil
+}
+
+// Moves the price of the company randomly (log-normal drift), it should run periodically
+func (e *Engine) Move(ctx context.Context, ticker string, db db_cfg.DataBase) (*price_cfg.Price, error) {
+	var newPrice *price_cfg.Price
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		p, err := e.get(ctx, ticker, tx)
+		if err != nil {
+			return err
+		}
+
+		newPrice, err = e.set(ctx, ticker, p.Value*math.Exp(rand.NormFloat64()*e.Drift), 0, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newPrice, nil
+}
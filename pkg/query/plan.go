@@ -0,0 +1,89 @@
+package query
+
+// The range of the values of the field, the users in it are found by an index of the field
+//
+// From, To: the bounds of the range (nil is no bound)
+// FromIncluded, ToIncluded: are the bounds in the range
+type Range struct {
+	Field        UserField
+	From         any
+	To           any
+	FromIncluded bool
+	ToIncluded   bool
+}
+
+// Plans the index lookup of the query: the range of the leading comparison if its field is indexed
+//
+// Only the queries joined by and are planned (the users of an or group can be out of the range), != isn't a range
+// The found users are still checked by Sort, ok is false if all users should be checked
+func (query Query) Plan(indexed func(UserField) bool) (Range, bool) {
+	// Checks the query is comparisons joined by and
+	if len(query)%2 == 0 {
+		return Range{}, false
+	}
+	for i, qr := range query {
+		if i%2 == 1 {
+			if qr.Separator != AND {
+				return Range{}, false
+			}
+			continue
+		}
+		if _, ok := StringUserField[qr.Type]; qr.Separator != NOT_SEPARATOR || !ok {
+			return Range{}, false
+		}
+	}
+
+	// The leading comparison
+	lead := query[0]
+	if !indexed(lead.Type) {
+		return Range{}, false
+	}
+
+	// The value should have the type of the field
+	if _, ok := Compare(lead.Type, lead.Y, lead.Y); !ok {
+		return Range{}, false
+	}
+
+	r := Range{Field: lead.Type}
+	switch {
+	case lead.Sign == EQUAL && !lead.Not:
+		r.From, r.To, r.FromIncluded, r.ToIncluded = lead.Y, lead.Y, true, true
+	case lead.Sign == MORE && !lead.Not:
+		r.From = lead.Y
+	case lead.Sign == MORE:
+		// <=
+		r.To, r.ToIncluded = lead.Y, true
+	case lead.Sign == LESS && !lead.Not:
+		r.To = lead.Y
+	case lead.Sign == LESS:
+		// >=
+		r.From, r.FromIncluded = lead.Y, true
+	default:
+		return Range{}, false
+	}
+
+	return r, true
+}
+
+// Checks the value of the field isn't before the lower bound
+func (r Range) AfterFrom(x any) bool {
+	if r.From == nil {
+		return true
+	}
+	c, ok := Compare(r.Field, x, r.From)
+	return ok && (c > 0 || c == 0 && r.FromIncluded)
+}
+
+// Checks the value of the field isn't after the upper bound
+func (r Range) BeforeTo(x any) bool {
+	if r.To == nil {
+		return true
+	}
+	c, ok := Compare(r.Field, x, r.To)
+	return ok && (c < 0 || c == 0 && r.ToIncluded)
+}
+
+// Checks is the value of the field in the range
+func (r Range) Contains(x any) bool {
+	return r.AfterFrom(x) && r.BeforeTo(x)
+}
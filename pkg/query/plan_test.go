@@ -0,0 +1,62 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/vandi37/StocksBack/pkg/query"
+)
+
+// The comparison of the query
+func cond(field query.UserField, sign query.Sign, not bool, y any) query.QuerySetting {
+	return query.QuerySetting{Separator: query.NOT_SEPARATOR, Type: field, Sign: sign, Not: not, Y: y}
+}
+
+// The separators of the query
+var (
+	and = query.QuerySetting{Separator: query.AND}
+	or  = query.QuerySetting{Separator: query.OR}
+)
+
+func TestPlan(t *testing.T) {
+	solids := func(f query.UserField) bool { return f == query.SOLID_BALANCE }
+
+	tests := []struct {
+		name  string
+		query query.Query
+		ok    bool
+		in    []int64
+		out   []int64
+	}{
+		{"equal", query.Query{cond(query.SOLID_BALANCE, query.EQUAL, false, 5)}, true, []int64{5}, []int64{4, 6}},
+		{"more", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, uint64(5))}, true, []int64{6}, []int64{5, 4}},
+		{"less or equal", query.Query{cond(query.SOLID_BALANCE, query.MORE, true, 5)}, true, []int64{5, 4}, []int64{6}},
+		{"less", query.Query{cond(query.SOLID_BALANCE, query.LESS, false, 5.5)}, true, []int64{5}, []int64{6}},
+		{"more or equal", query.Query{cond(query.SOLID_BALANCE, query.LESS, true, 5)}, true, []int64{5, 6}, []int64{4}},
+		{"leading of and", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, 5), and, cond(query.NAME, query.EQUAL, false, "a")}, true, []int64{6}, []int64{5}},
+		{"not equal", query.Query{cond(query.SOLID_BALANCE, query.EQUAL, true, 5)}, false, nil, nil},
+		{"or", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, 5), or, cond(query.NAME, query.EQUAL, false, "a")}, false, nil, nil},
+		{"not indexed", query.Query{cond(query.NAME, query.EQUAL, false, "a"), and, cond(query.SOLID_BALANCE, query.MORE, false, 5)}, false, nil, nil},
+		{"wrong type", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, "5")}, false, nil, nil},
+		{"invalid order", query.Query{cond(query.SOLID_BALANCE, query.MORE, false, 5), and}, false, nil, nil},
+		{"empty", query.Query{}, false, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := tt.query.Plan(solids)
+			if ok != tt.ok {
+				t.Fatalf("want planned %v, got %v", tt.ok, ok)
+			}
+			for _, x := range tt.in {
+				if !r.Contains(x) {
+					t.Errorf("%d isn't in the range %+v", x, r)
+				}
+			}
+			for _, x := range tt.out {
+				if r.Contains(x) {
+					t.Errorf("%d is in the range %+v", x, r)
+				}
+			}
+		})
+	}
+}
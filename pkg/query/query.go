@@ -1,7 +1,10 @@
 package query
 
 import (
+	"cmp"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/vandi37/StocksBack/config/user_cfg"
@@ -26,6 +29,7 @@ const (
 	IS_BLOCKED
 	LAST_FARMING
 	CREATED_AT
+	ROLE
 )
 
 // The map for string values of fields
@@ -38,6 +42,20 @@ var StringUserField = map[UserField]string{
 	IS_BLOCKED:    "is_blocked",
 	LAST_FARMING:  "last_farming",
 	CREATED_AT:    "created_at",
+	ROLE:          "role",
+}
+
+// The map for sql expressions of fields, the stock balance is the total amount of the holdings
+var SqlUserField = map[UserField]string{
+	ID:            "id",
+	NAME:          "name",
+	PASSWORD:      "password",
+	SOLID_BALANCE: "solid_balance",
+	STOCK_BALANCE: "(select coalesce(sum(amount), 0) from holdings where holdings.user_id = users.id)",
+	IS_BLOCKED:    "is_blocked",
+	LAST_FARMING:  "last_farming",
+	CREATED_AT:    "created_at",
+	ROLE:          "role",
 }
 
 // the separator id
@@ -91,127 +109,146 @@ type QuerySetting struct {
 // The query setting slice, that represents a query
 type Query []QuerySetting
 
-// Runs the query
-func (q QuerySetting) Run(X any) bool {
-	// Sets the result
-	var res bool
+// The number of any integer or float type
+type number struct {
+	i       int64
+	f       float64
+	isFloat bool
+}
 
-	// Switching by type
-	switch q.Type {
-	// Case of uint64 values
-	case ID, SOLID_BALANCE, STOCK_BALANCE:
-		// Converting x to uint64
-		uintX, ok := X.(uint64)
-		if !ok {
-			return false
-		}
-		// Converting y to uint64
-		uintY, ok := q.Y.(uint64)
-		if !ok {
-			return false
+// Gets the number of the value
+func toNumber(v any) (number, bool) {
+	switch v := v.(type) {
+	case int:
+		return number{i: int64(v)}, true
+	case int8:
+		return number{i: int64(v)}, true
+	case int16:
+		return number{i: int64(v)}, true
+	case int32:
+		return number{i: int64(v)}, true
+	case int64:
+		return number{i: v}, true
+	case uint:
+		return toNumber(uint64(v))
+	case uint8:
+		return number{i: int64(v)}, true
+	case uint16:
+		return number{i: int64(v)}, true
+	case uint32:
+		return number{i: int64(v)}, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return number{f: float64(v), isFloat: true}, true
 		}
+		return number{i: int64(v)}, true
+	case float32:
+		return number{f: float64(v), isFloat: true}, true
+	case float64:
+		return number{f: v, isFloat: true}, true
+	}
+	return number{}, false
+}
 
-		// Switching by Sign
-		switch q.Sign {
-		// Checking equal
-		case EQUAL:
-			res = uintX == uintY
-		// Checking more
-		case MORE:
-			res = uintX > uintY
-		// Checking less
-		case LESS:
-			res = uintX < uintY
-		// In default
-		default:
-			return false
-		}
-	// Case of string values
-	case NAME, PASSWORD:
-		// Converting x to string
-		strX, ok := X.(string)
-		if !ok {
-			return false
-		}
-		// Converting y to string
-		strY, ok := q.Y.(string)
-		if !ok {
-			return false
-		}
+// Gets the number as float
+func (n number) float() float64 {
+	if n.isFloat {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+// Compares the numbers of any types (-1 if x is less, 0 if they are equal, 1 if x is more), ok is false if one of them isn't a number
+func compareNumbers(x any, y any) (int, bool) {
+	nx, ok := toNumber(x)
+	if !ok {
+		return 0, false
+	}
+	ny, ok := toNumber(y)
+	if !ok {
+		return 0, false
+	}
 
-		// Switching by Sign
-		switch q.Sign {
-		// Checking equal
-		case EQUAL:
-			res = strX == strY
-		// Checking more
-		case MORE:
-			res = strX > strY
-		// Checking less
-		case LESS:
-			res = strX < strY
-		// In default
-		default:
-			return false
+	if !nx.isFloat && !ny.isFloat {
+		return cmp.Compare(nx.i, ny.i), true
+	}
+	return cmp.Compare(nx.float(), ny.float()), true
+}
+
+// Compares the values of the field (-1 if x is less, 0 if they are equal, 1 if x is more), ok is false if one of them has a wrong type
+//
+// The numbers of any types are compared by value, false is less than true
+func Compare(field UserField, x any, y any) (int, bool) {
+	// Switching by type
+	switch field {
+	// Case of number values (the ids are uint64, the balances are int64)
+	case ID, SOLID_BALANCE, STOCK_BALANCE:
+		return compareNumbers(x, y)
+	// Case of string values
+	case NAME, PASSWORD, ROLE:
+		strX, okX := x.(string)
+		strY, okY := y.(string)
+		if !okX || !okY {
+			return 0, false
 		}
+		return strings.Compare(strX, strY), true
 	// Case of boolean values
 	case IS_BLOCKED:
-		// Converting x to boolean
-		boolX, ok := X.(bool)
-		if !ok {
-			return false
-		}
-
-		// Converting y to boolean
-		boolY, ok := q.Y.(bool)
-		if !ok {
-			return false
-		}
-
-		// Switching by Sign
-		switch q.Sign {
-		// Checking equal
-		case EQUAL:
-			res = boolX == boolY
-			// Checking more
-		case MORE:
-			res = boolX && !boolY
-			// Checking less
-		case LESS:
-			res = !boolX && boolY
-			// In default
-		default:
-			return false
+		boolX, okX := x.(bool)
+		boolY, okY := y.(bool)
+		if !okX || !okY {
+			return 0, false
 		}
+		return CompareBools(boolX, boolY), true
 	// Case of time.Time values
 	case CREATED_AT, LAST_FARMING:
-		// Converting x to time.Time
-		timeX, ok := X.(time.Time)
-		if !ok {
-			return false
+		timeX, okX := x.(time.Time)
+		timeY, okY := y.(time.Time)
+		if !okX || !okY {
+			return 0, false
 		}
+		return timeX.Compare(timeY), true
+	}
 
-		// Converting y to time.Time
-		timeY, ok := q.Y.(time.Time)
-		if !ok {
-			return false
-		}
+	return 0, false
+}
 
-		// Switching by Sign
-		switch q.Sign {
-		// Checking equal
-		case EQUAL:
-			res = timeX.Equal(timeY)
-			// Checking more
-		case MORE:
-			res = timeX.After(timeY)
-			// Checking less
-		case LESS:
-			res = timeX.Before(timeY)
-			// In default
-		default:
-			return false
-		}
+// Compares the booleans, false is less than true
+func CompareBools(x bool, y bool) int {
+	switch {
+	case x == y:
+		return 0
+	case y:
+		return -1
+	}
+	return 1
+}
+
+// Runs the query
+func (q QuerySetting) Run(X any) bool {
+	// Comparing the values
+	c, ok := Compare(q.Type, X, q.Y)
+	if !ok {
+		return false
+	}
+
+	// Sets the result
+	var res bool
+
+	// Switching by Sign
+	switch q.Sign {
+	// Checking equal
+	case EQUAL:
+		res = c == 0
+	// Checking more
+	case MORE:
+		res = c > 0
+	// Checking less
+	case LESS:
+		res = c < 0
+	// In default
+	default:
+		return false
 	}
 
 	// Checking not
@@ -230,17 +267,19 @@ func (q QuerySetting) Run(X any) bool {
 
 // Sorting the users by query
 func (query Query) Sort(users []user_cfg.User, num int) ([]user_cfg.User, error) {
-	// If num is less than zero it sets to max value
-	if num < 0 {
-		num = len(users) - 1
+	// If num isn't positive there is no limit
+	if num <= 0 {
+		num = len(users)
 	}
 
 	// Setting the result
 	var res []user_cfg.User
 
 	for _, u := range users {
-		// Setting do append and current separator
+		// Setting do append (the finished and groups joined by or), the current and group and current separator
+		// And is checked before or like in sql
 		var do_append bool
+		var group bool
 		var cur_separator Separator = OR
 
 		for _, qr := range query {
@@ -270,8 +309,8 @@ func (query Query) Sort(users []user_cfg.User, num int) ([]user_cfg.User, error)
 					is_true = qr.Run(u.SolidBalance)
 
 				case STOCK_BALANCE:
-					// Running stock balance
-					is_true = qr.Run(u.StockBalance)
+					// Running stock balance (the total amount of stocks)
+					is_true = qr.Run(u.TotalStocks())
 
 				case IS_BLOCKED:
 					// Running is blocked
@@ -284,19 +323,25 @@ func (query Query) Sort(users []user_cfg.User, num int) ([]user_cfg.User, error)
 					// Running created at
 					is_true = qr.Run(u.CreatedAt)
 
+				case ROLE:
+					// Running role
+					is_true = qr.Run(string(u.GetRole()))
+
 				default:
 					// Returning error
 					return nil, vanerrors.NewSimple(InvalidQuery, "invalid type")
 				}
 
-				// Editing do append
+				// Editing the group
 				switch cur_separator {
 
 				case OR:
-					do_append = do_append || is_true
+					// Starting a new group
+					do_append = do_append || group
+					group = is_true
 
 				case AND:
-					do_append = do_append && is_true
+					group = group && is_true
 
 				default:
 					// Returning error
@@ -325,12 +370,12 @@ func (query Query) Sort(users []user_cfg.User, num int) ([]user_cfg.User, error)
 		}
 
 		// Appending user
-		if do_append {
+		if do_append || group {
 			res = append(res, u)
 		}
 
 		// Checking the limit
-		if len(res) > num {
+		if len(res) >= num {
 			break
 		}
 	}
@@ -358,6 +403,20 @@ func SignToString(Sign Sign, not bool) string {
 	}
 }
 
+// Gets the sql Sign
+func SignToSql(Sign Sign, not bool) string {
+	if Sign == EQUAL && not {
+		// <>
+		return "<>"
+	} else if Sign == EQUAL && !not {
+		// =
+		return StringSign[Sign]
+	}
+
+	// The other signs are the same
+	return SignToString(Sign, not)
+}
+
 // Creates a string query
 func (query Query) String() string {
 	// Setting result as a string
@@ -385,13 +444,13 @@ func (query Query) PrepareString() (string, []any) {
 	var resStr string
 	var resSlice []any
 
-	for i, qr := range query {
+	for _, qr := range query {
 		// Separator switch
 		switch qr.Separator {
 
 		case NOT_SEPARATOR:
-			// Adding query setting expression
-			resStr += fmt.Sprintf("%s %s $%d", StringUserField[qr.Type], SignToString(qr.Sign, qr.Not), i+1)
+			// Adding query setting expression (the placeholders are numbered by the arguments)
+			resStr += fmt.Sprintf("%s %s $%d", SqlUserField[qr.Type], SignToSql(qr.Sign, qr.Not), len(resSlice)+1)
 			resSlice = append(resSlice, qr.Y)
 		case OR, AND:
 			// Adding separator
@@ -0,0 +1,140 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorCreatingCompany = "error creating company"
+)
+
+// The company columns
+const companyColumns = `ticker, name, price, price_updated_at, dividend_rate, created_at`
+
+// Runs queries in the data base or in the transaction
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Scans all companies from rows
+func scanCompanies(rows *sql.Rows) ([]company_cfg.Company, error) {
+	res := []company_cfg.Company{}
+
+	for rows.Next() {
+		var c company_cfg.Company
+		var price sql.NullFloat64
+		var updatedAt time.Time
+		err := rows.Scan(&c.Ticker, &c.Name, &price, timeValue{&updatedAt}, &c.DividendRate, timeValue{&c.CreatedAt})
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+
+		if price.Valid {
+			c.Price = &price_cfg.Price{Value: price.Float64, UpdatedAt: updatedAt}
+		}
+		res = append(res, c)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
+
+// Adds stocks of the company to the user, the holding can't become negative
+func addStocks(ctx context.Context, ex Execer, id uint64, ticker string, num int64) error {
+	if num == 0 {
+		return nil
+	}
+
+	var res sql.Result
+	var err error
+	if num > 0 {
+		res, err = ex.ExecContext(ctx, `insert into holdings (user_id, ticker, amount) values ($1, $2, $3)
+			on conflict (user_id, ticker) do update set amount = holdings.amount + excluded.amount;`, id, ticker, num)
+	} else {
+		res, err = ex.ExecContext(ctx, `update holdings set amount = amount + $3 where user_id = $1 and ticker = $2 and amount + $3 >= 0;`, id, ticker, num)
+	}
+	if err != nil {
+		return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+	}
+	if n == 0 {
+		return vanerrors.NewSimple(db_cfg.NotEnoughBalance)
+	}
+
+	return nil
+}
+
+// Creates the default company if it doesn't exist
+func CreateDefault(ctx context.Context, ex Execer) error {
+	d := company_cfg.Default()
+	_, err := ex.ExecContext(ctx, `insert into companies (`+companyColumns+`) values ($1, $2, null, null, $3, $4) on conflict (ticker) do nothing;`,
+		d.Ticker, d.Name, d.DividendRate, d.CreatedAt)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorCreatingCompany, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Creates a new company
+func (db *DB) CreateCompany(ctx context.Context, c company_cfg.Company) error {
+	var price sql.NullFloat64
+	var updatedAt sql.NullTime
+	if c.Price != nil {
+		price = sql.NullFloat64{Float64: c.Price.Value, Valid: true}
+		updatedAt = sql.NullTime{Time: c.Price.UpdatedAt, Valid: true}
+	}
+
+	_, err := db.Conn().ExecContext(ctx, `insert into companies (`+companyColumns+`) values ($1, $2, $3, $4, $5, $6);`,
+		c.Ticker, c.Name, price, updatedAt, c.DividendRate, c.CreatedAt)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorCreatingCompany, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Selects the company
+func (db *DB) GetCompany(ctx context.Context, ticker string) (*company_cfg.Company, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select `+companyColumns+` from companies where ticker = $1`+db.forUpdate()+`;`, ticker)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	companies, err := scanCompanies(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(companies) == 0 {
+		return nil, vanerrors.NewSimple(NotFound)
+	}
+
+	return &companies[0], nil
+}
+
+// Selects all companies sorted by ticker
+func (db *DB) GetCompanies(ctx context.Context) ([]company_cfg.Company, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select `+companyColumns+` from companies order by ticker;`)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanCompanies(rows)
+}
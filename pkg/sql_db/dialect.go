@@ -0,0 +1,47 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// The differences of the sql data bases
+//
+// - Lock : the locking clause of the selected rows inside a transaction, empty if the transaction locks the whole data base
+// - LockIds : the query that locks the next user id inside WithTx, empty if the transaction locks the whole data base
+// - Snapshot : the options of the transaction of the consistent reads
+// - JSONObject : the aggregate function of the json objects
+// - Array : stores and scans the string array (nil is stored as an empty array)
+// - Init : creates the tables or applies the migrations
+type Dialect struct {
+	Lock       string
+	LockIds    string
+	Snapshot   *sql.TxOptions
+	JSONObject string
+	Array      func(a *[]string) any
+	Init       func(ctx context.Context, db *DB) error
+}
+
+// Scans the time, null is the zero time
+//
+// Postgres returns the time, sqlite returns the unix microseconds
+type timeValue struct {
+	t *time.Time
+}
+
+// Scans the value
+func (v timeValue) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*v.t = time.Time{}
+	case int64:
+		*v.t = time.UnixMicro(src)
+	case time.Time:
+		*v.t = src
+	default:
+		return fmt.Errorf("unsupported time %T", src)
+	}
+	return nil
+}
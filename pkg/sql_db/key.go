@@ -0,0 +1,161 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorInsertingKey = "error inserting key"
+	ErrorUpdatingKey  = "error updating key"
+)
+
+// The key columns
+const keyColumns = `id, user_id, name, hash, scopes, is_revoked, expires_at, created_at`
+
+// Scans the current key row
+func (db *DB) scanKeyRow(rows *sql.Rows) (*key_cfg.Key, error) {
+	var key key_cfg.Key
+	var scopes []string
+
+	err := rows.Scan(&key.Id, &key.UserId, &key.Name, &key.Hash, db.dialect.Array(&scopes), &key.IsRevoked, timeValue{&key.ExpiresAt}, timeValue{&key.CreatedAt})
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+	}
+
+	// Setting scopes
+	for _, s := range scopes {
+		key.Scopes = append(key.Scopes, key_cfg.Scope(s))
+	}
+
+	return &key, nil
+}
+
+// Scans one key from rows
+func (db *DB) scanKey(rows *sql.Rows) (*key_cfg.Key, error) {
+	if !rows.Next() {
+		return nil, vanerrors.NewSimple(NotFound)
+	}
+
+	key, err := db.scanKeyRow(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return key, nil
+}
+
+// Creates a new api key
+func (db *DB) CreateKey(ctx context.Context, k key_cfg.Key) error {
+	// Prepares the query
+	query := `insert into api_keys (` + keyColumns + `) values ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+
+	defer stmt.Close()
+
+	// Getting scopes
+	scopes := make([]string, len(k.Scopes))
+	for i, s := range k.Scopes {
+		scopes[i] = string(s)
+	}
+
+	// Getting expiry (zero is null)
+	expiresAt := sql.NullTime{Time: k.ExpiresAt, Valid: !k.ExpiresAt.IsZero()}
+
+	// Creates key
+	_, err = stmt.ExecContext(ctx, k.Id, k.UserId, k.Name, k.Hash, db.dialect.Array(&scopes), k.IsRevoked, expiresAt, k.CreatedAt)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorInsertingKey, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Selects the api key
+func (db *DB) GetKey(ctx context.Context, id string) (*key_cfg.Key, error) {
+	// Prepares the query
+	query := `select ` + keyColumns + ` from api_keys where id = $1` + db.forUpdate() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Selects the key
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanKey(rows)
+}
+
+// Selects all api keys of the user
+func (db *DB) GetKeys(ctx context.Context, userId uint64) ([]key_cfg.Key, error) {
+	// Prepares the query
+	query := `select ` + keyColumns + ` from api_keys where user_id = $1 order by created_at;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Selects the keys
+	rows, err := stmt.QueryContext(ctx, userId)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	var res []key_cfg.Key
+
+	// Adding keys
+	for rows.Next() {
+		key, err := db.scanKeyRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *key)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
+
+// Revokes the api key
+func (db *DB) RevokeKey(ctx context.Context, id string) (*key_cfg.Key, error) {
+	query := `update api_keys set is_revoked = true where id = $1 returning ` + keyColumns + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the key
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorUpdatingKey, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanKey(rows)
+}
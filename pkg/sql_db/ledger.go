@@ -0,0 +1,284 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorWritingLedger = "error writing ledger"
+)
+
+// The ledger columns
+const ledgerColumns = `id, user_id, kind, reference, memo, ticker, solids, stocks, solid_balance, stock_balance, created_at`
+
+// Scans all ledger entries from rows
+func scanEntries(rows *sql.Rows) ([]ledger_cfg.Entry, error) {
+	res := []ledger_cfg.Entry{}
+
+	for rows.Next() {
+		var e ledger_cfg.Entry
+		err := rows.Scan(&e.Id, &e.UserId, &e.Kind, &e.Reference, &e.Memo, &e.Ticker, &e.Solids, &e.Stocks, &e.SolidBalance, &e.StockBalance, timeValue{&e.CreatedAt})
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+		res = append(res, e)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
+
+// Writes the ledger entry in the transaction
+func addEntry(ctx context.Context, ex Execer, e ledger_cfg.Entry) error {
+	_, err := ex.ExecContext(ctx, `insert into ledger (user_id, kind, reference, memo, ticker, solids, stocks, solid_balance, stock_balance, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`,
+		e.UserId, e.Kind, e.Reference, e.Memo, e.Ticker, e.Solids, e.Stocks, e.SolidBalance, e.StockBalance, e.CreatedAt)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorWritingLedger, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Locks the user in the transaction (without the row locks it only checks the user exists)
+func (db *DB) lockUser(ctx context.Context, tx Querier, id uint64) error {
+	rows, err := tx.QueryContext(ctx, `select id from users where id = $1`+db.dialect.Lock+`;`, id)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	found := rows.Next()
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	if !found {
+		return vanerrors.NewSimple(NotFound)
+	}
+
+	return nil
+}
+
+// Applies the balance change with the ledger entry in the transaction, the balances can't become negative
+func (db *DB) applyChange(ctx context.Context, tx Querier, c db_cfg.BalanceChange) (*user_cfg.User, error) {
+	// Changes the stocks first, so the returned user has the new holdings
+	err := addStocks(ctx, tx, c.Id, c.Ticker, c.Stocks)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `update users set solid_balance = solid_balance + $1 where id = $2 and solid_balance + $1 >= 0 returning ` + db.userSelect() + `;`
+
+	rows, err := tx.QueryContext(ctx, query, c.Solids, c.Id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+	}
+
+	usr, err := db.scanUser(rows)
+	rows.Close()
+	if vanerrors.GetName(err) == NotFound {
+		return nil, vanerrors.NewSimple(db_cfg.NotEnoughBalance)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes the ledger entry
+	if c.Solids != 0 || c.Stocks != 0 {
+		err = addEntry(ctx, tx, ledger_cfg.NewEntry(*usr, c.Reason, c.Ticker, c.Solids, c.Stocks, time.Now()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return usr, nil
+}
+
+// Applies the balance change of one user in one transaction
+func (db *DB) updateBalance(ctx context.Context, c db_cfg.BalanceChange) (*user_cfg.User, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	// Locks the user, the holding row could not exist yet
+	err = db.lockUser(ctx, tx, c.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := db.applyChange(ctx, tx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return usr, nil
+}
+
+// Writes the opening entries of the users without ledger entries (the balances they had before the ledger)
+//
+// The arguments are cast, so the union gets the types of the columns
+func OpenLedger(ctx context.Context, tx Querier) error {
+	_, err := tx.ExecContext(ctx, `with fresh as (
+			select id, coalesce(solid_balance, 0) as solid_balance from users
+			where not exists (select 1 from ledger where ledger.user_id = users.id)
+		)
+		insert into ledger (user_id, kind, reference, ticker, solids, stocks, solid_balance, stock_balance, created_at)
+		select id, cast($1 as varchar), '', '', solid_balance, 0, solid_balance, 0, cast($2 as timestamp with time zone) from fresh where solid_balance <> 0
+		union all
+		select fresh.id, cast($1 as varchar), '', holdings.ticker, 0, holdings.amount, fresh.solid_balance, holdings.amount, cast($2 as timestamp with time zone)
+		from fresh join holdings on holdings.user_id = fresh.id where holdings.amount <> 0
+		order by 1, 4;`, ledger_cfg.OPENING, time.Now())
+	if err != nil {
+		return vanerrors.NewWrap(ErrorWritingLedger, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Selects the ledger entries of the user with the id less then before (all if before is zero), the newest first
+func (db *DB) GetEntries(ctx context.Context, userId uint64, before uint64, limit int) ([]ledger_cfg.Entry, error) {
+	query := `select ` + ledgerColumns + ` from ledger where user_id = $1 and ($2 = 0 or id < $2) order by id desc`
+	args := []any{userId, before}
+
+	// Checking is the limit need
+	if limit > 0 {
+		query += ` limit $3`
+		args = append(args, limit)
+	}
+
+	rows, err := db.Conn().QueryContext(ctx, query+`;`, args...)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanEntries(rows)
+}
+
+// Compares the stored balances of all users with the sums of the ledger entries (in one snapshot)
+func (db *DB) GetDrifts(ctx context.Context) ([]ledger_cfg.Drift, error) {
+	var tx Querier = db.tx
+	if db.tx == nil {
+		snapshot, err := db.db.BeginTx(ctx, db.dialect.Snapshot)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+		}
+		defer snapshot.Rollback()
+		tx = snapshot
+	}
+
+	// Selects the users
+	rows, err := tx.QueryContext(ctx, `select `+db.userSelect()+` from users order by id;`)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	users, err := db.scanUsers(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sums the ledger
+	rows, err = tx.QueryContext(ctx, `select user_id, ticker, cast(sum(solids) as bigint), cast(sum(stocks) as bigint) from ledger group by user_id, ticker;`)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	// The sum of every user and ticker is one entry
+	entries := []ledger_cfg.Entry{}
+	for rows.Next() {
+		var e ledger_cfg.Entry
+		err = rows.Scan(&e.UserId, &e.Ticker, &e.Solids, &e.Stocks)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+		entries = append(entries, e)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	sums := ledger_cfg.Sums(entries)
+	res := []ledger_cfg.Drift{}
+	for _, usr := range users {
+		res = append(res, ledger_cfg.Compare(usr, sums[usr.Id])...)
+	}
+
+	return res, nil
+}
+
+// Sets the solids (the empty ticker) or the stocks of the company of the user to the sum of the ledger entries in one transaction
+func (db *DB) Correct(ctx context.Context, id uint64, ticker string, reason ledger_cfg.Reason) (*user_cfg.User, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	err = db.lockUser(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sets the balance to the ledger
+	var sum int64
+	if ticker == "" {
+		err = tx.QueryRowContext(ctx, `select cast(coalesce(sum(solids), 0) as bigint) from ledger where user_id = $1;`, id).Scan(&sum)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `update users set solid_balance = $1 where id = $2;`, sum, id)
+		}
+	} else {
+		err = tx.QueryRowContext(ctx, `select cast(coalesce(sum(stocks), 0) as bigint) from ledger where user_id = $1 and ticker = $2;`, id, ticker).Scan(&sum)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `insert into holdings (user_id, ticker, amount) values ($1, $2, $3)
+				on conflict (user_id, ticker) do update set amount = excluded.amount;`, id, ticker, sum)
+		}
+	}
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+	}
+
+	rows, err := tx.QueryContext(ctx, `select `+db.userSelect()+` from users where id = $1;`, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	usr, err := db.scanUser(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Writes the entry without changes
+	err = addEntry(ctx, tx, ledger_cfg.NewEntry(*usr, reason, ticker, 0, 0, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return usr, nil
+}
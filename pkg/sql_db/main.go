@@ -0,0 +1,412 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/hash"
+	"github.com/vandi37/StocksBack/pkg/query"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorCreateTable    = "error creating table"
+	ErrorPreparingQuery = "error preparing query"
+	ErrorInsertingUser  = "error inserting user"
+	ErrorScanningRows   = "error scanning rows"
+	ErrorSelecting      = "error selecting"
+	ErrorGettingLength  = "error getting length"
+	ErrorUpdatingUser   = "error updating user"
+	NotFound            = db_cfg.NotFound
+)
+
+// The sql data base, the postgres and sqlite data bases differ only by the dialect
+//
+// tx: the transaction of WithTx, nil outside of it
+type DB struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	key     string
+	dialect Dialect
+}
+
+// Creates the data base of the connection
+func New(db *sql.DB, key string, dialect Dialect) *DB {
+	return &DB{db: db, key: key, dialect: dialect}
+}
+
+// The user columns
+const userColumns = `id, name, password, solid_balance, is_blocked, last_farming, created_at, role, totp_secret, totp_enabled, recovery_codes, totp_last_step`
+
+// Gets the selected user columns with the holdings as a json object (the empty holdings are skipped)
+func (db *DB) userSelect() string {
+	return userColumns + `, coalesce((select ` + db.dialect.JSONObject + `(ticker, amount) from holdings where holdings.user_id = users.id and amount <> 0), '{}')`
+}
+
+// Scans the current user row
+func (db *DB) scanUserRow(rows *sql.Rows) (*user_cfg.User, error) {
+	var user user_cfg.User
+	var holdings []byte
+	err := rows.Scan(&user.Id, &user.Name, &user.Password, &user.SolidBalance, &user.IsBlocked, timeValue{&user.LastFarming}, timeValue{&user.CreatedAt}, &user.Role,
+		&user.TwoFactor.Secret, &user.TwoFactor.Enabled, db.dialect.Array(&user.TwoFactor.RecoveryCodes), &user.TwoFactor.LastStep, &holdings)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+	}
+
+	err = json.Unmarshal(holdings, &user.Holdings)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+	}
+	return &user, nil
+}
+
+// Replaces nil with an empty slice (nil arrays are stored as null)
+func NotNull(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// Scans one user from rows
+func (db *DB) scanUser(rows *sql.Rows) (*user_cfg.User, error) {
+	if !rows.Next() {
+		return nil, vanerrors.NewSimple(NotFound)
+	}
+
+	user, err := db.scanUserRow(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return user, nil
+}
+
+// Scans all users from rows
+func (db *DB) scanUsers(rows *sql.Rows) ([]user_cfg.User, error) {
+	var res []user_cfg.User
+
+	// Adding users
+	for rows.Next() {
+		user, err := db.scanUserRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, *user)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
+
+// Creates the tables with the dialect
+func (db *DB) Init(ctx context.Context) error {
+	return db.dialect.Init(ctx, db)
+}
+
+// Creates a new user with the holdings
+func (db *DB) Create(ctx context.Context, u user_cfg.User) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	// Creates user
+	query := `insert into users (` + userColumns + `) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
+
+	_, err = tx.ExecContext(ctx, query, u.Id, u.Name, u.Password, u.SolidBalance, u.IsBlocked, u.LastFarming, u.CreatedAt, u.GetRole(),
+		u.TwoFactor.Secret, u.TwoFactor.Enabled, db.dialect.Array(&u.TwoFactor.RecoveryCodes), u.TwoFactor.LastStep)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorInsertingUser, err, vanerrors.EmptyHandler)
+	}
+
+	// Creates the holdings
+	for ticker, amount := range u.Holdings {
+		err = addStocks(ctx, tx, u.Id, ticker, amount)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorInsertingUser, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Gets all
+func (db *DB) GetAll(ctx context.Context) ([]user_cfg.User, error) {
+	query := `select ` + db.userSelect() + ` from users order by id;`
+	rows, err := db.Conn().QueryContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUsers(rows)
+}
+
+// Selects all by query
+func (db *DB) GetAllBy(ctx context.Context, q query.Query) ([]user_cfg.User, error) {
+	return db.GetNumBy(ctx, q, -1)
+}
+
+// Selecting by query
+func (db *DB) GetNumBy(ctx context.Context, q query.Query, num int) ([]user_cfg.User, error) {
+	// Getting query part
+	str, args := q.PrepareString()
+	query := `select ` + db.userSelect() + ` from users where (` + str + `) order by id`
+
+	// Checking is the limit need
+	if num > 0 {
+		query += " limit " + strconv.Itoa(num)
+	}
+
+	query += ";"
+
+	// Preparing query
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Getting rows
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUsers(rows)
+}
+
+// Selecting
+func (db *DB) GetOne(ctx context.Context, id uint64) (*user_cfg.User, error) {
+	// Prepares the query
+	query := `select ` + db.userSelect() + ` from users where id = $1` + db.forUpdate() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Selects the user
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Selects user by query
+func (db *DB) GetOneBy(ctx context.Context, q query.Query) (*user_cfg.User, error) {
+	// Selects one user
+	res, err := db.GetNumBy(ctx, q, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) < 1 {
+		return nil, nil
+	}
+
+	return &res[0], nil
+}
+
+// Updates block
+func (db *DB) UpdateBlock(ctx context.Context, id uint64, block bool) (*user_cfg.User, error) {
+	query := `update users set is_blocked = $1 where id = $2 returning ` + db.userSelect() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the user
+	rows, err := stmt.QueryContext(ctx, block, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Updates last farm
+func (db *DB) UpdateLastFarm(ctx context.Context, id uint64) (*user_cfg.User, error) {
+	query := `update users set last_farming = $1 where id = $2 returning ` + db.userSelect() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the user
+	rows, err := stmt.QueryContext(ctx, time.Now(), id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Updates name
+func (db *DB) UpdateName(ctx context.Context, id uint64, name string) (*user_cfg.User, error) {
+	query := `update users set name = $1 where id = $2 returning ` + db.userSelect() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the user
+	rows, err := stmt.QueryContext(ctx, name, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Updates password
+func (db *DB) UpdatePassword(ctx context.Context, id uint64, password string) (*user_cfg.User, error) {
+	query := `update users set password = $1 where id = $2 returning ` + db.userSelect() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the user
+	rows, err := stmt.QueryContext(ctx, password, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Updates role
+func (db *DB) UpdateRole(ctx context.Context, id uint64, role user_cfg.Role) (*user_cfg.User, error) {
+	query := `update users set role = $1 where id = $2 returning ` + db.userSelect() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the user
+	rows, err := stmt.QueryContext(ctx, role, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Updates two factor authentication data
+func (db *DB) UpdateTwoFactor(ctx context.Context, id uint64, tf user_cfg.TwoFactor) (*user_cfg.User, error) {
+	query := `update users set totp_secret = $1, totp_enabled = $2, recovery_codes = $3, totp_last_step = $4 where id = $5 returning ` + db.userSelect() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the user
+	rows, err := stmt.QueryContext(ctx, tf.Secret, tf.Enabled, db.dialect.Array(&tf.RecoveryCodes), tf.LastStep, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return db.scanUser(rows)
+}
+
+// Updates the solids
+func (db *DB) UpdateSolids(ctx context.Context, id uint64, num int64, reason ledger_cfg.Reason) (*user_cfg.User, error) {
+	return db.updateBalance(ctx, db_cfg.BalanceChange{Id: id, Solids: num, Reason: reason})
+}
+
+// Updates the stocks of the company
+func (db *DB) UpdateStocks(ctx context.Context, id uint64, ticker string, num int64, reason ledger_cfg.Reason) (*user_cfg.User, error) {
+	return db.updateBalance(ctx, db_cfg.BalanceChange{Id: id, Ticker: ticker, Stocks: num, Reason: reason})
+}
+
+// Gets the next user id, inside WithTx the id is locked until the transaction ends, so the concurrent sign ups get other ids
+func (db *DB) Len(ctx context.Context) (uint64, error) {
+	if db.tx != nil && db.dialect.LockIds != "" {
+		_, err := db.tx.ExecContext(ctx, db.dialect.LockIds)
+		if err != nil {
+			return 0, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	query := `select id from users order by id desc limit 1;`
+	// Updating the user
+	rows, err := db.Conn().QueryContext(ctx, query)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	var length uint64
+
+	if !rows.Next() {
+		return 0, nil
+	}
+
+	err = rows.Scan(&length)
+
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	return length + 1, nil
+}
+
+// Close the data base, the transaction of WithTx doesn't close it
+func (db *DB) Close() error {
+	if db.tx != nil {
+		return nil
+	}
+	return db.db.Close()
+}
+
+// Checks key in constant time, nothing is accepted if the admin key is empty
+func (db *DB) CheckKey(ctx context.Context, key string) (bool, error) {
+	return hash.CompareKey(db.key, key), nil
+}
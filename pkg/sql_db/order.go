@@ -0,0 +1,122 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorSavingOrder = "error saving order"
+)
+
+// The order columns
+const orderColumns = `id, user_id, ticker, side, price, amount, filled, reserved, status, created_at, updated_at`
+
+// Scans all orders from rows
+func scanOrders(rows *sql.Rows) ([]order_cfg.Order, error) {
+	res := []order_cfg.Order{}
+
+	for rows.Next() {
+		var o order_cfg.Order
+		err := rows.Scan(&o.Id, &o.UserId, &o.Ticker, &o.Side, &o.Price, &o.Amount, &o.Filled, &o.Reserved, &o.Status, timeValue{&o.CreatedAt}, timeValue{&o.UpdatedAt})
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+		res = append(res, o)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
+
+// Creates or updates the orders and applies the balance changes in one transaction
+func (db *DB) SaveOrders(ctx context.Context, orders []order_cfg.Order, changes []db_cfg.BalanceChange) ([]user_cfg.User, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	// Applies the changes (they are sorted by user id, so the locks can't deadlock)
+	users := make([]user_cfg.User, 0, len(changes))
+	for _, c := range changes {
+		usr, err := db.applyChange(ctx, tx, c)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *usr)
+	}
+
+	// Saves the orders
+	query := `insert into orders (` + orderColumns + `) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		on conflict (id) do update set filled = excluded.filled, reserved = excluded.reserved, status = excluded.status, updated_at = excluded.updated_at;`
+
+	for _, o := range orders {
+		_, err = tx.ExecContext(ctx, query, o.Id, o.UserId, o.Ticker, o.Side, o.Price, o.Amount, o.Filled, o.Reserved, o.Status, o.CreatedAt, o.UpdatedAt)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorSavingOrder, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return users, nil
+}
+
+// Selects the order
+func (db *DB) GetOrder(ctx context.Context, id string) (*order_cfg.Order, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select `+orderColumns+` from orders where id = $1`+db.forUpdate()+`;`, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, vanerrors.NewSimple(NotFound)
+	}
+
+	return &orders[0], nil
+}
+
+// Selects all orders of the user
+func (db *DB) GetOrders(ctx context.Context, userId uint64) ([]order_cfg.Order, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select `+orderColumns+` from orders where user_id = $1 order by created_at desc, id;`, userId)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanOrders(rows)
+}
+
+// Selects the open orders of the company of the side sorted by the price-time priority
+func (db *DB) GetOpenOrders(ctx context.Context, ticker string, side order_cfg.Side) ([]order_cfg.Order, error) {
+	direction := "asc"
+	if side == order_cfg.BUY {
+		direction = "desc"
+	}
+
+	rows, err := db.Conn().QueryContext(ctx, `select `+orderColumns+` from orders where ticker = $1 and side = $2 and status = $3 order by price `+direction+`, created_at, id`+db.forUpdate()+`;`, ticker, side, order_cfg.OPEN)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanOrders(rows)
+}
@@ -0,0 +1,167 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorUpdatingPrice = "error updating price"
+)
+
+// Gets the stock price of the company, nil if it isn't saved yet
+func (db *DB) GetPrice(ctx context.Context, ticker string) (*price_cfg.Price, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select price, price_updated_at from companies where ticker = $1`+db.forUpdate()+`;`, ticker)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if rows.Err() != nil {
+			return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+		}
+		return nil, vanerrors.NewSimple(NotFound)
+	}
+
+	var price sql.NullFloat64
+	var updatedAt time.Time
+	err = rows.Scan(&price, timeValue{&updatedAt})
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+	}
+
+	if !price.Valid {
+		return nil, nil
+	}
+
+	return &price_cfg.Price{Value: price.Float64, UpdatedAt: updatedAt}, nil
+}
+
+// Saves the stock price of the company
+func (db *DB) SetPrice(ctx context.Context, ticker string, p price_cfg.Price) error {
+	res, err := db.Conn().ExecContext(ctx, `update companies set price = $1, price_updated_at = $2 where ticker = $3;`, p.Value, p.UpdatedAt, ticker)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return vanerrors.NewWrap(ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+	}
+	if n == 0 {
+		return vanerrors.NewSimple(NotFound)
+	}
+
+	return nil
+}
+
+// Adds a price change of the company
+func (db *DB) AddTick(ctx context.Context, ticker string, t price_cfg.Tick) error {
+	_, err := db.Conn().ExecContext(ctx, `insert into price_ticks (ticker, time, price, volume) values ($1, $2, $3, $4);`, ticker, t.Time, t.Price, t.Volume)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Selects the price changes of the company from (including) to (excluding)
+func (db *DB) GetTicks(ctx context.Context, ticker string, from time.Time, to time.Time) ([]price_cfg.Tick, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select time, price, volume from price_ticks where ticker = $1 and time >= $2 and time < $3 order by time;`, ticker, from, to)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	res := []price_cfg.Tick{}
+	for rows.Next() {
+		var t price_cfg.Tick
+		err = rows.Scan(timeValue{&t.Time}, &t.Price, &t.Volume)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+		res = append(res, t)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
+
+// Removes the price changes of the company before the time
+func (db *DB) DeleteTicks(ctx context.Context, ticker string, before time.Time) (int64, error) {
+	res, err := db.Conn().ExecContext(ctx, `delete from price_ticks where ticker = $1 and time < $2;`, ticker, before)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+	}
+
+	return n, nil
+}
+
+// Saves the minute candles of the company in one transaction
+func (db *DB) AddCandles(ctx context.Context, ticker string, candles []price_cfg.Candle) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `insert into price_candles (ticker, start, open, high, low, close, volume) values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (ticker, start) do update set open = excluded.open, high = excluded.high, low = excluded.low, close = excluded.close, volume = excluded.volume;`)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	for _, c := range candles {
+		_, err = stmt.ExecContext(ctx, ticker, c.Start, c.Open, c.High, c.Low, c.Close, c.Volume)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingPrice, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Selects the minute candles of the company from (including) to (excluding)
+func (db *DB) GetCandles(ctx context.Context, ticker string, from time.Time, to time.Time) ([]price_cfg.Candle, error) {
+	rows, err := db.Conn().QueryContext(ctx, `select start, open, high, low, close, volume from price_candles where ticker = $1 and start >= $2 and start < $3 order by start;`, ticker, from, to)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	res := []price_cfg.Candle{}
+	for rows.Next() {
+		var c price_cfg.Candle
+		err = rows.Scan(timeValue{&c.Start}, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume)
+		if err != nil {
+			return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+		}
+		res = append(res, c)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return res, nil
+}
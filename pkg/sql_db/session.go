@@ -0,0 +1,138 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/session_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorInsertingSession = "error inserting session"
+	ErrorUpdatingSession  = "error updating session"
+)
+
+// Scans one session from rows
+func scanSession(rows *sql.Rows) (*session_cfg.Session, error) {
+	// Getting session
+	var session session_cfg.Session
+
+	if !rows.Next() {
+		return nil, vanerrors.NewSimple(NotFound)
+	}
+
+	err := rows.Scan(&session.Id, &session.UserId, &session.Token, &session.IsRevoked, timeValue{&session.ExpiresAt}, timeValue{&session.CreatedAt})
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorScanningRows, err, vanerrors.EmptyHandler)
+	}
+
+	if rows.Err() != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, rows.Err(), vanerrors.EmptyHandler)
+	}
+
+	return &session, nil
+}
+
+// Creates a new session
+func (db *DB) CreateSession(ctx context.Context, s session_cfg.Session) error {
+	// Prepares the query
+	query := `insert into sessions (id, user_id, token, is_revoked, expires_at, created_at) values ($1, $2, $3, $4, $5, $6);`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+
+	defer stmt.Close()
+
+	// Creates session
+	_, err = stmt.ExecContext(ctx, s.Id, s.UserId, s.Token, s.IsRevoked, s.ExpiresAt, s.CreatedAt)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorInsertingSession, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
+
+// Selects the session
+func (db *DB) GetSession(ctx context.Context, id string) (*session_cfg.Session, error) {
+	// Prepares the query
+	query := `select id, user_id, token, is_revoked, expires_at, created_at from sessions where id = $1` + db.forUpdate() + `;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Selects the session
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanSession(rows)
+}
+
+// Updates the refresh token of the session
+func (db *DB) UpdateSessionToken(ctx context.Context, id string, token string, expiresAt time.Time) (*session_cfg.Session, error) {
+	query := `update sessions set token = $1, expires_at = $2 where id = $3 returning id, user_id, token, is_revoked, expires_at, created_at;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the session
+	rows, err := stmt.QueryContext(ctx, token, expiresAt, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanSession(rows)
+}
+
+// Revokes the session
+func (db *DB) RevokeSession(ctx context.Context, id string) (*session_cfg.Session, error) {
+	query := `update sessions set is_revoked = true where id = $1 returning id, user_id, token, is_revoked, expires_at, created_at;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the session
+	rows, err := stmt.QueryContext(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+	}
+	defer rows.Close()
+
+	return scanSession(rows)
+}
+
+// Revokes all active sessions of the user
+func (db *DB) RevokeSessions(ctx context.Context, userId uint64) (int64, error) {
+	query := `update sessions set is_revoked = true where user_id = $1 and is_revoked = false;`
+
+	stmt, err := db.Conn().PrepareContext(ctx, query)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorPreparingQuery, err, vanerrors.EmptyHandler)
+	}
+	defer stmt.Close()
+
+	// Updating the sessions
+	res, err := stmt.ExecContext(ctx, userId)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+	}
+
+	return res.RowsAffected()
+}
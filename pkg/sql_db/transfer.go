@@ -0,0 +1,63 @@
+package sql_db
+
+import (
+	"context"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorStartingTransaction   = "error starting transaction"
+	ErrorCommittingTransaction = "error committing transaction"
+)
+
+// Moves solids from one user to another in one transaction
+func (db *DB) Transfer(ctx context.Context, from uint64, to uint64, amount int64, reason ledger_cfg.Reason) (*user_cfg.User, *user_cfg.User, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+	defer tx.Rollback()
+
+	// Locks both users in the id order, so two opposite transfers can't deadlock
+	rows, err := tx.QueryContext(ctx, `select id from users where id in ($1, $2) order by id`+db.dialect.Lock+`;`, from, to)
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	var n int
+	for rows.Next() {
+		n++
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorSelecting, err, vanerrors.EmptyHandler)
+	}
+
+	if n != 2 {
+		return nil, nil, vanerrors.NewSimple(NotFound)
+	}
+
+	// Moves the solids
+	fromUsr, err := db.applyChange(ctx, tx, db_cfg.BalanceChange{Id: from, Solids: -amount, Reason: reason})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toUsr, err := db.applyChange(ctx, tx, db_cfg.BalanceChange{Id: to, Solids: amount, Reason: reason})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return fromUsr, toUsr, nil
+}
@@ -0,0 +1,117 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// Runs queries in the data base or in the transaction
+type Querier interface {
+	Execer
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// The transaction of one operation
+//
+// Inside WithTx it is a savepoint of the outer transaction, so a failed operation is undone without aborting the outer transaction
+type Txn struct {
+	*sql.Tx
+	savepoint bool
+	done      bool
+}
+
+// Commits the transaction or releases the savepoint
+func (t *Txn) Commit() error {
+	if !t.savepoint {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+	_, err := t.Tx.Exec(`release savepoint operation;`)
+	return err
+}
+
+// Rolls back the transaction or the changes after the savepoint
+func (t *Txn) Rollback() error {
+	if !t.savepoint {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+
+	t.done = true
+	_, err := t.Tx.Exec(`rollback to savepoint operation;`)
+	return err
+}
+
+// Gets the transaction of WithTx or the data base
+func (db *DB) Conn() Querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.db
+}
+
+// Starts the transaction of one operation (a savepoint inside WithTx)
+func (db *DB) Begin(ctx context.Context) (*Txn, error) {
+	if db.tx == nil {
+		tx, err := db.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Txn{Tx: tx}, nil
+	}
+
+	// Postgres and sqlite use the newest savepoint with the name, so the savepoints can be nested
+	_, err := db.tx.ExecContext(ctx, `savepoint operation;`)
+	if err != nil {
+		return nil, err
+	}
+	return &Txn{Tx: db.tx, savepoint: true}, nil
+}
+
+// Gets the locking clause of the selects, the rows are only locked inside WithTx
+func (db *DB) forUpdate() string {
+	if db.tx != nil {
+		return db.dialect.Lock
+	}
+	return ``
+}
+
+// Runs the function in one transaction, the selected users, orders, companies, sessions and keys are locked until it ends (without the row locks the transaction locks the data base)
+//
+// The changes are committed if the function returns nil, the error of the function is returned as it is
+func (db *DB) WithTx(ctx context.Context, fn func(tx db_cfg.DataBase) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return vanerrors.NewWrap(ErrorStartingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	// The nested transactions use the same connection
+	txDB := db
+	if db.tx == nil {
+		txDB = &DB{db: db.db, tx: tx.Tx, key: db.key, dialect: db.dialect}
+	}
+
+	err = fn(txDB)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return vanerrors.NewWrap(ErrorCommittingTransaction, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package sqlite_db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/pkg/sql_db"
+	"github.com/vandi37/vanerrors"
+	_ "modernc.org/sqlite"
+)
+
+// The errors
+const (
+	ErrorOpeningDataBase = "error opining database"
+)
+
+// The db constructor
+type Constructor struct{}
+
+// The connection options
+//
+// The transactions take the write lock when they start and wait for it up to busy_timeout, the times are stored as unix microseconds
+const options = `?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_integer_format=unix_micro`
+
+// Opens the sqlite data base file (the name of the config), the queries are shared with postgres
+func (c Constructor) New(cfg config.DatabaseCfg, key string) (db_cfg.DataBase, error) {
+	db, err := sql.Open("sqlite", "file:"+cfg.Name+options)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorOpeningDataBase, err, vanerrors.EmptyHandler)
+	}
+	return sql_db.New(db, key, dialect), nil
+}
+
+// The sqlite dialect
+//
+// Every transaction has the write lock of the data base, so no rows are locked and the drifts are read in a plain transaction
+var dialect = sql_db.Dialect{
+	JSONObject: `json_group_object`,
+	Array:      func(a *[]string) any { return jsonArray{a} },
+	Init:       initDB,
+}
+
+// The string array stored as a json array
+type jsonArray struct {
+	a *[]string
+}
+
+// Gets the json of the array (nil is an empty array)
+func (j jsonArray) Value() (driver.Value, error) {
+	b, err := json.Marshal(sql_db.NotNull(*j.a))
+	return string(b), err
+}
+
+// Scans the json array
+func (j jsonArray) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), j.a)
+	case []byte:
+		return json.Unmarshal(src, j.a)
+	default:
+		return fmt.Errorf("unsupported array %T", src)
+	}
+}
+
+// Adds the column to the table created before the column was added (sqlite has no add column if not exists)
+func addColumn(ctx context.Context, db *sql_db.DB, table string, column string, definition string) error {
+	var n int
+	err := db.Conn().QueryRowContext(ctx, `select count(*) from pragma_table_info($1) where name = $2;`, table, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	_, err = db.Conn().ExecContext(ctx, `alter table `+table+` add column `+column+` `+definition+`;`)
+	return err
+}
+
+// Creates tables if not exist
+func initDB(ctx context.Context, db *sql_db.DB) error {
+	query := `CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		password TEXT NOT NULL,
+		solid_balance INTEGER DEFAULT 0,
+		is_blocked BOOLEAN DEFAULT FALSE,
+		last_farming INTEGER,
+		created_at INTEGER,
+		role TEXT NOT NULL DEFAULT 'user',
+		totp_secret TEXT NOT NULL DEFAULT '',
+		totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		recovery_codes TEXT NOT NULL DEFAULT '[]',
+		totp_last_step INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS companies (
+		ticker TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		price REAL,
+		price_updated_at INTEGER,
+		dividend_rate REAL NOT NULL DEFAULT 0,
+		created_at INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS holdings (
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		ticker TEXT NOT NULL REFERENCES companies (ticker),
+		amount INTEGER NOT NULL DEFAULT 0 CHECK (amount >= 0),
+		PRIMARY KEY (user_id, ticker)
+	);
+	CREATE INDEX IF NOT EXISTS holdings_ticker ON holdings (ticker);`
+
+	_, err := db.Conn().ExecContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	// The columns added after the table was created
+	err = addColumn(ctx, db, "users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	err = sql_db.CreateDefault(ctx, db.Conn())
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS ledger (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		kind TEXT NOT NULL,
+		reference TEXT NOT NULL DEFAULT '',
+		memo TEXT NOT NULL DEFAULT '',
+		ticker TEXT NOT NULL DEFAULT '',
+		solids INTEGER NOT NULL DEFAULT 0,
+		stocks INTEGER NOT NULL DEFAULT 0,
+		solid_balance INTEGER NOT NULL,
+		stock_balance INTEGER NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS ledger_user ON ledger (user_id, id);
+	CREATE TRIGGER IF NOT EXISTS ledger_immutable_update BEFORE UPDATE ON ledger
+	BEGIN
+		SELECT RAISE(ABORT, 'the ledger entries can''t be changed or removed');
+	END;
+	CREATE TRIGGER IF NOT EXISTS ledger_immutable_delete BEFORE DELETE ON ledger
+	BEGIN
+		SELECT RAISE(ABORT, 'the ledger entries can''t be changed or removed');
+	END;`
+
+	_, err = db.Conn().ExecContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	// The columns added after the table was created
+	err = addColumn(ctx, db, "ledger", "memo", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	// The balances before the ledger
+	err = sql_db.OpenLedger(ctx, db.Conn())
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS price_ticks (
+		ticker TEXT NOT NULL,
+		time INTEGER NOT NULL,
+		price REAL NOT NULL,
+		volume INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS price_candles (
+		ticker TEXT NOT NULL,
+		start INTEGER NOT NULL,
+		open REAL NOT NULL,
+		high REAL NOT NULL,
+		low REAL NOT NULL,
+		close REAL NOT NULL,
+		volume INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS price_ticks_ticker_time ON price_ticks (ticker, time);
+	CREATE UNIQUE INDEX IF NOT EXISTS price_candles_ticker_start ON price_candles (ticker, start);`
+
+	_, err = db.Conn().ExecContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS orders (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		ticker TEXT NOT NULL REFERENCES companies (ticker),
+		side TEXT NOT NULL,
+		price INTEGER NOT NULL,
+		amount INTEGER NOT NULL,
+		filled INTEGER NOT NULL DEFAULT 0,
+		reserved INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS orders_user ON orders (user_id);
+	CREATE INDEX IF NOT EXISTS orders_open_ticker ON orders (ticker, side, price, created_at) WHERE status = 'open';`
+
+	_, err = db.Conn().ExecContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		token TEXT NOT NULL,
+		is_revoked BOOLEAN DEFAULT FALSE,
+		expires_at INTEGER NOT NULL,
+		created_at INTEGER
+	);
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		is_revoked BOOLEAN DEFAULT FALSE,
+		expires_at INTEGER,
+		created_at INTEGER
+	);`
+
+	_, err = db.Conn().ExecContext(ctx, query)
+	if err != nil {
+		return vanerrors.NewWrap(sql_db.ErrorCreateTable, err, vanerrors.EmptyHandler)
+	}
+
+	return nil
+}
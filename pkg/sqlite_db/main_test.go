@@ -0,0 +1,16 @@
+package sqlite_db_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/sqlite_db"
+)
+
+func TestSqliteDB(t *testing.T) {
+	dbtest.Run(t, sqlite_db.Constructor{}, func(t *testing.T) config.DatabaseCfg {
+		return config.DatabaseCfg{Type: "sqlite", Name: filepath.Join(t.TempDir(), "db.sqlite")}
+	})
+}
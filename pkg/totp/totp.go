@@ -0,0 +1,146 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorGeneratingSecret = "error generating secret" // error generating secret
+	InvalidSecret         = "invalid secret"          // invalid secret
+)
+
+// The secret encoding (base32 without padding, as authenticator apps expect)
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// The time based one time password generator (RFC 6238, HMAC-SHA1)
+//
+// Period: the time step
+// Digits: the code length
+// Skew: the amount of steps before and after the current one that are accepted
+// Now: the clock, it could be replaced to check codes with a fixed time
+type TOTP struct {
+	Period time.Duration
+	Digits int
+	Skew   int
+	Now    func() time.Time
+}
+
+// Creates a new generator with the standard settings (30 seconds, 6 digits, one step of skew)
+func New() *TOTP {
+	return &TOTP{
+		Period: time.Second * 30,
+		Digits: 6,
+		Skew:   1,
+		Now:    time.Now,
+	}
+}
+
+// Generates a new random secret (160 bits)
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 20)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", vanerrors.NewWrap(ErrorGeneratingSecret, err, vanerrors.EmptyHandler)
+	}
+	return encoding.EncodeToString(buf), nil
+}
+
+// Decodes the secret
+func decode(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, vanerrors.NewWrap(InvalidSecret, err, vanerrors.EmptyHandler)
+	}
+	return key, nil
+}
+
+// Gets the code of the counter (RFC 4226)
+func (t TOTP) hotp(key []byte, counter uint64) string {
+	// Getting the hmac of the counter
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	// Getting the digits
+	mod := uint32(1)
+	for range t.Digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.Digits, value%mod)
+}
+
+// Gets the counter of the time
+func (t TOTP) counter(at time.Time) uint64 {
+	return uint64(at.Unix()) / uint64(t.Period/time.Second)
+}
+
+// Gets the code at the time
+func (t TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+	return t.hotp(key, t.counter(at)), nil
+}
+
+// Checks the code at the current time (with skew)
+func (t TOTP) Validate(secret string, code string) bool {
+	_, ok := t.Verify(secret, code, 0)
+	return ok
+}
+
+// Checks the code at the current time (with skew), the codes of the last step and the steps before are refused
+//
+// Returns the step of the code, it is the last step of the next check, so every code is accepted once
+func (t TOTP) Verify(secret string, code string, last uint64) (uint64, bool) {
+	key, err := decode(secret)
+	if err != nil || len(code) != t.Digits {
+		return 0, false
+	}
+
+	counter := t.counter(t.Now())
+	for i := -t.Skew; i <= t.Skew; i++ {
+		step := counter + uint64(i)
+		if step <= last {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(t.hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// Creates the otpauth uri for authenticator apps
+func (t TOTP) URI(issuer string, account string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(t.Digits))
+	values.Set("period", fmt.Sprint(int(t.Period/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
@@ -0,0 +1,91 @@
+package totp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/pkg/totp"
+)
+
+// The secret of the RFC 6238 test vectors ("12345678901234567890")
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Creates the generator with the fixed clock
+func fixed(now time.Time) *totp.TOTP {
+	t := totp.New()
+	t.Now = func() time.Time { return now }
+	return t
+}
+
+// Gets the code at the time
+func code(t *testing.T, at time.Time) string {
+	t.Helper()
+
+	c, err := totp.New().Code(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCode(t *testing.T) {
+	// The last 6 digits of the RFC 6238 SHA1 codes
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if got := code(t, time.Unix(unix, 0)); got != want {
+			t.Errorf("at %d: want %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	gen := fixed(now)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		ok   bool
+	}{
+		{"current", now, true},
+		{"previous step", now.Add(-30 * time.Second), true},
+		{"next step", now.Add(30 * time.Second), true},
+		{"expired", now.Add(-60 * time.Second), false},
+		{"too early", now.Add(60 * time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gen.Validate(secret, code(t, tt.at)); got != tt.ok {
+				t.Fatalf("want %v, got %v", tt.ok, got)
+			}
+		})
+	}
+
+	if gen.Validate(secret, "12345") || gen.Validate("not base32!", code(t, now)) {
+		t.Fatal("an invalid code or secret is accepted")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	gen := fixed(now)
+
+	// The code is accepted once
+	step, ok := gen.Verify(secret, code(t, now), 0)
+	if !ok {
+		t.Fatal("the code isn't accepted")
+	}
+	_, ok = gen.Verify(secret, code(t, now), step)
+	if ok {
+		t.Fatal("the used code is accepted")
+	}
+
+	// The code of the step before the used one is refused, the next one is accepted
+	_, ok = gen.Verify(secret, code(t, now.Add(-30*time.Second)), step)
+	if ok {
+		t.Fatal("the code before the used one is accepted")
+	}
+	next, ok := gen.Verify(secret, code(t, now.Add(30*time.Second)), step)
+	if !ok || next != step+1 {
+		t.Fatalf("want the next step %d accepted, got %d %v", step+1, next, ok)
+	}
+}
@@ -0,0 +1,97 @@
+package user_service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vandi37/StocksBack/config/company_cfg"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorSelectingCompany = "error selecting company"
+	ErrorCreatingCompany  = "error creating company"
+	CompanyExists         = "company exists"
+)
+
+// Company data
+//
+// Price: the initial stock price, if it is zero the initial market price is used
+// DividendRate: the solids paid for one stock on every stock update
+type NewCompany struct {
+	Ticker       string  `json:"ticker"`
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	DividendRate float64 `json:"dividend_rate"`
+}
+
+// Creates the company
+func (n NewCompany) Create(ctx context.Context, db db_cfg.DataBase) (*company_cfg.Company, error) {
+	// Creates the company
+	c, err := company_cfg.NewCompany(n.Ticker, n.Name, n.Price, n.DividendRate)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Checks the ticker
+		_, err := tx.GetCompany(ctx, c.Ticker)
+		if err == nil {
+			return vanerrors.NewSimple(CompanyExists, fmt.Sprintf("company %s already exists", c.Ticker))
+		}
+
+		// Creates the company in the data base
+		err = tx.CreateCompany(ctx, *c)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorCreatingCompany, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Gets the company by the ticker, the empty ticker is the default company
+func GetCompany(ctx context.Context, ticker string, db db_cfg.DataBase) (*company_cfg.Company, error) {
+	// Checks the ticker
+	ticker, err := company_cfg.ParseTicker(ticker)
+	if err != nil {
+		return nil, err
+	}
+
+	// Selects the company
+	c, err := db.GetCompany(ctx, ticker)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelectingCompany, err, vanerrors.EmptyHandler)
+	}
+
+	return c, nil
+}
+
+// Gets all companies with the current prices
+func GetCompanies(ctx context.Context, db db_cfg.DataBase) ([]company_cfg.Company, error) {
+	companies, err := db.GetCompanies(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelectingCompany, err, vanerrors.EmptyHandler)
+	}
+
+	// The companies without price have the initial price
+	for i := range companies {
+		if companies[i].Price != nil {
+			continue
+		}
+
+		companies[i].Price, err = Market.Price(ctx, companies[i].Ticker, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return companies, nil
+}
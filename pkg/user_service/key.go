@@ -0,0 +1,150 @@
+package user_service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/key_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorCreatingKey  = "error creating key"
+	ErrorSelectingKey = "error selecting key"
+	ErrorUpdatingKey  = "error updating key"
+	KeyIsRevoked      = "key is revoked"
+	KeyIsExpired      = "key is expired"
+	ScopeNotAllowed   = "scope not allowed"
+	NotKeyOwner       = "not key owner"
+	InvalidExpiry     = "invalid expiry"
+)
+
+// New api key data
+type NewKey struct {
+	Name      string          `json:"name"`
+	Scopes    []key_cfg.Scope `json:"scopes"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Sign in data with api key
+type SignInApiKey struct {
+	Key string `json:"key"`
+}
+
+// Creates a new api key for the user, the scopes should be allowed for the creator
+func (k NewKey) Create(ctx context.Context, id uint64, allowed []key_cfg.Scope, db db_cfg.DataBase) (*key_cfg.Key, string, error) {
+	// Checks the scopes
+	for _, s := range k.Scopes {
+		if !slices.Contains(allowed, s) {
+			return nil, "", vanerrors.NewSimple(ScopeNotAllowed, fmt.Sprintf("scope %s is not allowed", s))
+		}
+	}
+
+	// Checks the expiry
+	if !k.ExpiresAt.IsZero() && k.ExpiresAt.Before(time.Now()) {
+		return nil, "", vanerrors.NewSimple(InvalidExpiry, "the key would be already expired")
+	}
+
+	// Selects the user by id
+	usr, err := Get(ctx, id, db)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Creates the key
+	key, secret, err := key_cfg.NewKey(usr.Id, k.Name, k.Scopes, k.ExpiresAt)
+	if err != nil {
+		return nil, "", vanerrors.NewWrap(ErrorCreatingKey, err, vanerrors.EmptyHandler)
+	}
+
+	// Saves the key
+	err = db.CreateKey(ctx, *key)
+	if err != nil {
+		return nil, "", vanerrors.NewWrap(ErrorCreatingKey, err, vanerrors.EmptyHandler)
+	}
+
+	return key, secret, nil
+}
+
+// Signs in with the api key, returns the owner and the key
+func (k SignInApiKey) SignIn(ctx context.Context, db db_cfg.DataBase) (*user_cfg.User, *key_cfg.Key, error) {
+	// Parses the key
+	id, secret, err := key_cfg.ParseKey(k.Key)
+	if err != nil {
+		return nil, nil, vanerrors.NewSimple(WrongKey)
+	}
+
+	// Selects the key
+	key, err := db.GetKey(ctx, id)
+	if err != nil {
+		return nil, nil, vanerrors.NewSimple(WrongKey)
+	}
+
+	// Checks the key
+	if !key.CheckSecret(secret) {
+		return nil, nil, vanerrors.NewSimple(WrongKey)
+	}
+	if key.IsRevoked {
+		return nil, nil, vanerrors.NewSimple(KeyIsRevoked)
+	}
+	if !key.IsActive() {
+		return nil, nil, vanerrors.NewSimple(KeyIsExpired)
+	}
+
+	// Getting user
+	usr, err := Get(ctx, key.UserId, db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return usr, key, nil
+}
+
+// Gets all api keys of the user
+func GetKeys(ctx context.Context, id uint64, db db_cfg.DataBase) ([]key_cfg.Key, error) {
+	keys, err := db.GetKeys(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelectingKey, err, vanerrors.EmptyHandler)
+	}
+	return keys, nil
+}
+
+// Revokes the api key of the user
+func RevokeKey(ctx context.Context, id uint64, keyId string, db db_cfg.DataBase) (*key_cfg.Key, error) {
+	var key *key_cfg.Key
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the key
+		var err error
+		key, err = tx.GetKey(ctx, keyId)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorSelectingKey, err, vanerrors.EmptyHandler)
+		}
+
+		// Checks the owner
+		if key.UserId != id {
+			key = nil
+			return vanerrors.NewSimple(NotKeyOwner)
+		}
+
+		// Checks that the key is not revoked
+		if key.IsRevoked {
+			return vanerrors.NewSimple(KeyIsRevoked)
+		}
+
+		// Revokes the key
+		key, err = tx.RevokeKey(ctx, key.Id)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingKey, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+
+	return key, err
+}
@@ -0,0 +1,41 @@
+package user_service
+
+import (
+	"context"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorSelectingHistory = "error selecting history"
+)
+
+// The maximum amount of ledger entries on one history page
+var LedgerPageLimit = 50
+
+// Gets a page of the ledger entries of the user, the newest first
+//
+// Before: the next value of the previous page (zero for the first page)
+// Limit: the page size, the zero limit or a limit over LedgerPageLimit is LedgerPageLimit
+// Returns the entries and the before of the next page (zero if it is the last page)
+func History(ctx context.Context, id uint64, before uint64, limit int, db db_cfg.DataBase) ([]ledger_cfg.Entry, uint64, error) {
+	if limit <= 0 || limit > LedgerPageLimit {
+		limit = LedgerPageLimit
+	}
+
+	// Selects one more entry to know is there a next page
+	entries, err := db.GetEntries(ctx, id, before, limit+1)
+	if err != nil {
+		return nil, 0, vanerrors.NewWrap(ErrorSelectingHistory, err, vanerrors.EmptyHandler)
+	}
+
+	var next uint64
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = entries[limit-1].Id
+	}
+
+	return entries, next, nil
+}
@@ -1,13 +1,20 @@
 package user_service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand/v2"
 	"net/http"
 	"time"
 
+	"github.com/vandi37/StocksBack/config/company_cfg"
 	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
 	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/price"
 	"github.com/vandi37/StocksBack/pkg/query"
 	"github.com/vandi37/vanerrors"
 )
@@ -20,29 +27,48 @@ const (
 	ToEarlyFarming     = "to early farming"
 	ErrorUpdatingUser  = "error updating user"
 	NotEnoughSolids    = "not enough solids"
+	NotEnoughStocks    = "not enough stocks"
 	UserIsBlocked      = "user is blocked"
 	UserIsNotBlocked   = "user isn't blocked"
 	ErrorCheckingKey   = "error getting key"
 	WrongKey           = "wrong key"
+	UserHasRole        = "user has role"
 )
 
 // Gets the code by name
 func GetCode(err error) int {
+	// The operation timed out or was canceled (the client is gone or the server is stopping)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	} else if errors.Is(err, context.Canceled) {
+		return http.StatusServiceUnavailable
+	}
+
 	s := vanerrors.GetName(err)
-	if s == ErrorGettingId || s == ErrorSelectingUser || s == ErrorUpdatingUser || s == ErrorCheckingKey {
+	if s == ErrorGettingId || s == ErrorSelectingUser || s == ErrorUpdatingUser || s == ErrorCheckingKey ||
+		s == ErrorCreatingSession || s == ErrorUpdatingSession || s == ErrorCreatingKey || s == ErrorUpdatingKey ||
+		s == ErrorEnrollingTwoFactor || s == ErrorCheckingTwoFactor || s == price.ErrorGettingPrice || s == price.ErrorSavingPrice ||
+		s == price.ErrorGettingHistory || s == price.ErrorDownsamplingTicks || s == ErrorSavingOrder ||
+		s == ErrorCreatingCompany || s == ErrorSelectingHistory || s == ErrorReconciling {
 		return http.StatusInternalServerError
 	} else if s == ToEarlyFarming {
 		return http.StatusTooManyRequests
-	} else if s == WrongKey {
+	} else if s == WrongKey || s == ErrorSelectingSession || s == SessionIsRevoked || s == SessionIsExpired ||
+		s == session_cfg.InvalidRefreshToken || s == KeyIsRevoked || s == KeyIsExpired || s == TwoFactorRequired || s == WrongCode {
 		return http.StatusUnauthorized
+	} else if s == ScopeNotAllowed || s == NotKeyOwner || s == NotOrderOwner {
+		return http.StatusForbidden
+	} else if s == ErrorSelectingKey || s == ErrorSelectingOrder || s == ErrorSelectingCompany {
+		return http.StatusNotFound
 	}
 	return http.StatusBadRequest
 }
 
 // Global variables
 var (
-	FarmingLimit       = time.Hour // the farming limit
-	StockCost    int64 = 30        // the stock cost
+	FarmingLimit       = time.Hour                        // the farming limit
+	SellFee      int64 = 0                                // the fee of selling stocks in percents
+	Market             = price.New(30, 0.001, 0.01, 1, 0) // the stock price engine of all companies
 )
 
 // Sign up data
@@ -55,41 +81,56 @@ type SignUpUser struct {
 type SignInUser struct {
 	Id       uint64 `json:"id"`
 	Password string `json:"password"`
+	Code     string `json:"code"` // the two factor code, required if two factor is enabled
 }
 
-// Sign in data with key
+// Sign in data with the admin key (the bootstrap superadmin credential)
 type SignInKey struct {
 	Key string `json:"key"`
 	Id  uint64 `json:"id"`
 }
 
 // Creates a new user
-func (u SignUpUser) SignUp(db db_cfg.DataBase) (*user_cfg.User, error) {
-	// Gets the length of users
-	id, err := db.Len()
+func (u SignUpUser) SignUp(ctx context.Context, db db_cfg.DataBase) (*user_cfg.User, error) {
+	// Checks the password, the rule error is returned as is
+	err := user_cfg.Policy.Check(u.Password)
 	if err != nil {
-		return nil, vanerrors.NewWrap(ErrorGettingId, err, vanerrors.EmptyHandler)
+		return nil, err
 	}
 
-	// Created a new user
-	usr, err := user_cfg.NewUser(u.Name, u.Password, id)
-	if err != nil {
-		return nil, vanerrors.NewWrap(ErrorCreatingUser, err, vanerrors.EmptyHandler)
-	}
+	var usr *user_cfg.User
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Gets the length of users
+		id, err := tx.Len(ctx)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorGettingId, err, vanerrors.EmptyHandler)
+		}
+
+		// Created a new user
+		usr, err = user_cfg.NewUser(u.Name, u.Password, id)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorCreatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		// Creates the user in the data base
+		err = tx.Create(ctx, *usr)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
 
-	// Creates the user in the data base
-	err = db.Create(*usr)
+		return nil
+	})
 	if err != nil {
-		return nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		return nil, err
 	}
 
 	return usr, nil
 }
 
 // Signing in with secret key
-func (u SignInKey) SignInWithKey(db db_cfg.DataBase) (*user_cfg.User, error) {
+func (u SignInKey) SignInWithKey(ctx context.Context, db db_cfg.DataBase) (*user_cfg.User, error) {
 	// Checking key
-	ok, err := db.CheckKey(u.Key)
+	ok, err := db.CheckKey(ctx, u.Key)
 
 	// Error
 	if err != nil {
@@ -102,7 +143,7 @@ func (u SignInKey) SignInWithKey(db db_cfg.DataBase) (*user_cfg.User, error) {
 	}
 
 	// Getting user
-	usr, err := db.GetOne(u.Id)
+	usr, err := db.GetOne(ctx, u.Id)
 	if err != nil {
 		return nil, vanerrors.NewWrap(ErrorSelectingUser, err, vanerrors.EmptyHandler)
 	}
@@ -111,26 +152,57 @@ func (u SignInKey) SignInWithKey(db db_cfg.DataBase) (*user_cfg.User, error) {
 }
 
 // Signs in
-func (u SignInUser) SignIn(db db_cfg.DataBase) (bool, *user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(u.Id, db)
-	if err != nil {
-		return false, nil, err
-	}
+//
+// The user is locked, so a recovery code can't be used twice
+func (u SignInUser) SignIn(ctx context.Context, db db_cfg.DataBase) (bool, *user_cfg.User, error) {
+	var ok bool
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, u.Id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks the password
+		ok = usr.CheckPassword(u.Password)
+		if !ok {
+			return nil
+		}
+
+		// Checks the two factor code
+		usr, err = CheckTwoFactor(ctx, usr, u.Code, tx)
+		if err != nil {
+			return err
+		}
+
+		// Upgrades the legacy hash, the password is already checked so a failure doesn't stop signing in (only the upgrade is undone)
+		if usr.NeedsRehash() && usr.Rehash(u.Password) == nil {
+			tx.WithTx(ctx, func(tx db_cfg.DataBase) error {
+				updated, err := tx.UpdatePassword(ctx, usr.Id, usr.Password)
+				if err != nil {
+					return err
+				}
+				usr = updated
+				return nil
+			})
+		}
 
-	// Checks the password
-	ok := usr.CheckPassword(u.Password)
-	if ok {
-		return true, usr, nil
+		return nil
+	})
+	if err != nil || !ok {
+		return false, nil, err
 	}
 
-	return false, nil, nil
+	return true, usr, nil
 }
 
 // Gets user
-func Get(id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
+func Get(ctx context.Context, id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
 	// Selects the user by id
-	usr, err := db.GetOne(id)
+	usr, err := db.GetOne(ctx, id)
 	if err != nil {
 		return nil, vanerrors.NewWrap(ErrorSelectingUser, err, vanerrors.EmptyHandler)
 	}
@@ -138,47 +210,84 @@ func Get(id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
 }
 
 // Farms
-func Farm(id uint64, db db_cfg.DataBase) (int64, *user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(id, db)
+//
+// The user is locked until the farm is saved, so the user can't farm twice in the limit
+func Farm(ctx context.Context, id uint64, db db_cfg.DataBase) (int64, *user_cfg.User, error) {
+	// Gets the stock price of the default company
+	p, err := Market.Price(ctx, company_cfg.DefaultTicker, db)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	// Checks the limit
-	expected_time := time.Now().Add(-FarmingLimit)
-	if usr.LastFarming.After(expected_time) {
-		return 0, usr, vanerrors.NewSimple(ToEarlyFarming, time.Until(expected_time).String())
+	reason, err := ledger_cfg.NewReason(ledger_cfg.FARM)
+	if err != nil {
+		return 0, nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
 	}
 
-	// Gets the maximum value
-	var max int64 = usr.StockBalance
-	if max <= StockCost {
-		max = StockCost
-	}
+	var amount int64
+	var usr *user_cfg.User
 
-	// Gets the random value
-	amount := rand.Int64N(max)
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
 
-	// Edits the user
+		// Checks the limit
+		expected_time := time.Now().Add(-FarmingLimit)
+		if usr.LastFarming.After(expected_time) {
+			return vanerrors.NewSimple(ToEarlyFarming, time.Until(expected_time).String())
+		}
 
-	usr, err = db.UpdateLastFarm(id)
-	if err != nil {
-		return amount, usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
-	}
+		// Gets the maximum value
+		var max int64 = usr.TotalStocks()
+		if cost := int64(math.Ceil(p.Value)); max <= cost {
+			max = cost
+		}
+
+		// Gets the random value
+		amount = rand.Int64N(max)
 
-	usr, err = db.UpdateSolids(id, amount)
+		// Edits the user
+
+		usr, err = tx.UpdateLastFarm(ctx, id)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		usr, err = tx.UpdateSolids(ctx, id, amount, reason)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return amount, usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		return 0, usr, err
 	}
 
 	return amount, usr, nil
 }
 
-// Updates all users with stacks
-func StockUpdate(db db_cfg.DataBase) ([]user_cfg.User, error) {
+// Pays the dividends of all companies to all users with stocks, returns the paid users
+//
+// Every user is paid in a transaction with the locked holdings
+func StockUpdate(ctx context.Context, db db_cfg.DataBase) ([]user_cfg.User, error) {
+	// Selects all companies
+	list, err := db.GetCompanies(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelectingCompany, err, vanerrors.EmptyHandler)
+	}
+
+	companies := map[string]company_cfg.Company{}
+	for _, c := range list {
+		companies[c.Ticker] = c
+	}
+
 	// Selects all users by query
-	users, err := db.GetAllBy(query.Query{
+	users, err := db.GetAllBy(ctx, query.Query{
 		{
 			Separator: query.NOT_SEPARATOR,
 			Type:      query.STOCK_BALANCE,
@@ -198,127 +307,421 @@ func StockUpdate(db db_cfg.DataBase) ([]user_cfg.User, error) {
 		return nil, vanerrors.NewWrap(ErrorSelectingUser, err, vanerrors.EmptyHandler)
 	}
 
-	for i := range users {
-
-		usr := &users[i]
+	// All dividends of the update have the same reference
+	reason, err := ledger_cfg.NewReason(ledger_cfg.DIVIDEND)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+	}
 
-		// Updates the user
-		usr, err = db.UpdateSolids(usr.Id, usr.StockBalance)
+	paid := []user_cfg.User{}
+	for _, usr := range users {
+		var updated *user_cfg.User
+
+		err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+			// Selects the user again, the holdings could be changed
+			locked, err := Get(ctx, usr.Id, tx)
+			if err != nil {
+				return err
+			}
+
+			// Gets the dividends of all holdings
+			var dividend int64
+			for ticker, n := range locked.Holdings {
+				dividend += companies[ticker].Dividend(n)
+			}
+
+			if dividend <= 0 || locked.IsBlocked {
+				return nil
+			}
+
+			// Updates the user
+			updated, err = tx.UpdateSolids(ctx, locked.Id, dividend, reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+
+			return nil
+		})
 		if err != nil {
-			return users, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			return paid, err
+		}
+
+		if updated != nil {
+			paid = append(paid, *updated)
 		}
-		users[i] = *usr
 	}
 
-	return users, nil
+	return paid, nil
 }
 
-// Byes stocks
-func BuyStocks(id uint64, num int64, db db_cfg.DataBase) (*user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(id, db)
+// Byes stocks of the company at the market price, returns the cost and the user
+//
+// The company is locked before the user (as in all transactions), the price and the user are locked until the trade is saved
+func BuyStocks(ctx context.Context, id uint64, ticker string, num int64, db db_cfg.DataBase) (int64, *user_cfg.User, error) {
+	// Checks the amount
+	if num <= 0 {
+		return 0, nil, vanerrors.NewSimple(InvalidAmount, "the amount should be positive")
+	}
+
+	reason, err := ledger_cfg.NewReason(ledger_cfg.BUY)
 	if err != nil {
-		return nil, err
+		return 0, nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
 	}
 
-	// Gets the cost
-	cost := num * StockCost
+	var cost int64
+	var usr *user_cfg.User
 
-	// Checks user balance
-	if usr.SolidBalance < cost {
-		return usr, vanerrors.NewSimple(NotEnoughSolids, fmt.Sprintf("has %d, need %d", usr.SolidBalance, cost))
-	}
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the company
+		c, err := GetCompany(ctx, ticker, tx)
+		if err != nil {
+			return err
+		}
 
-	// Updates the user
+		// Selects the user by id
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
 
-	usr, err = db.UpdateSolids(usr.Id, -cost)
-	if err != nil {
-		return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
-	}
+		// Buys at the market
+		cost, _, err = Market.Buy(ctx, c.Ticker, num, tx, func(cost int64, tx db_cfg.DataBase) error {
+			// Checks user balance
+			if usr.SolidBalance < cost {
+				return vanerrors.NewSimple(NotEnoughSolids, fmt.Sprintf("has %d, need %d", usr.SolidBalance, cost))
+			}
 
-	usr, err = db.UpdateStocks(usr.Id, num)
+			// Updates the user
+
+			usr, err = tx.UpdateSolids(ctx, usr.Id, -cost, reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+
+			usr, err = tx.UpdateStocks(ctx, usr.Id, c.Ticker, num, reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+
+			return nil
+		})
+		return err
+	})
 	if err != nil {
-		return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		return 0, usr, err
 	}
 
-	return usr, nil
+	return cost, usr, nil
 }
 
-// Updates the user name
-func UpdateName(id uint64, name string, db db_cfg.DataBase) (*user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(id, db)
+// Gets the amount without the sell fee
+func withoutFee(amount int64) int64 {
+	return amount - (amount/100*SellFee + amount%100*SellFee/100)
+}
+
+// Sells stocks of the company at the market price, returns the solids got and the user
+//
+// The sell fee is taken from the amount, the company and the user are locked as in BuyStocks
+func SellStocks(ctx context.Context, id uint64, ticker string, num int64, db db_cfg.DataBase) (int64, *user_cfg.User, error) {
+	// Checks the amount
+	if num <= 0 {
+		return 0, nil, vanerrors.NewSimple(InvalidAmount, "the amount should be positive")
+	}
+
+	reason, err := ledger_cfg.NewReason(ledger_cfg.SELL)
 	if err != nil {
-		return nil, err
+		return 0, nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
 	}
 
-	// Updates the user
-	usr, err = db.UpdateName(usr.Id, name)
+	var amount int64
+	var usr *user_cfg.User
+
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the company
+		c, err := GetCompany(ctx, ticker, tx)
+		if err != nil {
+			return err
+		}
+
+		// Selects the user by id
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks user stocks
+		if usr.Stocks(c.Ticker) < num {
+			return vanerrors.NewSimple(NotEnoughStocks, fmt.Sprintf("has %d, need %d", usr.Stocks(c.Ticker), num))
+		}
+
+		// Sells at the market
+		amount, _, err = Market.Sell(ctx, c.Ticker, num, tx, func(amount int64, tx db_cfg.DataBase) error {
+			// Updates the user
+
+			usr, err = tx.UpdateStocks(ctx, usr.Id, c.Ticker, -num, reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+
+			usr, err = tx.UpdateSolids(ctx, usr.Id, withoutFee(amount), reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+
+			return nil
+		})
+		return err
+	})
 	if err != nil {
-		return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		return 0, usr, err
 	}
 
-	return usr, nil
+	return withoutFee(amount), usr, nil
 }
 
-// Updates the user password
-func UpdatePassword(id uint64, password string, db db_cfg.DataBase) (*user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(id, db)
+// Gets the company with the stock price, the cost of buying and the amount of selling one stock (with the sell fee)
+func GetPrice(ctx context.Context, ticker string, db db_cfg.DataBase) (*company_cfg.Company, int64, int64, error) {
+	// Selects the company
+	c, err := GetCompany(ctx, ticker, db)
 	if err != nil {
-		return nil, err
+		return nil, 0, 0, err
 	}
 
-	// Updates the password
-	usr.NewPassword(password)
-	usr, err = db.UpdatePassword(usr.Id, usr.Password)
+	c.Price, err = Market.Price(ctx, c.Ticker, db)
 	if err != nil {
-		return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		return nil, 0, 0, err
 	}
 
-	return usr, nil
+	cost, amount, err := Market.Quote(*c.Price, 1)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return c, cost, withoutFee(amount), nil
 }
 
-// Blocks the user
-func Block(id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(id, db)
+// Moves the stock prices of all companies randomly, returns the companies with the new prices
+func MovePrices(ctx context.Context, db db_cfg.DataBase) ([]company_cfg.Company, error) {
+	companies, err := db.GetCompanies(ctx)
 	if err != nil {
-		return nil, err
+		return nil, vanerrors.NewWrap(ErrorSelectingCompany, err, vanerrors.EmptyHandler)
 	}
 
-	// Checks that the user is not blocked
-	if usr.IsBlocked {
-		return usr, vanerrors.NewSimple(UserIsBlocked)
+	for i := range companies {
+		companies[i].Price, err = Market.Move(ctx, companies[i].Ticker, db)
+		if err != nil {
+			return companies[:i], err
+		}
 	}
 
-	// Blocks user
-	usr, err = db.UpdateBlock(usr.Id, true)
-	if err != nil {
-		return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
-	}
+	return companies, nil
+}
 
-	return usr, nil
+// Updates the user name
+func UpdateName(ctx context.Context, id uint64, name string, db db_cfg.DataBase) (*user_cfg.User, error) {
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Updates the user
+		usr, err = tx.UpdateName(ctx, usr.Id, name)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+
+	return usr, err
+}
+
+// Updates the user password and signs out everywhere in one transaction
+func UpdatePassword(ctx context.Context, id uint64, password string, db db_cfg.DataBase) (*user_cfg.User, error) {
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks the password, the rule error is returned as is
+		err = user_cfg.Policy.Check(password)
+		if err != nil {
+			return err
+		}
+
+		// Updates the password
+		err = usr.NewPassword(password)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		usr, err = tx.UpdatePassword(ctx, usr.Id, usr.Password)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		// Signs out everywhere
+		_, err = SignOutAll(ctx, usr.Id, tx)
+		return err
+	})
+
+	return usr, err
+}
+
+// Blocks the user and signs out everywhere in one transaction
+func Block(ctx context.Context, id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks that the user is not blocked
+		if usr.IsBlocked {
+			return vanerrors.NewSimple(UserIsBlocked)
+		}
+
+		// Blocks user
+		usr, err = tx.UpdateBlock(ctx, usr.Id, true)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		// Signs out everywhere
+		_, err = SignOutAll(ctx, usr.Id, tx)
+		return err
+	})
+
+	return usr, err
 }
 
 // Unblocks the user
-func Unblock(id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
-	// Selects the user by id
-	usr, err := Get(id, db)
+func Unblock(ctx context.Context, id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks that the user is blocked
+		if !usr.IsBlocked {
+			return vanerrors.NewSimple(UserIsNotBlocked)
+		}
+
+		// Blocks user
+		usr, err = tx.UpdateBlock(ctx, usr.Id, false)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+
+	return usr, err
+}
+
+// Changes the user role
+func SetRole(ctx context.Context, id uint64, role user_cfg.Role, db db_cfg.DataBase) (*user_cfg.User, error) {
+	// Checks the role
+	err := role.Valid()
 	if err != nil {
 		return nil, err
 	}
 
-	// Checks that the user is blocked
-	if !usr.IsBlocked {
-		return usr, vanerrors.NewSimple(UserIsNotBlocked)
-	}
+	var usr *user_cfg.User
+
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks the current role
+		if usr.GetRole() == role {
+			return vanerrors.NewSimple(UserHasRole, fmt.Sprintf("user already is %s", role))
+		}
+
+		// Updates the role
+		usr, err = tx.UpdateRole(ctx, usr.Id, role)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
 
-	// Blocks user
-	usr, err = db.UpdateBlock(usr.Id, false)
+		return nil
+	})
+
+	return usr, err
+}
+
+// Adjusts the user balances, the stocks are stocks of the company (admin operation)
+//
+// Both balances are changed in one transaction
+func Adjust(ctx context.Context, id uint64, ticker string, solids int64, stocks int64, db db_cfg.DataBase) (*user_cfg.User, error) {
+	reason, err := ledger_cfg.NewReason(ledger_cfg.ADJUSTMENT)
 	if err != nil {
-		return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		return nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
 	}
 
-	return usr, nil
+	var usr *user_cfg.User
+
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the company
+		c, err := GetCompany(ctx, ticker, tx)
+		if err != nil {
+			return err
+		}
+
+		// Selects the user by id
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks user balance
+		if usr.SolidBalance+solids < 0 {
+			return vanerrors.NewSimple(NotEnoughSolids, fmt.Sprintf("has %d, need %d", usr.SolidBalance, -solids))
+		}
+		if usr.Stocks(c.Ticker)+stocks < 0 {
+			return vanerrors.NewSimple(NotEnoughStocks, fmt.Sprintf("has %d, need %d", usr.Stocks(c.Ticker), -stocks))
+		}
+
+		// Updates the user
+		if solids != 0 {
+			usr, err = tx.UpdateSolids(ctx, usr.Id, solids, reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+		}
+
+		if stocks != 0 {
+			usr, err = tx.UpdateStocks(ctx, usr.Id, c.Ticker, stocks, reason)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+			}
+		}
+
+		return nil
+	})
+
+	return usr, err
 }
@@ -0,0 +1,187 @@
+package user_service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/order_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/orderbook"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorSelectingOrder = "error selecting order"
+	ErrorSavingOrder    = "error saving order"
+	NotOrderOwner       = "not order owner"
+	OrderIsClosed       = "order is closed"
+)
+
+// The maximum amount of price levels of one side in the depth
+var DepthLimit = 50
+
+// Order data, the empty ticker is the default company
+type NewOrder struct {
+	Ticker string         `json:"ticker"`
+	Side   order_cfg.Side `json:"side"`
+	Price  int64          `json:"price"`
+	Amount int64          `json:"amount"`
+}
+
+// Gets the other side
+func otherSide(side order_cfg.Side) order_cfg.Side {
+	if side == order_cfg.BUY {
+		return order_cfg.SELL
+	}
+	return order_cfg.BUY
+}
+
+// Saves the orders with the balance changes, returns the user of the id
+func saveOrders(ctx context.Context, id uint64, orders []order_cfg.Order, changes []db_cfg.BalanceChange, db db_cfg.DataBase) (*user_cfg.User, error) {
+	users, err := db.SaveOrders(ctx, orders, changes)
+	if vanerrors.GetName(err) == db_cfg.NotEnoughBalance {
+		return nil, vanerrors.NewSimple(db_cfg.NotEnoughBalance)
+	}
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSavingOrder, err, vanerrors.EmptyHandler)
+	}
+
+	for i := range users {
+		if users[i].Id == id {
+			return &users[i], nil
+		}
+	}
+
+	return Get(ctx, id, db)
+}
+
+// Places the limit order, it is matched with the open orders and the rest is reserved and rests in the book
+//
+// The orders of the company are matched one by one, the company and the book are locked until the orders are saved
+// (the users are locked by the balance changes in the id order)
+//
+// Returns the order with the trades and the user
+func (n NewOrder) Place(ctx context.Context, id uint64, db db_cfg.DataBase) (*order_cfg.Order, []order_cfg.Fill, *user_cfg.User, error) {
+	// Selects the company
+	c, err := GetCompany(ctx, n.Ticker, db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Creates the order
+	o, err := order_cfg.NewOrder(id, c.Ticker, n.Side, n.Price, n.Amount)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Selects the user by id
+	usr, err := Get(ctx, id, db)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Checks user balance (the balance can't become negative when the orders are saved)
+	if o.Side == order_cfg.BUY && usr.SolidBalance < o.Reserved {
+		return nil, nil, usr, vanerrors.NewSimple(NotEnoughSolids, fmt.Sprintf("has %d, need %d", usr.SolidBalance, o.Reserved))
+	}
+	if o.Side == order_cfg.SELL && usr.Stocks(o.Ticker) < o.Reserved {
+		return nil, nil, usr, vanerrors.NewSimple(NotEnoughStocks, fmt.Sprintf("has %d, need %d", usr.Stocks(o.Ticker), o.Reserved))
+	}
+
+	var match orderbook.Match
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Locks the company
+		_, err := GetCompany(ctx, o.Ticker, tx)
+		if err != nil {
+			return err
+		}
+
+		// Gets the book
+		orders, err := tx.GetOpenOrders(ctx, o.Ticker, otherSide(o.Side))
+		if err != nil {
+			return vanerrors.NewWrap(ErrorSelectingOrder, err, vanerrors.EmptyHandler)
+		}
+
+		// Matches the order
+		match = orderbook.Place(*o, orders, time.Now())
+
+		// Saves the orders
+		usr, err = saveOrders(ctx, id, match.Orders, match.Changes, tx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	placed := match.Orders[len(match.Orders)-1]
+	return &placed, match.Fills, usr, nil
+}
+
+// Cancels the open order, the rest of the reserve is returned
+//
+// The order is locked, so it can't be matched or canceled at the same time
+func CancelOrder(ctx context.Context, id uint64, orderId string, db db_cfg.DataBase) (*order_cfg.Order, *user_cfg.User, error) {
+	var canceled order_cfg.Order
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the order
+		o, err := tx.GetOrder(ctx, orderId)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorSelectingOrder, err, vanerrors.EmptyHandler)
+		}
+
+		// Checks the order
+		if o.UserId != id {
+			return vanerrors.NewSimple(NotOrderOwner)
+		}
+		if !o.IsOpen() {
+			return vanerrors.NewSimple(OrderIsClosed, fmt.Sprintf("order is %s", o.Status))
+		}
+
+		// Cancels the order
+		var change db_cfg.BalanceChange
+		canceled, change = orderbook.Cancel(*o, time.Now())
+
+		usr, err = saveOrders(ctx, id, []order_cfg.Order{canceled}, []db_cfg.BalanceChange{change}, tx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &canceled, usr, nil
+}
+
+// Gets all orders of the user
+func GetOrders(ctx context.Context, id uint64, db db_cfg.DataBase) ([]order_cfg.Order, error) {
+	orders, err := db.GetOrders(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelectingOrder, err, vanerrors.EmptyHandler)
+	}
+	return orders, nil
+}
+
+// Gets the price levels of the open orders of the company (bids are buying, asks are selling)
+func Depth(ctx context.Context, ticker string, db db_cfg.DataBase) ([]orderbook.Level, []orderbook.Level, error) {
+	// Selects the company
+	c, err := GetCompany(ctx, ticker, db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bids, err := db.GetOpenOrders(ctx, c.Ticker, order_cfg.BUY)
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorSelectingOrder, err, vanerrors.EmptyHandler)
+	}
+
+	asks, err := db.GetOpenOrders(ctx, c.Ticker, order_cfg.SELL)
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorSelectingOrder, err, vanerrors.EmptyHandler)
+	}
+
+	return orderbook.Depth(bids, DepthLimit), orderbook.Depth(asks, DepthLimit), nil
+}
@@ -0,0 +1,84 @@
+package user_service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/price_cfg"
+	"github.com/vandi37/StocksBack/pkg/price"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	InvalidInterval = "invalid interval"
+	InvalidRange    = "invalid range"
+)
+
+// The candle intervals
+var Intervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"1h": time.Hour,
+	"1d": time.Hour * 24,
+}
+
+// Global variables
+var (
+	HistoryLimit     = 1000           // the maximum amount of candles in one request
+	HistoryRetention = time.Hour * 24 // the time the raw price changes are kept before downsampling
+)
+
+// Gets the price history of the company as candles of the interval between from and to
+//
+// If to is zero it is now, if from is zero it is HistoryLimit intervals before to
+func PriceHistory(ctx context.Context, ticker string, interval string, from time.Time, to time.Time, db db_cfg.DataBase) ([]price_cfg.Candle, error) {
+	// Gets the interval
+	d, ok := Intervals[interval]
+	if !ok {
+		return nil, vanerrors.NewSimple(InvalidInterval, fmt.Sprintf("interval %s is not allowed, allowed intervals: 1m, 1h, 1d", interval))
+	}
+
+	// Gets the range
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-d * time.Duration(HistoryLimit-1))
+	}
+
+	if !from.Before(to) {
+		return nil, vanerrors.NewSimple(InvalidRange, "from should be before to")
+	}
+	if to.Sub(from.Truncate(d)) > d*time.Duration(HistoryLimit) {
+		return nil, vanerrors.NewSimple(InvalidRange, fmt.Sprintf("the maximum amount of candles is %d", HistoryLimit))
+	}
+
+	// Selects the company
+	c, err := GetCompany(ctx, ticker, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return price.History(ctx, c.Ticker, d, from, to, db)
+}
+
+// Downsamples the old price changes of all companies, returns the amount of removed changes
+func DownsamplePrice(ctx context.Context, db db_cfg.DataBase) (int64, error) {
+	companies, err := db.GetCompanies(ctx)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorSelectingCompany, err, vanerrors.EmptyHandler)
+	}
+
+	var res int64
+	for _, c := range companies {
+		n, err := Market.Downsample(ctx, c.Ticker, HistoryRetention, db)
+		res += n
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,42 @@
+package user_service
+
+import (
+	"context"
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorReconciling = "error reconciling"
+)
+
+// Compares the balances of all users with the sums of the ledger entries, returns the drifts
+//
+// If correct is true the balances are set to the ledger (the ledger entries are never changed)
+func Reconcile(ctx context.Context, correct bool, db db_cfg.DataBase) ([]ledger_cfg.Drift, error) {
+	drifts, err := db.GetDrifts(ctx)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorReconciling, err, vanerrors.EmptyHandler)
+	}
+
+	if !correct || len(drifts) == 0 {
+		return drifts, nil
+	}
+
+	// All corrections of the run have the same reference
+	reason, err := ledger_cfg.NewReason(ledger_cfg.CORRECTION)
+	if err != nil {
+		return drifts, vanerrors.NewWrap(ErrorReconciling, err, vanerrors.EmptyHandler)
+	}
+
+	for _, d := range drifts {
+		_, err = db.Correct(ctx, d.UserId, d.Ticker, reason)
+		if err != nil {
+			return drifts, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+	}
+
+	return drifts, nil
+}
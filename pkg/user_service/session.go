@@ -0,0 +1,173 @@
+package user_service
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/session_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorCreatingSession  = "error creating session"
+	ErrorSelectingSession = "error selecting session"
+	ErrorUpdatingSession  = "error updating session"
+	SessionIsRevoked      = "session is revoked"
+	SessionIsExpired      = "session is expired"
+)
+
+// The session lifetime (the refresh token lifetime)
+var SessionLimit = time.Hour * 24 * 30
+
+// Refresh data
+type RefreshToken struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Starts a new session, returns it with the refresh token
+func StartSession(ctx context.Context, id uint64, db db_cfg.DataBase) (*session_cfg.Session, string, error) {
+	// Creates the session
+	session, token, err := session_cfg.NewSession(id, SessionLimit)
+	if err != nil {
+		return nil, "", vanerrors.NewWrap(ErrorCreatingSession, err, vanerrors.EmptyHandler)
+	}
+
+	// Saves the session
+	err = db.CreateSession(ctx, *session)
+	if err != nil {
+		return nil, "", vanerrors.NewWrap(ErrorCreatingSession, err, vanerrors.EmptyHandler)
+	}
+
+	return session, token, nil
+}
+
+// Checks that the session exists and is active
+func CheckSession(ctx context.Context, id string, db db_cfg.DataBase) (*session_cfg.Session, error) {
+	// Selects the session
+	session, err := db.GetSession(ctx, id)
+	if err != nil {
+		return nil, vanerrors.NewWrap(ErrorSelectingSession, err, vanerrors.EmptyHandler)
+	}
+
+	// Checks the session
+	if session.IsRevoked {
+		return session, vanerrors.NewSimple(SessionIsRevoked)
+	}
+	if !session.IsActive() {
+		return session, vanerrors.NewSimple(SessionIsExpired)
+	}
+
+	return session, nil
+}
+
+// Gets the session of the refresh token
+func (t RefreshToken) session(ctx context.Context, db db_cfg.DataBase) (*session_cfg.Session, string, error) {
+	// Parses the token
+	id, secret, err := session_cfg.ParseToken(t.RefreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Selects the session
+	session, err := CheckSession(ctx, id, db)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, secret, nil
+}
+
+// Rotates the refresh token, returns the session with the new refresh token
+//
+// If an old refresh token is used again the session is revoked, because the token was stolen
+// (the session is locked, so one token can't be rotated twice)
+func (t RefreshToken) Refresh(ctx context.Context, db db_cfg.DataBase) (*session_cfg.Session, string, error) {
+	var session *session_cfg.Session
+	var token string
+	var reused bool
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Gets the session
+		var secret string
+		var err error
+		session, secret, err = t.session(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks the token, the revoke is saved
+		if !session.CheckToken(secret) {
+			_, err = tx.RevokeSession(ctx, session.Id)
+			if err != nil {
+				return vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+			}
+			reused = true
+			return nil
+		}
+
+		// Rotates the token
+		token, err = session.NewToken(SessionLimit)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+		}
+
+		session, err = tx.UpdateSessionToken(ctx, session.Id, session.Token, session.ExpiresAt)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if reused {
+		return nil, "", vanerrors.NewSimple(session_cfg.InvalidRefreshToken, "the token was already used, session revoked")
+	}
+
+	return session, token, nil
+}
+
+// Signs out, revokes the session of the refresh token
+func (t RefreshToken) SignOut(ctx context.Context, db db_cfg.DataBase) (*session_cfg.Session, error) {
+	var session *session_cfg.Session
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Gets the session
+		var secret string
+		var err error
+		session, secret, err = t.session(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		// Checks the token
+		if !session.CheckToken(secret) {
+			return vanerrors.NewSimple(session_cfg.InvalidRefreshToken)
+		}
+
+		// Revokes the session
+		session, err = tx.RevokeSession(ctx, session.Id)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Signs out everywhere, revokes all sessions of the user
+func SignOutAll(ctx context.Context, id uint64, db db_cfg.DataBase) (int64, error) {
+	n, err := db.RevokeSessions(ctx, id)
+	if err != nil {
+		return 0, vanerrors.NewWrap(ErrorUpdatingSession, err, vanerrors.EmptyHandler)
+	}
+	return n, nil
+}
@@ -0,0 +1,98 @@
+package user_service
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/ledger_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	InvalidAmount = "invalid amount"
+	SelfTransfer  = "self transfer"
+	MemoTooLong   = "memo is too long"
+)
+
+// The maximum memo length
+var MemoLimit = 140
+
+// Transfer data
+type NewTransfer struct {
+	To     uint64 `json:"to"`
+	Amount int64  `json:"amount"`
+	Memo   string `json:"memo"` // optional
+}
+
+// Transfers solids from one user to another, returns both users
+func Transfer(ctx context.Context, from uint64, to uint64, amount int64, memo string, db db_cfg.DataBase) (*user_cfg.User, *user_cfg.User, error) {
+	// Checks the data
+	if amount <= 0 {
+		return nil, nil, vanerrors.NewSimple(InvalidAmount, "the amount should be positive")
+	}
+	if from == to {
+		return nil, nil, vanerrors.NewSimple(SelfTransfer)
+	}
+	if utf8.RuneCountInString(memo) > MemoLimit {
+		return nil, nil, vanerrors.NewSimple(MemoTooLong, fmt.Sprintf("the maximum length is %d", MemoLimit))
+	}
+
+	reason, err := ledger_cfg.NewReason(ledger_cfg.TRANSFER)
+	if err != nil {
+		return nil, nil, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+	}
+	reason.Memo = memo
+
+	var fromUsr, toUsr *user_cfg.User
+	err = db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the users in the id order, so two opposite transfers can't deadlock
+		users := map[uint64]*user_cfg.User{}
+		for _, id := range []uint64{min(from, to), max(from, to)} {
+			usr, err := Get(ctx, id, tx)
+			if err != nil {
+				return err
+			}
+			users[id] = usr
+		}
+		fromUsr, toUsr = users[from], users[to]
+
+		// Checks block
+		if fromUsr.IsBlocked {
+			return vanerrors.NewSimple(UserIsBlocked, fmt.Sprintf("user %d is blocked", from))
+		}
+		if toUsr.IsBlocked {
+			return vanerrors.NewSimple(UserIsBlocked, fmt.Sprintf("user %d is blocked", to))
+		}
+
+		// Checks user balance
+		if fromUsr.SolidBalance < amount {
+			return vanerrors.NewSimple(NotEnoughSolids, fmt.Sprintf("has %d, need %d", fromUsr.SolidBalance, amount))
+		}
+
+		// Transfers the solids
+		var err error
+		fromUsr, toUsr, err = tx.Transfer(ctx, from, to, amount, reason)
+		if vanerrors.GetName(err) == db_cfg.NotEnoughBalance {
+			return vanerrors.NewSimple(NotEnoughSolids)
+		}
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fromUsr, toUsr, nil
+}
+
+// Transfers solids to the user
+func (t NewTransfer) Transfer(ctx context.Context, from uint64, db db_cfg.DataBase) (*user_cfg.User, *user_cfg.User, error) {
+	return Transfer(ctx, from, t.To, t.Amount, t.Memo, db)
+}
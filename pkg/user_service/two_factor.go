@@ -0,0 +1,251 @@
+package user_service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+
+	"github.com/vandi37/StocksBack/config/db_cfg"
+	"github.com/vandi37/StocksBack/config/user_cfg"
+	"github.com/vandi37/StocksBack/pkg/encrypt"
+	"github.com/vandi37/StocksBack/pkg/hash"
+	"github.com/vandi37/StocksBack/pkg/totp"
+	"github.com/vandi37/vanerrors"
+)
+
+// The errors
+const (
+	ErrorEnrollingTwoFactor = "error enrolling two factor"
+	ErrorCheckingTwoFactor  = "error checking two factor"
+	TwoFactorRequired       = "two factor code required"
+	WrongCode               = "wrong code"
+	TwoFactorEnabled        = "two factor is enabled"
+	TwoFactorNotEnabled     = "two factor isn't enabled"
+	TwoFactorNotEnrolled    = "two factor isn't enrolled"
+)
+
+// Global variables
+var (
+	TOTP                = totp.New()   // the code generator, its clock could be replaced
+	Issuer              = "StocksBack" // the issuer shown in authenticator apps
+	RecoveryCodesAmount = 10           // the amount of recovery codes
+)
+
+// Two factor code data
+type TwoFactorCode struct {
+	Code string `json:"code"`
+}
+
+// Generates a new recovery code
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(buf)
+	return code[:5] + "-" + code[5:], nil
+}
+
+// Starts the two factor enrollment, returns the secret and the otpauth uri
+//
+// The two factor is enabled only after the code is confirmed
+func EnrollTwoFactor(ctx context.Context, id uint64, db db_cfg.DataBase) (string, string, error) {
+	var secret, uri string
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		usr, err := Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		if usr.TwoFactor.Enabled {
+			return vanerrors.NewSimple(TwoFactorEnabled)
+		}
+
+		// Generates the secret
+		secret, err = totp.GenerateSecret()
+		if err != nil {
+			return vanerrors.NewWrap(ErrorEnrollingTwoFactor, err, vanerrors.EmptyHandler)
+		}
+
+		encrypted, err := encrypt.Encrypt(secret)
+		if err != nil {
+			return vanerrors.NewWrap(ErrorEnrollingTwoFactor, err, vanerrors.EmptyHandler)
+		}
+
+		// Saves the secret
+		_, err = tx.UpdateTwoFactor(ctx, id, user_cfg.TwoFactor{Secret: encrypted})
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		uri = TOTP.URI(Issuer, usr.Name, secret)
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, uri, nil
+}
+
+// Checks the totp code with the encrypted secret, returns the step of the code
+//
+// The codes of the last accepted step and the steps before are refused, so a code can't be replayed
+func checkCode(usr *user_cfg.User, code string) (uint64, bool, error) {
+	secret, err := encrypt.Decrypt(usr.TwoFactor.Secret)
+	if err != nil {
+		return 0, false, vanerrors.NewWrap(ErrorCheckingTwoFactor, err, vanerrors.EmptyHandler)
+	}
+
+	step, ok := TOTP.Verify(secret, code, usr.TwoFactor.LastStep)
+	return step, ok, nil
+}
+
+// Confirms the enrollment with the code, enables two factor and returns the recovery codes
+func (c TwoFactorCode) Confirm(ctx context.Context, id uint64, db db_cfg.DataBase) ([]string, *user_cfg.User, error) {
+	var codes []string
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		if usr.TwoFactor.Enabled {
+			return vanerrors.NewSimple(TwoFactorEnabled)
+		}
+		if usr.TwoFactor.Secret == "" {
+			return vanerrors.NewSimple(TwoFactorNotEnrolled)
+		}
+
+		// Checks the code
+		step, ok, err := checkCode(usr, c.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return vanerrors.NewSimple(WrongCode)
+		}
+
+		// Generates the recovery codes, only the hashes are saved
+		codes = make([]string, RecoveryCodesAmount)
+		hashes := make([]string, RecoveryCodesAmount)
+		for i := range codes {
+			codes[i], err = newRecoveryCode()
+			if err != nil {
+				return vanerrors.NewWrap(ErrorEnrollingTwoFactor, err, vanerrors.EmptyHandler)
+			}
+			hashes[i] = hash.HashToken(codes[i])
+		}
+
+		// Enables two factor
+		usr, err = tx.UpdateTwoFactor(ctx, id, user_cfg.TwoFactor{
+			Secret:        usr.TwoFactor.Secret,
+			Enabled:       true,
+			RecoveryCodes: hashes,
+			LastStep:      step,
+		})
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, usr, err
+	}
+
+	return codes, usr, nil
+}
+
+// Disables two factor, the code (or a recovery code) is required
+func (c TwoFactorCode) Disable(ctx context.Context, id uint64, db db_cfg.DataBase) (*user_cfg.User, error) {
+	var usr *user_cfg.User
+
+	err := db.WithTx(ctx, func(tx db_cfg.DataBase) error {
+		// Selects the user by id
+		var err error
+		usr, err = Get(ctx, id, tx)
+		if err != nil {
+			return err
+		}
+
+		if !usr.TwoFactor.Enabled {
+			return vanerrors.NewSimple(TwoFactorNotEnabled)
+		}
+
+		// Checks the code
+		usr, err = CheckTwoFactor(ctx, usr, c.Code, tx)
+		if err != nil {
+			return err
+		}
+
+		// Disables two factor
+		usr, err = tx.UpdateTwoFactor(ctx, id, user_cfg.TwoFactor{})
+		if err != nil {
+			return vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return nil
+	})
+
+	return usr, err
+}
+
+// Checks the two factor code of the user if two factor is enabled
+//
+// The code and a recovery code (it could be used instead of the code) are accepted only once (the user should be selected in the transaction)
+func CheckTwoFactor(ctx context.Context, usr *user_cfg.User, code string, db db_cfg.DataBase) (*user_cfg.User, error) {
+	if !usr.TwoFactor.Enabled {
+		return usr, nil
+	}
+
+	if code == "" {
+		return usr, vanerrors.NewSimple(TwoFactorRequired)
+	}
+
+	// Checks the totp code
+	step, ok, err := checkCode(usr, code)
+	if err != nil {
+		return usr, err
+	}
+	if ok {
+		// Uses the step of the code
+		tf := usr.TwoFactor
+		tf.LastStep = step
+
+		usr, err = db.UpdateTwoFactor(ctx, usr.Id, tf)
+		if err != nil {
+			return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return usr, nil
+	}
+
+	// Checks the recovery codes
+	for i, h := range usr.TwoFactor.RecoveryCodes {
+		if !hash.CompareToken(code, h) {
+			continue
+		}
+
+		// Uses the recovery code
+		tf := usr.TwoFactor
+		tf.RecoveryCodes = slices.Delete(slices.Clone(tf.RecoveryCodes), i, i+1)
+
+		usr, err = db.UpdateTwoFactor(ctx, usr.Id, tf)
+		if err != nil {
+			return usr, vanerrors.NewWrap(ErrorUpdatingUser, err, vanerrors.EmptyHandler)
+		}
+
+		return usr, nil
+	}
+
+	return usr, vanerrors.NewSimple(WrongCode)
+}
@@ -0,0 +1,94 @@
+package user_service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandi37/StocksBack/config/config"
+	"github.com/vandi37/StocksBack/pkg/dbtest"
+	"github.com/vandi37/StocksBack/pkg/encrypt"
+	"github.com/vandi37/StocksBack/pkg/file_db"
+	"github.com/vandi37/StocksBack/pkg/totp"
+	"github.com/vandi37/StocksBack/pkg/user_service"
+	"github.com/vandi37/vanerrors"
+)
+
+// The password of the test user
+const password = "Correct-Horse-1"
+
+func TestTwoFactor(t *testing.T) {
+	oldKey, oldTOTP := encrypt.KEY, user_service.TOTP
+	defer func() { encrypt.KEY, user_service.TOTP = oldKey, oldTOTP }()
+
+	// The fixed clock
+	now := time.Unix(1_700_000_000, 0)
+	encrypt.KEY = "two factor key"
+	user_service.TOTP = totp.New()
+	user_service.TOTP.Now = func() time.Time { return now }
+
+	ctx := context.Background()
+	db := dbtest.Open(t, file_db.MemoryConstructor{}, func(t *testing.T) config.DatabaseCfg { return config.DatabaseCfg{} })
+
+	usr, err := user_service.SignUpUser{Name: "alice", Password: password}.SignUp(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, _, err := user_service.EnrollTwoFactor(ctx, usr.Id, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := func(at time.Time) string {
+		t.Helper()
+		c, err := user_service.TOTP.Code(secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	signIn := func(code string) error {
+		t.Helper()
+		ok, _, err := user_service.SignInUser{Id: usr.Id, Password: password, Code: code}.SignIn(ctx, db)
+		if err == nil && !ok {
+			t.Fatal("the password isn't accepted")
+		}
+		return err
+	}
+	wrong := func(err error) {
+		t.Helper()
+		if vanerrors.GetName(err) != user_service.WrongCode {
+			t.Fatalf("want %q error, got %v", user_service.WrongCode, err)
+		}
+	}
+
+	recovery, _, err := user_service.TwoFactorCode{Code: code(now)}.Confirm(ctx, usr.Id, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The confirmation code can't be used again
+	wrong(signIn(code(now)))
+
+	// The code of the next step is accepted in the skew window, once
+	if err := signIn(code(now.Add(30 * time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	wrong(signIn(code(now.Add(30 * time.Second))))
+
+	// The code expires after the skew window
+	now = now.Add(2 * time.Minute)
+	wrong(signIn(code(now.Add(-60 * time.Second))))
+	if err := signIn(code(now)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recovery code is used once
+	if err := signIn(recovery[0]); err != nil {
+		t.Fatal(err)
+	}
+	wrong(signIn(recovery[0]))
+	if err := signIn(recovery[1]); err != nil {
+		t.Fatal(err)
+	}
+}